@@ -0,0 +1,1393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"wallet/internal/storage"
+	"wallet/pkg/backup"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+	"wallet/pkg/progress"
+	"wallet/pkg/psbt"
+	"wallet/pkg/scanner"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// runOffline despacha os comandos que operam só sobre o banco. Só backup,
+// bumpfee e cpfp precisam do xprv (ou da tpub) para derivar descritores e
+// chaves de troco; reconcile usa a tpub da conta registrada no banco e só pede
+// a chave se ela ainda não foi registrada. Os demais nunca a pedem.
+func runOffline(db *storage.DB, keys *walletKeys, retention storage.RetentionPolicy, command string, args []string) error {
+	if signsWithWallet(command, args) && keys.watchOnly != nil {
+		if command == "psbt" {
+			command = "psbt sign"
+		}
+		return fmt.Errorf("%s assina com as chaves privadas e não está disponível no modo watch-only; grave um PSBT e assine com offline-sign", command)
+	}
+	switch command {
+	case "db":
+		return runDB(db, retention, args)
+	case "reconcile":
+		account, found, err := progress.LoadAccount(db)
+		if err != nil {
+			return err
+		}
+		if found {
+			return runReconcile(db, account.XPub, args)
+		}
+		walletKey, err := keys.Key()
+		if err != nil {
+			return err
+		}
+		return runReconcile(db, walletKey, args)
+	case "backup", "bumpfee", "cpfp":
+		walletKey, err := keys.Key()
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "backup":
+			return runBackup(db, walletKey, args)
+		case "bumpfee":
+			return runBumpFee(db, walletKey, args)
+		default:
+			return runCPFP(db, walletKey, args)
+		}
+	case "restore":
+		return runRestore(db, args)
+	case "label":
+		return runLabel(db, args)
+	case "proofs":
+		return runProofs(db, args)
+	case "multisig":
+		return runMultisig(db, args)
+	case "signtx":
+		return runSignTx(db, args)
+	case "opreturn":
+		return runOpReturn(db)
+	case "psbt":
+		return runPSBT(db, args)
+	case "pending":
+		return runPending(db)
+	default:
+		return fmt.Errorf("comando desconhecido: %s", command)
+	}
+}
+
+// signsWithWallet indica se o comando assina com as chaves privadas da
+// carteira, que não existem no modo watch-only.
+func signsWithWallet(command string, args []string) bool {
+	switch command {
+	case "signtx", "bumpfee", "cpfp":
+		return true
+	case "psbt":
+		return len(args) > 0 && args[0] == "sign"
+	}
+	return false
+}
+
+// runRescan reconstrói UTXOs e ledger a partir dos blocos em cache.
+// Por padrão usa só os blocos do índice; -all reprocessa todos os blocos já
+// escaneados, necessário depois de adicionar chaves novas.
+func runRescan(db *storage.DB, state *models.WalletState, lastProcessed int, args []string) error {
+	fs := flag.NewFlagSet("rescan", flag.ContinueOnError)
+	all := fs.Bool("all", false, "reprocessa todos os blocos até o último processado")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var heights []int
+	if *all {
+		for h := 1; h <= lastProcessed; h++ {
+			heights = append(heights, h)
+		}
+	} else {
+		var err error
+		heights, err = scanner.IndexedHeights(db)
+		if err != nil {
+			return fmt.Errorf("erro ao ler índice de blocos: %w", err)
+		}
+		if len(heights) == 0 && lastProcessed > 0 {
+			return fmt.Errorf("índice de blocos vazio; use rescan -all para reconstruí-lo")
+		}
+	}
+
+	if err := scanner.Rescan(db, state, heights, lastProcessed); err != nil {
+		return err
+	}
+	fmt.Printf("Rescan concluído: %d blocos reprocessados, %d UTXOs\n", len(heights), len(state.UTXOs))
+	return nil
+}
+
+// runExplain refaz o scan e mostra, por endereço, onde cada outpoint foi
+// recebido e gasto, seguido das anomalias que explicam diferenças de saldo:
+//
+//	explain [-address endereço] [-outpoint txid:vout]
+func runExplain(db *storage.DB, state *models.WalletState, lastProcessed int, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	address := fs.String("address", "", "mostra apenas este endereço")
+	outpoint := fs.String("outpoint", "", "mostra apenas este outpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	explanation, err := scanner.Explain(db, state, lastProcessed)
+	if err != nil {
+		return err
+	}
+
+	byAddress := make(map[string][]*scanner.OutpointTrail)
+	var addresses []string
+	for _, trail := range explanation.Outpoints {
+		if (*address != "" && trail.Address != *address) || (*outpoint != "" && trail.Outpoint != *outpoint) {
+			continue
+		}
+		if _, ok := byAddress[trail.Address]; !ok {
+			addresses = append(addresses, trail.Address)
+		}
+		byAddress[trail.Address] = append(byAddress[trail.Address], trail)
+	}
+
+	for _, addr := range addresses {
+		fmt.Printf("Endereço %s\n", addr)
+		for _, trail := range byAddress[addr] {
+			fmt.Printf("  %s  %.8f  recebido no bloco %d", trail.Outpoint, trail.Value, trail.ReceivedHeight)
+			if trail.SpentHeight > 0 {
+				fmt.Printf(", gasto no bloco %d pela entrada %s\n", trail.SpentHeight, trail.SpentBy)
+			} else {
+				fmt.Println(", não gasto")
+			}
+		}
+	}
+
+	fmt.Printf("Saldo do replay até o bloco %d: %.8f\n", explanation.Height, explanation.Balance)
+	if len(explanation.Anomalies) == 0 {
+		fmt.Println("Nenhuma anomalia")
+		return nil
+	}
+	fmt.Printf("%d anomalias:\n", len(explanation.Anomalies))
+	for _, anomaly := range explanation.Anomalies {
+		fmt.Printf(" - bloco %d: %s: %s\n", anomaly.Height, anomaly.Kind, anomaly.Detail)
+	}
+	return nil
+}
+
+// runDB executa os subcomandos de manutenção do banco:
+//
+//	db stats
+//	db clear --blocks | --progress | --all
+//	db compact
+//	db verify
+//	db blocks [--node] [--repair]
+func runDB(db *storage.DB, retention storage.RetentionPolicy, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("uso: db stats | db clear --blocks|--progress|--all | db compact | db verify | db blocks [--node] [--repair]")
+	}
+
+	switch args[0] {
+	case "stats":
+		stats, err := db.Stats()
+		if err != nil {
+			return fmt.Errorf("erro ao ler estatísticas: %w", err)
+		}
+		fmt.Printf("Versão do formato: v%d\n", stats.SchemaVersion)
+		if stats.HasProgress {
+			fmt.Printf("Último bloco processado: %d\n", stats.Progress)
+		} else {
+			fmt.Println("Último bloco processado: nenhum")
+		}
+		if stats.LastBlock > 0 {
+			fmt.Printf("Blocos em cache: %d a %d\n", stats.FirstBlock, stats.LastBlock)
+		}
+		fmt.Printf("%-10s %10s %14s\n", "Prefixo", "Chaves", "Bytes")
+		for _, p := range stats.Prefixes {
+			name := p.Prefix
+			if name == "" {
+				name = "(outros)"
+			}
+			fmt.Printf("%-10s %10d %14d\n", name, p.Keys, p.Bytes)
+		}
+		return nil
+
+	case "clear":
+		fs := flag.NewFlagSet("db clear", flag.ContinueOnError)
+		blocks := fs.Bool("blocks", false, "remove o cache de blocos")
+		progress := fs.Bool("progress", false, "remove progresso, UTXOs, ledger e índice")
+		all := fs.Bool("all", false, "remove tudo, inclusive as chaves derivadas")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		switch {
+		case *all:
+			return db.ClearAll()
+		case *blocks || *progress:
+			if *blocks {
+				if err := db.ClearBlocks(); err != nil {
+					return fmt.Errorf("erro ao limpar blocos: %w", err)
+				}
+			}
+			if *progress {
+				if err := db.ClearProgress(); err != nil {
+					return fmt.Errorf("erro ao limpar progresso: %w", err)
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("informe --blocks, --progress ou --all")
+		}
+
+	case "compact":
+		return db.Compact()
+
+	case "verify":
+		problems, err := db.Verify()
+		if err != nil {
+			return fmt.Errorf("erro ao verificar banco: %w", err)
+		}
+		for _, problem := range problems {
+			fmt.Println(" -", problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d problemas encontrados", len(problems))
+		}
+		fmt.Println("Banco consistente")
+		return nil
+
+	case "blocks":
+		fs := flag.NewFlagSet("db blocks", flag.ContinueOnError)
+		node := fs.Bool("node", false, "compara o hash de cada bloco com a cadeia atual do nó")
+		repair := fs.Bool("repair", false, "remove os blocos com problema e busca de novo no nó")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		issues, err := db.VerifyBlocks(retention, *node)
+		if err != nil {
+			return fmt.Errorf("erro ao verificar cache de blocos: %w", err)
+		}
+		for _, issue := range issues {
+			fmt.Println(" -", issue)
+		}
+		if len(issues) == 0 {
+			fmt.Printf("Cache de blocos consistente (retenção: %s)\n", retention)
+			return nil
+		}
+		if !*repair {
+			return fmt.Errorf("%d problemas no cache de blocos; use db blocks --repair", len(issues))
+		}
+		rescanFrom, err := db.RepairBlocks(issues, true)
+		if err != nil {
+			return fmt.Errorf("erro ao reparar cache de blocos: %w", err)
+		}
+		fmt.Printf("Cache de blocos reparado: %d problemas\n", len(issues))
+		if rescanFrom > 0 {
+			fmt.Printf("Blocos já aplicados ao estado foram corrigidos a partir do %d; rode rescan -all\n", rescanFrom)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("subcomando db desconhecido: %s", args[0])
+	}
+}
+
+// backupPassphraseEnv permite passar a senha do backup sem expô-la na linha de comando.
+const backupPassphraseEnv = "WALLET_BACKUP_PASSPHRASE"
+
+// readBackupPassphrase obtém a senha do backup da variável
+// WALLET_BACKUP_PASSPHRASE ou, sem ela, pedindo no terminal. A senha nunca
+// vem de flag, que fica visível na lista de processos e no histórico do shell.
+func readBackupPassphrase(prompt string) string {
+	if passphrase := os.Getenv(backupPassphraseEnv); passphrase != "" {
+		return passphrase
+	}
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// runBackup grava descritores, chaves, UTXOs, ledger e rótulos num arquivo
+// portátil, cifrado com a senha de WALLET_BACKUP_PASSPHRASE ou do terminal:
+//
+//	backup -out arquivo
+func runBackup(db *storage.DB, xprv string, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "wallet-backup.json", "arquivo de saída")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !helpers.IsPrivateKey(xprv) {
+		return fmt.Errorf("o backup guarda o xprv e não está disponível no modo watch-only; guarde o arquivo de export-watchonly")
+	}
+	payload, err := backup.Collect(db, xprv)
+	if err != nil {
+		return err
+	}
+	passphrase := readBackupPassphrase("Senha do backup (vazia = sem cifra): ")
+	if err := backup.Write(*out, payload, passphrase); err != nil {
+		return err
+	}
+	if passphrase == "" {
+		fmt.Println("Aviso: backup gravado sem cifra; ele contém a chave privada da carteira")
+	}
+	fmt.Printf("Backup gravado em %s: %d chaves, %d UTXOs, %d lançamentos, %d pendentes, altura %d\n",
+		*out, payload.KeyCount, len(payload.UTXOs), len(payload.Ledger), len(payload.Pending), payload.Height)
+	return nil
+}
+
+// runRestore reconstrói o banco a partir de um backup, decifrado com a senha
+// de WALLET_BACKUP_PASSPHRASE ou do terminal. O próximo scan continua da
+// altura do snapshot:
+//
+//	restore -in arquivo [-force]
+func runRestore(db *storage.DB, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("in", "wallet-backup.json", "arquivo de backup")
+	force := fs.Bool("force", false, "apaga o conteúdo atual do banco antes de restaurar")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// O arquivo é lido e conferido antes de qualquer alteração no banco
+	payload, err := backup.Read(*in, readBackupPassphrase("Senha do backup (vazia se não cifrado): "))
+	if err != nil {
+		return err
+	}
+	// Com -force, o banco só é apagado junto com a gravação do backup já validado
+	state, err := backup.Restore(db, payload, *force)
+	if err != nil {
+		return err
+	}
+
+	problems, err := db.Verify()
+	if err != nil {
+		return fmt.Errorf("erro ao verificar banco restaurado: %w", err)
+	}
+	for _, problem := range problems {
+		fmt.Println(" -", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("banco restaurado com %d problemas", len(problems))
+	}
+	fmt.Printf("Carteira restaurada: %d chaves, %d UTXOs, retomando do bloco %d\n",
+		len(state.PublicKeys), len(state.UTXOs), payload.Height+1)
+	return nil
+}
+
+// runLabel lista, grava ou remove rótulos de endereços e outpoints:
+//
+//	label                      lista os rótulos
+//	label <alvo> <texto>       grava o rótulo
+//	label <alvo>               remove o rótulo
+func runLabel(db *storage.DB, args []string) error {
+	switch len(args) {
+	case 0:
+		var labels map[string]string
+		if err := db.View(func(txn storage.Txn) error {
+			var err error
+			labels, err = storage.ListLabels(txn)
+			return err
+		}); err != nil {
+			return fmt.Errorf("erro ao ler rótulos: %w", err)
+		}
+		targets := make([]string, 0, len(labels))
+		for target := range labels {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		for _, target := range targets {
+			fmt.Printf("%s\t%s\n", target, labels[target])
+		}
+		return nil
+	case 1:
+		return db.Update(func(txn storage.Txn) error {
+			return storage.DeleteLabel(txn, args[0])
+		})
+	case 2:
+		return db.Update(func(txn storage.Txn) error {
+			return storage.PutLabel(txn, args[0], args[1])
+		})
+	default:
+		return fmt.Errorf("uso: label [<endereço|txid:vout> [texto]]")
+	}
+}
+
+// ProofExport é uma prova SPV exportada junto com os lançamentos do ledger da transação.
+type ProofExport struct {
+	models.TxProof
+	Ledger []models.LedgerEntry
+}
+
+// runProofs gerencia as provas SPV das transações da carteira:
+//
+//	proofs verify                      confere todas as provas gravadas
+//	proofs fetch                       busca no nó as provas que faltam no ledger
+//	proofs export [-out arquivo] [txid...]
+func runProofs(db *storage.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("uso: proofs verify | proofs fetch | proofs export [-out arquivo] [txid...]")
+	}
+
+	var proofs []models.TxProof
+	var entries []models.LedgerEntry
+	if err := db.View(func(txn storage.Txn) error {
+		var err error
+		if proofs, err = storage.ListProofs(txn); err != nil {
+			return err
+		}
+		entries, err = storage.ListLedger(txn, 0, int(^uint(0)>>1))
+		return err
+	}); err != nil {
+		return fmt.Errorf("erro ao ler provas: %w", err)
+	}
+
+	switch args[0] {
+	case "verify":
+		failed := 0
+		for _, proof := range proofs {
+			if err := scanner.VerifyProof(db, proof); err != nil {
+				fmt.Printf(" - %s (bloco %d): %v\n", proof.TxID, proof.Height, err)
+				failed++
+			}
+		}
+		missing, err := scanner.MissingProofs(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d provas conferidas, %d inválidas, %d transações do ledger sem prova\n", len(proofs), failed, len(missing))
+		if failed > 0 {
+			return fmt.Errorf("%d provas inválidas", failed)
+		}
+		return nil
+
+	case "fetch":
+		missing, err := scanner.MissingProofs(db)
+		if err != nil {
+			return err
+		}
+		fetched := 0
+		for txid, height := range missing {
+			proof, err := scanner.FetchProof(db, txid, height)
+			if err != nil {
+				fmt.Printf(" - %s: %v\n", txid, err)
+				continue
+			}
+			if err := db.Update(func(txn storage.Txn) error {
+				return storage.PutProof(txn, proof)
+			}); err != nil {
+				return err
+			}
+			fetched++
+		}
+		fmt.Printf("%d de %d provas obtidas do nó\n", fetched, len(missing))
+		return nil
+
+	case "export":
+		fs := flag.NewFlagSet("proofs export", flag.ContinueOnError)
+		out := fs.String("out", "wallet-proofs.json", "arquivo de saída")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		only := make(map[string]bool)
+		for _, txid := range fs.Args() {
+			only[txid] = true
+		}
+
+		var export []ProofExport
+		for _, proof := range proofs {
+			if len(only) > 0 && !only[proof.TxID] {
+				continue
+			}
+			item := ProofExport{TxProof: proof}
+			for _, entry := range entries {
+				if entry.TxID == proof.TxID {
+					item.Ledger = append(item.Ledger, entry)
+				}
+			}
+			export = append(export, item)
+		}
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return fmt.Errorf("erro ao serializar provas: %w", err)
+		}
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			return fmt.Errorf("erro ao gravar %s: %w", *out, err)
+		}
+		fmt.Printf("%d provas exportadas para %s (confira com bitcoin-cli verifytxoutproof <MerkleBlock>)\n", len(export), *out)
+		return nil
+
+	default:
+		return fmt.Errorf("subcomando proofs desconhecido: %s", args[0])
+	}
+}
+
+// runReconcile compara os UTXOs salvos com o conjunto de UTXOs do nó:
+//
+//	reconcile [-follow] [-interval 10m]
+//
+// Com -follow, repete a conferência a cada intervalo até Ctrl+C, relendo o
+// estado do banco a cada rodada.
+func runReconcile(db *storage.DB, xprv string, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	follow := fs.Bool("follow", false, "repete a conferência periodicamente")
+	interval := fs.Duration("interval", 10*time.Minute, "intervalo entre conferências no modo -follow")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("intervalo inválido: %s", *interval)
+	}
+
+	descriptors, err := helpers.WalletDescriptors(xprv)
+	if err != nil {
+		return fmt.Errorf("erro ao gerar descritores: %w", err)
+	}
+
+	reconcile := func() (*helpers.ReconcileReport, error) {
+		height, state, err := progress.LoadProgress(db)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			return nil, fmt.Errorf("nenhum progresso salvo para conferir")
+		}
+		report, err := helpers.Reconcile(state, height, descriptors)
+		if err != nil {
+			return nil, err
+		}
+		helpers.PrintReconcileReport(report)
+		return report, nil
+	}
+
+	if !*follow {
+		report, err := reconcile()
+		if err != nil {
+			return err
+		}
+		if len(report.Diffs) > 0 {
+			return fmt.Errorf("%d divergências com o nó", len(report.Diffs))
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		fmt.Printf("== Conferência em %s ==\n", time.Now().Format(time.RFC3339))
+		// No modo contínuo um erro (nó fora do ar, por exemplo) não encerra o acompanhamento
+		if _, err := reconcile(); err != nil {
+			fmt.Printf("Erro na conferência: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runMultisig registra e lista multisigs P2WSH da carteira:
+//
+//	multisig create -m 2 -keys 0,1 [-pubkeys hex,...] [-sorted]
+//	multisig list
+//
+// As chaves de -keys são índices das chaves de recebimento da carteira;
+// -pubkeys acrescenta chaves de outros participantes.
+func runMultisig(db *storage.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("uso: multisig create -m M -keys i,j [-pubkeys hex,...] [-sorted] | multisig list")
+	}
+
+	state := &models.WalletState{}
+	if err := db.View(func(txn storage.Txn) error {
+		keys, err := storage.ListDerivedKeys(txn, models.BranchReceive)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			state.AddKey(key)
+		}
+		state.Multisigs, err = storage.ListMultisigs(txn)
+		return err
+	}); err != nil {
+		return fmt.Errorf("erro ao ler chaves: %w", err)
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("multisig create", flag.ContinueOnError)
+		m := fs.Int("m", 2, "assinaturas necessárias")
+		keyList := fs.String("keys", "0,1", "índices das chaves de recebimento da carteira, separados por vírgula")
+		pubKeyList := fs.String("pubkeys", "", "chaves públicas comprimidas de outros participantes, em hex")
+		sorted := fs.Bool("sorted", false, "ordena as chaves (BIP67)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		var pubKeys [][]byte
+		for _, field := range strings.Split(*keyList, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			index, err := strconv.Atoi(field)
+			if err != nil || index < 0 || index >= len(state.PublicKeys) {
+				return fmt.Errorf("índice de chave inválido: %q (%d chaves derivadas)", field, len(state.PublicKeys))
+			}
+			pubKeys = append(pubKeys, state.PublicKeys[index])
+		}
+		for _, field := range strings.Split(*pubKeyList, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			key, err := hex.DecodeString(field)
+			if err != nil {
+				return fmt.Errorf("chave pública inválida %q: %w", field, err)
+			}
+			pubKeys = append(pubKeys, key)
+		}
+
+		ms, err := helpers.NewMultisig(*m, pubKeys, *sorted)
+		if err != nil {
+			return err
+		}
+		if _, exists := state.Multisig(ms.Address); exists {
+			return fmt.Errorf("multisig %s já registrado", ms.Address)
+		}
+		if err := db.Update(func(txn storage.Txn) error {
+			return storage.PutMultisig(txn, ms)
+		}); err != nil {
+			return fmt.Errorf("erro ao registrar multisig: %w", err)
+		}
+		fmt.Printf("Multisig %d-de-%d registrado: %s\n", ms.M, len(ms.PubKeys), ms.Address)
+		fmt.Printf("  Witness script: %x\n", ms.WitnessScript)
+		fmt.Printf("  Witness program: %x\n", ms.WitnessProgram)
+		fmt.Printf("  Descritor: %s\n", helpers.MultisigDescriptor(ms))
+		fmt.Println("Fundos recebidos antes do registro só aparecem depois de rescan -all")
+		return nil
+
+	case "list":
+		for _, ms := range state.Multisigs {
+			owners := make([]string, len(ms.PubKeys))
+			for i, index := range helpers.MultisigKeyIndexes(state, ms) {
+				owners[i] = "externa"
+				if index >= 0 {
+					owners[i] = fmt.Sprintf("/0/%d", index)
+				}
+			}
+			fmt.Printf("%s\t%d-de-%d\tordenado=%t\tchaves=%s\n", ms.Address, ms.M, len(ms.PubKeys), ms.Sorted, strings.Join(owners, ","))
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("subcomando desconhecido: multisig %s", args[0])
+	}
+}
+
+// runSignTx assina com as chaves da carteira um gasto multisig recebido de
+// outro participante e imprime a transação, completa ou ainda parcial.
+func runSignTx(db *storage.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("uso: signtx <transação em hex>")
+	}
+	_, state, err := progress.LoadProgress(db)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("nenhum progresso salvo: escaneie a carteira antes de assinar")
+	}
+
+	rawTx, complete, err := helpers.SignRawTransaction(args[0], state)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		fmt.Printf("Transação ainda parcialmente assinada: %s\n", rawTx)
+		return nil
+	}
+	fmt.Printf("Transação completa, pronta para sendrawtransaction: %s\n", rawTx)
+	return nil
+}
+
+// runOpReturn lista o conteúdo das saídas OP_RETURN das transações da
+// carteira, gravado pelo scan.
+func runOpReturn(db *storage.DB) error {
+	var outputs []models.DataOutput
+	if err := db.View(func(txn storage.Txn) error {
+		var err error
+		outputs, err = storage.ListDataOutputs(txn)
+		return err
+	}); err != nil {
+		return fmt.Errorf("erro ao ler saídas OP_RETURN: %w", err)
+	}
+	for _, output := range outputs {
+		fmt.Printf("%d\t%s:%d\t%s\n", output.Height, output.TxID, output.Index, helpers.FormatDataPayload(output.Payload))
+	}
+	fmt.Printf("%d saídas OP_RETURN\n", len(outputs))
+	return nil
+}
+
+// runPSBT opera sobre arquivos PSBT (BIP174/BIP370), criados pelo envio com
+// -psbt ou pelo walletprocesspsbt do Bitcoin Core:
+//
+//	psbt decode <arquivo>                          mostra entradas, saídas, assinaturas e taxa
+//	psbt sign [-out arquivo] [-any-sighash] <arquivo>
+//	                                               acrescenta as assinaturas da carteira
+//	psbt combine -out <arquivo> <arquivo>...       junta os PSBTs de vários assinantes
+//	psbt finalize [-out arquivo] [-broadcast] <arquivo>
+//	                                               finaliza e imprime ou transmite a transação
+func runPSBT(db *storage.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("uso: psbt decode|sign|combine|finalize <arquivo>...")
+	}
+	fs := flag.NewFlagSet("psbt "+args[0], flag.ContinueOnError)
+	out := fs.String("out", "", "arquivo de saída (padrão: sobrescreve a entrada)")
+	broadcast := fs.Bool("broadcast", false, "finalize: transmite a transação com sendrawtransaction")
+	anySigHash := fs.Bool("any-sighash", false, "sign: aceita sighash diferente de SIGHASH_ALL")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if len(files) == 0 || (args[0] != "combine" && len(files) != 1) {
+		return fmt.Errorf("uso: psbt %s <arquivo>", args[0])
+	}
+
+	if args[0] == "combine" {
+		if len(files) < 2 || *out == "" {
+			return fmt.Errorf("uso: psbt combine -out <arquivo> <arquivo> <arquivo>...")
+		}
+		var packets []*psbt.Packet
+		for _, file := range files {
+			p, err := psbt.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			packets = append(packets, p)
+		}
+		combined, err := psbt.Combine(packets...)
+		if err != nil {
+			return err
+		}
+		if err := combined.WriteFile(*out); err != nil {
+			return err
+		}
+		fmt.Printf("%d PSBTs combinados em %s\n", len(packets), *out)
+		return nil
+	}
+
+	p, err := psbt.ReadFile(files[0])
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = files[0]
+	}
+
+	switch args[0] {
+	case "decode":
+		return printPSBT(p)
+
+	case "sign":
+		_, state, err := progress.LoadProgress(db)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return fmt.Errorf("nenhum progresso salvo: escaneie a carteira antes de assinar")
+		}
+		added, err := p.Sign(helpers.SigningKeys(state), *anySigHash)
+		if err != nil {
+			return err
+		}
+		if err := p.WriteFile(*out); err != nil {
+			return err
+		}
+		fmt.Printf("%d assinaturas acrescentadas; PSBT gravado em %s\n", added, *out)
+		return nil
+
+	case "finalize":
+		complete, err := p.Finalize()
+		if err != nil {
+			return err
+		}
+		if err := p.WriteFile(*out); err != nil {
+			return err
+		}
+		if !complete {
+			return fmt.Errorf("faltam assinaturas; PSBT parcialmente finalizado gravado em %s", *out)
+		}
+		tx, err := p.Extract()
+		if err != nil {
+			return err
+		}
+		rawTx := helpers.EncodeTransaction(tx)
+		if !*broadcast {
+			fmt.Printf("TxID: %s\n", helpers.TxID(tx))
+			fmt.Printf("Transação completa, pronta para sendrawtransaction: %s\n", rawTx)
+			return nil
+		}
+		// A taxa vem antes da transmissão: um envio transmitido precisa ficar
+		// registrado como pendente
+		fee, err := p.Fee()
+		if err != nil {
+			return fmt.Errorf("taxa desconhecida, transação não transmitida: %w", err)
+		}
+		txid, err := helpers.SendRawTransaction(rawTx)
+		if err != nil {
+			return fmt.Errorf("erro ao transmitir: %w", err)
+		}
+		fmt.Printf("Transação transmitida: %s\n", txid)
+		if err := progress.SavePending(db, helpers.NewPendingTx(tx, fee)); err != nil {
+			return err
+		}
+		// O troco de um envio gravado com -psbt só é reservado aqui, quando a
+		// transação completa sai para a rede
+		_, state, err := progress.LoadProgress(db)
+		if err != nil || state == nil {
+			return err
+		}
+		return markChangeUsed(db, state, tx)
+
+	default:
+		return fmt.Errorf("subcomando psbt desconhecido: %s", args[0])
+	}
+}
+
+// runBumpFee substitui um envio da carteira ainda não confirmado por outro
+// de taxa maior (BIP125):
+//
+//	bumpfee [-feerate N] [-conf-target N] [-broadcast] <txid>
+//
+// A transação vem do registro de pendentes ou, se foi transmitida por fora,
+// do mempool do nó. As duas versões ficam registradas como pendentes até o
+// scan encontrar uma delas num bloco.
+func runBumpFee(db *storage.DB, xprv string, args []string) error {
+	fs := flag.NewFlagSet("bumpfee", flag.ContinueOnError)
+	feeRate := fs.Float64("feerate", 0, "nova taxa em sat/vB (0 = estimatesmartfee, acima da taxa atual)")
+	confTarget := fs.Int("conf-target", 6, "alvo de confirmação em blocos para o estimatesmartfee")
+	maxFee := fs.Float64("maxfee", helpers.DefaultMaxFee, "taxa absoluta máxima em BTC")
+	maxFeeRate := fs.Float64("maxfeerate", helpers.DefaultMaxFeeRate, "taxa máxima em sat/vB")
+	broadcast := fs.Bool("broadcast", false, "transmite a substituição com sendrawtransaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("uso: bumpfee [-feerate N] [-broadcast] <txid>")
+	}
+	txid := fs.Arg(0)
+
+	height, state, err := progress.LoadProgress(db)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("nenhum progresso salvo: escaneie a carteira antes de substituir")
+	}
+
+	original, recorded := state.Pending[txid]
+	if !recorded {
+		rawTx, err := helpers.GetRawTransaction(txid)
+		if err != nil {
+			return fmt.Errorf("transação %s não está pendente na carteira nem no nó: %w", txid, err)
+		}
+		original.RawTx = rawTx
+	}
+	tx, err := helpers.DecodeTransaction(original.RawTx)
+	if err != nil {
+		return err
+	}
+	for replacement, pending := range state.Pending {
+		if pending.Replaces == txid {
+			return fmt.Errorf("%s já foi substituída por %s; substitua a versão mais recente", txid, replacement)
+		}
+	}
+
+	// As descendentes no mempool também saem com a substituição e entram na
+	// taxa que ela precisa cobrir
+	var replacedFees int64
+	if entry, err := helpers.GetMempoolEntry(txid); err == nil {
+		if !entry.Replaceable {
+			return fmt.Errorf("%s não sinaliza substituição (BIP125); só envios feitos com -rbf podem ser substituídos", txid)
+		}
+		replacedFees = int64(math.Round(entry.Fees.Descendant * 1e8))
+		if entry.DescendantCount > 1 {
+			fmt.Printf("%d transações descendentes serão removidas do mempool junto com a original\n", entry.DescendantCount-1)
+		}
+	} else if !helpers.SignalsRBF(tx) {
+		return fmt.Errorf("%s não sinaliza substituição (BIP125); só envios feitos com -rbf podem ser substituídos", txid)
+	} else {
+		fmt.Printf("Sem dados do mempool (%v); considerando só a taxa da original\n", err)
+	}
+
+	// Entradas extras só entre UTXOs confirmados que nenhum pendente gasta
+	pendingSpent := state.PendingSpent()
+	spendable := make(map[string]models.UTXO)
+	for key, utxo := range state.UTXOs {
+		if _, spent := pendingSpent[key]; !spent && utxo.IsMature(height) && len(utxo.WitnessScript) == 0 {
+			spendable[key] = utxo
+		}
+	}
+
+	options := helpers.SendOptions{
+		FeeRate:    *feeRate,
+		ConfTarget: *confTarget,
+		MaxFee:     *maxFee,
+		MaxFeeRate: *maxFeeRate,
+		RBF:        true,
+		Keys:       helpers.SigningKeys(state),
+	}
+	replacement, result, err := helpers.BumpFee(state, tx, replacedFees, options, spendable)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Original %s: taxa %d sat (%.3f sat/vB)\n", txid, result.OldFee, result.OldFeeRate)
+	fmt.Printf("Substituta %s: taxa %d sat (%.3f sat/vB, %d vB), troco %d sat, %d entradas acrescentadas\n",
+		helpers.TxID(replacement), result.Fee, result.FeeRate, helpers.VSize(result.Weight), result.Change, result.Added)
+
+	if result.ChangeKey != nil {
+		fmt.Printf("Troco para %s (/1/%d)\n", result.ChangeKey.Address, result.ChangeKey.Index)
+	}
+
+	rawTx := helpers.EncodeTransaction(replacement)
+	if !*broadcast {
+		fmt.Printf("Substituta pronta para sendrawtransaction (o endereço de troco só é reservado com -broadcast): %s\n", rawTx)
+		return nil
+	}
+	if _, err := helpers.SendRawTransaction(rawTx); err != nil {
+		return fmt.Errorf("erro ao transmitir: %w", err)
+	}
+
+	// Um endereço de troco novo, já em uso na substituta transmitida, não volta
+	// a ser oferecido
+	if result.ChangeKey != nil {
+		if err := reserveChangeKey(db, xprv, state); err != nil {
+			return err
+		}
+	}
+	if !recorded {
+		original = helpers.NewPendingTx(tx, result.OldFee)
+	}
+	bumped := helpers.NewPendingTx(replacement, result.Fee)
+	bumped.Replaces = txid
+	if err := progress.SavePending(db, original, bumped); err != nil {
+		return err
+	}
+	fmt.Printf("Substituta transmitida: %s\n", bumped.TxID)
+	return nil
+}
+
+// reserveChangeKey avança o índice de troco depois que uma transação com a
+// chave de troco atual foi transmitida, derivando as chaves de folga.
+func reserveChangeKey(db *storage.DB, xprv string, state *models.WalletState) error {
+	state.ChangeIndex++
+	changeKeys, err := helpers.DeriveChangeKeys(xprv, state)
+	if err == nil {
+		err = progress.SaveChangeKeys(db, changeKeys, state.ChangeIndex)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao reservar endereço de troco: %w", err)
+	}
+	return nil
+}
+
+// markChangeUsed avança o índice de troco depois de transmitir tx, se alguma
+// saída paga a uma chave de troco ainda não usada. As chaves de folga são
+// derivadas na próxima execução da carteira, sem pedir o xprv agora.
+func markChangeUsed(db *storage.DB, state *models.WalletState, tx *wire.MsgTx) error {
+	changed := false
+	for _, out := range tx.TxOut {
+		if state.MarkChangeUsed(describeScript(out.PkScript)) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := progress.SaveChangeKeys(db, nil, state.ChangeIndex); err != nil {
+		return fmt.Errorf("erro ao reservar endereço de troco: %w", err)
+	}
+	return nil
+}
+
+// runCPFP acelera uma transação não confirmada que paga à carteira gastando
+// a saída recebida numa transação filha de taxa maior (child pays for parent):
+//
+//	cpfp [-feerate N] [-conf-target N] [-broadcast] <txid:vout>
+//
+// A taxa pedida vale para o pacote: a mãe, os ancestrais dela no mempool e a
+// filha, que manda o valor para um endereço de troco da carteira.
+func runCPFP(db *storage.DB, xprv string, args []string) error {
+	fs := flag.NewFlagSet("cpfp", flag.ContinueOnError)
+	feeRate := fs.Float64("feerate", 0, "taxa do pacote em sat/vB (0 = estimatesmartfee com -conf-target)")
+	confTarget := fs.Int("conf-target", 6, "alvo de confirmação em blocos para o estimatesmartfee")
+	maxFee := fs.Float64("maxfee", helpers.DefaultMaxFee, "taxa absoluta máxima da filha em BTC")
+	maxFeeRate := fs.Float64("maxfeerate", helpers.DefaultMaxFeeRate, "taxa máxima do pacote em sat/vB")
+	broadcast := fs.Bool("broadcast", false, "transmite a filha com sendrawtransaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("uso: cpfp [-feerate N] [-broadcast] <txid:vout>")
+	}
+	parts := strings.Split(fs.Arg(0), ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("outpoint inválido, use txid:vout: %s", fs.Arg(0))
+	}
+	txid := parts[0]
+	vout, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("índice de saída inválido: %s", parts[1])
+	}
+
+	height, state, err := progress.LoadProgress(db)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("nenhum progresso salvo: escaneie a carteira antes do cpfp")
+	}
+	if _, confirmed := state.UTXOs[fs.Arg(0)]; confirmed {
+		return fmt.Errorf("%s já está confirmado", fs.Arg(0))
+	}
+	pendingSpent := state.PendingSpent()
+	if spender, spent := pendingSpent[fs.Arg(0)]; spent {
+		return fmt.Errorf("%s já é gasto pela transação pendente %s", fs.Arg(0), spender)
+	}
+
+	// Tamanho e taxa da mãe (com os ancestrais) vêm do mempool do nó
+	entry, err := helpers.GetMempoolEntry(txid)
+	if err != nil {
+		return err
+	}
+	rawTx, err := helpers.GetRawTransaction(txid)
+	if err != nil {
+		return err
+	}
+	parent, err := helpers.DecodeTransaction(rawTx)
+	if err != nil {
+		return err
+	}
+	utxo, err := helpers.UnconfirmedUTXO(state, parent, vout)
+	if err != nil {
+		return err
+	}
+
+	// Entradas extras só entre UTXOs confirmados que nenhum pendente gasta
+	spendable := make(map[string]models.UTXO)
+	for key, u := range state.UTXOs {
+		if _, spent := pendingSpent[key]; !spent && u.IsMature(height) && len(u.WitnessScript) == 0 {
+			spendable[key] = u
+		}
+	}
+
+	changeKey, err := helpers.NextChangeKey(state)
+	if err != nil {
+		return fmt.Errorf("erro ao obter endereço de troco: %w", err)
+	}
+	options := helpers.SendOptions{
+		FeeRate:    *feeRate,
+		ConfTarget: *confTarget,
+		MaxFee:     *maxFee,
+		MaxFeeRate: *maxFeeRate,
+		RBF:        true,
+		Keys:       helpers.SigningKeys(state),
+	}
+	child, result, err := helpers.CPFP(utxo, entry, changeKey.WitnessProgram, options, spendable)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mãe %s: %d sat em %d vB com os ancestrais (%.3f sat/vB)\n", txid, result.AncestorFee, result.AncestorVSize, result.AncestorFeeRate)
+	fmt.Printf("Filha %s: taxa %d sat (%.3f sat/vB, %d vB), %d sat para %s, %d entradas acrescentadas\n",
+		helpers.TxID(child), result.Fee, result.ChildFeeRate, helpers.VSize(result.Weight), result.Output, changeKey.Address, result.Added)
+	fmt.Printf("Pacote a %.3f sat/vB (alvo %.3f sat/vB)\n", result.PackageFeeRate, result.TargetFeeRate)
+
+	rawChild := helpers.EncodeTransaction(child)
+	if !*broadcast {
+		fmt.Printf("Filha pronta para sendrawtransaction (o endereço de troco só é reservado com -broadcast): %s\n", rawChild)
+		return nil
+	}
+	if _, err := helpers.SendRawTransaction(rawChild); err != nil {
+		return fmt.Errorf("erro ao transmitir: %w", err)
+	}
+
+	// O endereço de troco usado pela filha transmitida não volta a ser oferecido
+	if err := reserveChangeKey(db, xprv, state); err != nil {
+		return err
+	}
+	if err := progress.SavePending(db, helpers.NewPendingTx(child, result.Fee)); err != nil {
+		return err
+	}
+	fmt.Printf("Filha transmitida: %s\n", helpers.TxID(child))
+	return nil
+}
+
+// runPending lista os envios transmitidos que ainda não confirmaram, com as
+// substituições por taxa ao lado da versão que substituem.
+func runPending(db *storage.DB) error {
+	var pending map[string]models.PendingTx
+	if err := db.View(func(txn storage.Txn) error {
+		var err error
+		pending, err = storage.ListPending(txn)
+		return err
+	}); err != nil {
+		return fmt.Errorf("erro ao ler pendentes: %w", err)
+	}
+
+	txids := make([]string, 0, len(pending))
+	for txid := range pending {
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+	for _, txid := range txids {
+		tx := pending[txid]
+		line := fmt.Sprintf("%s\t%d sat\t%.3f sat/vB\t%d entradas", txid, tx.Fee, float64(tx.Fee)/float64(tx.VSize), len(tx.Inputs))
+		if tx.Replaces != "" {
+			line += "\tsubstitui " + tx.Replaces
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("%d transações pendentes\n", len(pending))
+	return nil
+}
+
+// printPSBT mostra as entradas com o UTXO gasto e as assinaturas, as saídas
+// com endereço e valor e a taxa, se todas as entradas tiverem UTXO.
+func printPSBT(p *psbt.Packet) error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("PSBT v%d, transação %s: %d entradas, %d saídas\n", p.Version(), helpers.TxID(tx), len(tx.TxIn), len(tx.TxOut))
+	for i, txIn := range tx.TxIn {
+		m := p.Inputs[i]
+		status := fmt.Sprintf("%d assinaturas parciais", len(m.ByType(psbt.InPartialSig)))
+		if _, ok := m.GetType(psbt.InFinalScriptWitness); ok {
+			status = "finalizada"
+		}
+		fmt.Printf("  entrada %d: %s (%s)\n", i, txIn.PreviousOutPoint, status)
+	}
+	for i, txOut := range tx.TxOut {
+		fmt.Printf("  saída %d: %s %d sat\n", i, describeScript(txOut.PkScript), txOut.Value)
+	}
+	if fee, err := p.Fee(); err == nil {
+		fmt.Printf("Taxa: %d sat\n", fee)
+	} else {
+		fmt.Printf("Taxa desconhecida: %v\n", err)
+	}
+	return nil
+}
+
+// describeScript mostra o endereço de um scriptPubKey ou o conteúdo de um OP_RETURN.
+func describeScript(script []byte) string {
+	if payload, ok := helpers.DataPayload(script); ok {
+		return "OP_RETURN " + helpers.FormatDataPayload(payload)
+	}
+	// Os parâmetros da testnet dão o prefixo tb1 usado também na signet
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, &chaincfg.TestNet3Params)
+	if err != nil || len(addresses) != 1 {
+		return fmt.Sprintf("script %x", script)
+	}
+	return addresses[0].EncodeAddress()
+}
+
+// addPrevTxs grava nas entradas do PSBT a transação anterior inteira
+// (NON_WITNESS_UTXO), do bloco em cache ou, fora dele, do nó; o Bitcoin Core
+// e o offline-sign a exigem para assinar entradas segwit v0.
+func addPrevTxs(db *storage.DB, p *psbt.Packet, prevouts []models.UTXO) {
+	for i, utxo := range prevouts {
+		var block struct {
+			Tx []struct {
+				TxID string `json:"txid"`
+				Hex  string `json:"hex"`
+			} `json:"tx"`
+		}
+		if blockData, err := db.GetBlock(utxo.Height); err == nil {
+			_ = json.Unmarshal(blockData, &block)
+		}
+		var rawTx string
+		for _, tx := range block.Tx {
+			if tx.TxID != utxo.TxID {
+				continue
+			}
+			rawTx = tx.Hex
+			break
+		}
+		if rawTx == "" {
+			var err error
+			if rawTx, err = helpers.GetRawTransaction(utxo.TxID); err != nil {
+				fmt.Printf("Entrada %d sem transação anterior, que o offline-sign exige: bloco %d fora do cache e %s fora do nó\n", i, utxo.Height, utxo.TxID)
+				continue
+			}
+		}
+		raw, err := hex.DecodeString(rawTx)
+		if err == nil {
+			err = p.SetNonWitnessUTXO(i, raw)
+		}
+		if err != nil {
+			fmt.Printf("Entrada %d sem transação anterior: %v\n", i, err)
+		}
+	}
+}
+
+// runExportWatchOnly grava a tpub da conta e o fingerprint da chave mestre
+// para o computador online, que escaneia e monta PSBTs sem a chave privada:
+//
+//	export-watchonly [-out watch-only.json]
+func runExportWatchOnly(xprv string, args []string) error {
+	fs := flag.NewFlagSet("export-watchonly", flag.ContinueOnError)
+	out := fs.String("out", "watch-only.json", "arquivo de saída")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	w, err := helpers.ExportWatchOnly(xprv)
+	if err != nil {
+		return err
+	}
+	if err := helpers.WriteWatchOnly(*out, w); err != nil {
+		return err
+	}
+	fmt.Printf("Material watch-only gravado em %s (fingerprint %s); use -watch-only %s no computador online\n", *out, w.Fingerprint, *out)
+	return nil
+}
+
+// runOfflineSign assina no computador offline um PSBT montado pelo online.
+// Usa só o xprv: as chaves saem dos caminhos BIP32 das entradas com o
+// fingerprint da carteira, sem banco nem bitcoind. Mostra as saídas, o troco
+// e a taxa e pede confirmação antes de gravar o PSBT assinado:
+//
+//	offline-sign [-out arquivo] [-yes] [-any-sighash] <arquivo>
+func runOfflineSign(xprv string, args []string) error {
+	fs := flag.NewFlagSet("offline-sign", flag.ContinueOnError)
+	out := fs.String("out", "", "arquivo do PSBT assinado (padrão: <arquivo>.signed)")
+	yes := fs.Bool("yes", false, "assina sem pedir confirmação")
+	anySigHash := fs.Bool("any-sighash", false, "aceita sighash diferente de SIGHASH_ALL, que não cobre todas as saídas")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("uso: offline-sign [-out arquivo] [-yes] [-any-sighash] <arquivo>")
+	}
+	if *out == "" {
+		*out = fs.Arg(0) + ".signed"
+	}
+
+	p, err := psbt.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	fingerprint, err := helpers.MasterFingerprint(xprv)
+	if err != nil {
+		return err
+	}
+
+	// Chaves das entradas, conferindo que o caminho leva à chave pública do PSBT.
+	// O sighash do segwit v0 só cobre o valor da própria entrada: sem a
+	// transação anterior, um PSBT adulterado pode mentir os valores e esconder
+	// a taxa real. Entradas desta carteira precisam do NON_WITNESS_UTXO, que
+	// o PSBT confere contra o WITNESS_UTXO
+	keys := make(map[string][]byte)
+	for i, m := range p.Inputs {
+		for _, d := range m.Derivations(psbt.InBIP32Derivation) {
+			if d.Fingerprint != fingerprint {
+				continue
+			}
+			if _, ok := m.GetType(psbt.InNonWitnessUTXO); !ok {
+				return fmt.Errorf("entrada %d sem NON_WITNESS_UTXO: o valor gasto não pode ser conferido offline", i)
+			}
+			privKey, pubKey, err := helpers.DerivePath(xprv, d.Path)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(pubKey, d.PubKey) {
+				return fmt.Errorf("entrada %d: a chave %x não é a do caminho informado", i, d.PubKey)
+			}
+			keys[hex.EncodeToString(pubKey)] = privKey
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("nenhuma entrada do PSBT tem origem BIP32 desta carteira (fingerprint %x)", fingerprint)
+	}
+
+	// Saídas que voltam para a carteira: a origem precisa gerar o próprio script
+	var external, change int64
+	fmt.Printf("Transação %s: %d entradas, %d saídas\n", helpers.TxID(tx), len(tx.TxIn), len(tx.TxOut))
+	for i, txOut := range tx.TxOut {
+		label := ""
+		for _, d := range p.Outputs[i].Derivations(psbt.OutBIP32Derivation) {
+			if d.Fingerprint != fingerprint {
+				continue
+			}
+			_, pubKey, err := helpers.DerivePath(xprv, d.Path)
+			if err != nil {
+				return err
+			}
+			program, err := helpers.GetP2WPKHProgram(pubKey, 0)
+			if err == nil && bytes.Equal(pubKey, d.PubKey) && bytes.Equal(program, txOut.PkScript) {
+				label = " (troco desta carteira)"
+			}
+		}
+		if label == "" {
+			external += txOut.Value
+		} else {
+			change += txOut.Value
+		}
+		fmt.Printf("  saída %d: %s %d sat%s\n", i, describeScript(txOut.PkScript), txOut.Value, label)
+	}
+	fmt.Printf("Enviado para fora: %d sat; troco: %d sat\n", external, change)
+
+	added, err := p.Sign(keys, *anySigHash)
+	if err != nil {
+		return err
+	}
+
+	fee, err := p.Fee()
+	if err != nil {
+		fmt.Printf("ATENÇÃO: taxa desconhecida (%v)\n", err)
+	} else {
+		// O peso só é conhecido com todas as assinaturas; finaliza uma cópia
+		rate := ""
+		if final, err := psbt.DecodeBase64(p.Base64()); err == nil {
+			if complete, err := final.Finalize(); err == nil && complete {
+				if signed, err := final.Extract(); err == nil {
+					vsize := helpers.VSize(helpers.TxWeight(signed))
+					rate = fmt.Sprintf(" (%d vB, %.2f sat/vB)", vsize, float64(fee)/float64(vsize))
+				}
+			}
+		}
+		fmt.Printf("Taxa: %d sat%s\n", fee, rate)
+	}
+
+	if !*yes {
+		fmt.Printf("Assinar %d entradas com %d assinaturas? [s/N] ", len(tx.TxIn), added)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "s" && answer != "sim" {
+			return fmt.Errorf("assinatura cancelada")
+		}
+	}
+	if err := p.WriteFile(*out); err != nil {
+		return err
+	}
+	fmt.Printf("%d assinaturas; PSBT assinado gravado em %s (finalize no computador online com psbt finalize -broadcast)\n", added, *out)
+	return nil
+}
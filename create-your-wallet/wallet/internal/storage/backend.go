@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound é retornado por Txn.Get quando a chave não existe.
+var ErrNotFound = errors.New("chave não encontrada")
+
+// Tipos de backend suportados por Open
+const (
+	BackendBadger = "badger"
+	BackendMemory = "memory"
+)
+
+// Txn é uma transação sobre o armazenamento chave/valor. Leituras enxergam as
+// escritas feitas na própria transação.
+type Txn interface {
+	// Get retorna uma cópia do valor da chave ou ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Iterate chama fn em ordem de chave para cada entrada com o prefixo.
+	// key e value podem ser retidos por fn.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	// IterateKeys é como Iterate, mas sem ler os valores.
+	IterateKeys(prefix []byte, fn func(key []byte) error) error
+}
+
+// Backend é o armazenamento por trás de DB. Blocos, progresso, UTXOs, chaves,
+// ledger e metadados são todos gravados através dele, então qualquer
+// implementação com transações atômicas e iteração ordenada serve.
+type Backend interface {
+	// View executa fn numa transação somente leitura.
+	View(fn func(txn Txn) error) error
+	// Update executa fn numa transação de escrita, aplicada apenas se fn não falhar.
+	Update(fn func(txn Txn) error) error
+	// Compact recupera espaço em disco, quando o backend suportar.
+	Compact() error
+	Close() error
+}
+
+// Open abre um DB com o backend informado. path é ignorado pelo backend em memória.
+func Open(backend, path string) (*DB, error) {
+	switch backend {
+	case BackendBadger:
+		return Setup(path)
+	case BackendMemory:
+		return NewMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("backend de armazenamento desconhecido: %s", backend)
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"wallet/pkg/models"
+)
+
+// forEachBackend roda o teste contra o Badger, num diretório temporário, e
+// contra o backend em memória: os dois precisam se comportar igual.
+func forEachBackend(t *testing.T, test func(t *testing.T, db *DB)) {
+	t.Run(BackendBadger, func(t *testing.T) {
+		db, err := Open(BackendBadger, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		test(t, db)
+	})
+	t.Run(BackendMemory, func(t *testing.T) {
+		db, err := Open(BackendMemory, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		test(t, db)
+	})
+}
+
+func TestBackendGetSetDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		err := db.View(func(txn Txn) error {
+			_, err := txn.Get([]byte("a/1"))
+			return err
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get de chave ausente: %v, esperava ErrNotFound", err)
+		}
+
+		if err := db.Update(func(txn Txn) error { return txn.Set([]byte("a/1"), []byte("um")) }); err != nil {
+			t.Fatal(err)
+		}
+		var value []byte
+		if err := db.View(func(txn Txn) error {
+			var err error
+			value, err = txn.Get([]byte("a/1"))
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != "um" {
+			t.Fatalf("valor %q, esperava \"um\"", value)
+		}
+
+		// O valor retornado é uma cópia
+		value[0] = 'X'
+		_ = db.View(func(txn Txn) error {
+			value, _ = txn.Get([]byte("a/1"))
+			return nil
+		})
+		if string(value) != "um" {
+			t.Fatalf("valor alterado por fora da transação: %q", value)
+		}
+
+		if err := db.Update(func(txn Txn) error { return txn.Delete([]byte("a/1")) }); err != nil {
+			t.Fatal(err)
+		}
+		err = db.View(func(txn Txn) error {
+			_, err := txn.Get([]byte("a/1"))
+			return err
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get depois do Delete: %v, esperava ErrNotFound", err)
+		}
+	})
+}
+
+func TestBackendViewIsReadOnly(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		if err := db.View(func(txn Txn) error { return txn.Set([]byte("a/1"), []byte("x")) }); err == nil {
+			t.Fatal("Set numa transação de leitura não falhou")
+		}
+	})
+}
+
+func TestBackendUpdateIsAtomic(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		failure := errors.New("falha proposital")
+		err := db.Update(func(txn Txn) error {
+			if err := txn.Set([]byte("a/1"), []byte("x")); err != nil {
+				return err
+			}
+			// As escritas da própria transação já são visíveis
+			if _, err := txn.Get([]byte("a/1")); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Update retornou %v, esperava o erro de fn", err)
+		}
+		err = db.View(func(txn Txn) error {
+			_, err := txn.Get([]byte("a/1"))
+			return err
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("escrita de Update que falhou foi aplicada: %v", err)
+		}
+	})
+}
+
+func TestBackendIterate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		if err := db.Update(func(txn Txn) error {
+			for _, key := range []string{"b/2", "a/3", "b/1", "a/1", "c/1"} {
+				if err := txn.Set([]byte(key), []byte("v"+key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Dentro da transação, a iteração junta o que foi gravado com as
+		// escritas e remoções ainda pendentes
+		var keys, values []string
+		if err := db.Update(func(txn Txn) error {
+			if err := txn.Set([]byte("b/0"), []byte("vb/0")); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte("b/1")); err != nil {
+				return err
+			}
+			return txn.Iterate([]byte("b/"), func(key, value []byte) error {
+				keys = append(keys, string(key))
+				values = append(values, string(value))
+				return nil
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"b/0", "b/2"}; !reflect.DeepEqual(keys, want) {
+			t.Fatalf("chaves %v, esperava %v", keys, want)
+		}
+		if want := []string{"vb/0", "vb/2"}; !reflect.DeepEqual(values, want) {
+			t.Fatalf("valores %v, esperava %v", values, want)
+		}
+
+		keys = nil
+		if err := db.View(func(txn Txn) error {
+			return txn.IterateKeys([]byte("a/"), func(key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a/1", "a/3"}; !reflect.DeepEqual(keys, want) {
+			t.Fatalf("chaves %v, esperava %v", keys, want)
+		}
+	})
+}
+
+func TestBackendSchemaRecords(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		var version int
+		if err := db.View(func(txn Txn) error {
+			_, err := GetMeta(txn, MetaSchemaVersion, &version)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if version != CurrentSchemaVersion {
+			t.Fatalf("versão do esquema %d, esperava %d", version, CurrentSchemaVersion)
+		}
+
+		pending := models.PendingTx{TxID: "aa", RawTx: "00", Inputs: []string{"bb:0"}, Fee: 141, VSize: 141}
+		if err := db.Update(func(txn Txn) error { return PutPending(txn, pending) }); err != nil {
+			t.Fatal(err)
+		}
+		var listed map[string]models.PendingTx
+		if err := db.View(func(txn Txn) error {
+			var err error
+			listed, err = ListPending(txn)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(listed, map[string]models.PendingTx{"aa": pending}) {
+			t.Fatalf("pendentes %v", listed)
+		}
+		if err := db.Update(func(txn Txn) error { return DeletePending(txn, "aa") }); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
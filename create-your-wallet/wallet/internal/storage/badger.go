@@ -0,0 +1,101 @@
+package storage
+
+import (
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+type badgerBackend struct {
+	db *badger.DB
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+// Setup inicializa o BadgerDB, migra o formato se necessário e retorna uma instância de DB
+func Setup(path string) (*DB, error) {
+	opts := badger.DefaultOptions(path)
+	opts.Logger = nil
+	badgerDB, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{backend: &badgerBackend{db: badgerDB}}
+	if err := db.migrate(); err != nil {
+		badgerDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (b *badgerBackend) View(fn func(txn Txn) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (b *badgerBackend) Update(fn func(txn Txn) error) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (b *badgerBackend) Compact() error {
+	err := b.db.RunValueLogGC(0.7)
+	if err == badger.ErrNoRewrite {
+		return nil // Nada a compactar
+	}
+	return err
+}
+
+func (b *badgerBackend) Close() error {
+	return b.db.Close()
+}
+
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t *badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t *badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	it := t.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := fn(item.KeyCopy(nil), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *badgerTxn) IterateKeys(prefix []byte, fn func(key []byte) error) error {
+	it := t.txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := fn(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
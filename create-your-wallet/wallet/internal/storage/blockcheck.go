@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wallet/pkg/helpers"
+)
+
+// Tipos de problema encontrados no cache de blocos
+const (
+	BlockGap     = "lacuna"        // Bloco processado que deveria estar em cache e não está
+	BlockCorrupt = "ilegível"      // JSON inválido ou campos obrigatórios ausentes
+	BlockHeight  = "altura"        // Campo "height" diferente da altura da chave
+	BlockLink    = "encadeamento"  // "previousblockhash" não aponta para o bloco anterior em cache
+	BlockMerkle  = "merkle"        // "merkleroot" não confere com os txids
+	BlockStale   = "desatualizado" // Hash diferente do bloco na cadeia atual do nó
+)
+
+// BlockIssue é um problema num bloco do cache.
+type BlockIssue struct {
+	Height int
+	Kind   string
+	Detail string
+}
+
+func (i BlockIssue) String() string {
+	return fmt.Sprintf("bloco %d: %s: %s", i.Height, i.Kind, i.Detail)
+}
+
+// CheckBlock confere a consistência interna de um bloco do getblock: a altura
+// e a raiz de merkle recalculada a partir dos txids. Não consulta o nó.
+func CheckBlock(block map[string]interface{}, height int) *BlockIssue {
+	blockHeight, ok := block["height"].(float64)
+	if !ok {
+		return &BlockIssue{Height: height, Kind: BlockCorrupt, Detail: "sem campo height"}
+	}
+	if int(blockHeight) != height {
+		return &BlockIssue{Height: height, Kind: BlockHeight, Detail: fmt.Sprintf("contém a altura %d", int(blockHeight))}
+	}
+
+	merkleRoot, ok := block["merkleroot"].(string)
+	if !ok {
+		return &BlockIssue{Height: height, Kind: BlockCorrupt, Detail: "sem campo merkleroot"}
+	}
+	txids, err := helpers.BlockTxIDs(block)
+	if err != nil {
+		return &BlockIssue{Height: height, Kind: BlockCorrupt, Detail: err.Error()}
+	}
+	computed, err := helpers.MerkleRoot(txids)
+	if err != nil {
+		return &BlockIssue{Height: height, Kind: BlockCorrupt, Detail: err.Error()}
+	}
+	if computed != merkleRoot {
+		return &BlockIssue{Height: height, Kind: BlockMerkle, Detail: fmt.Sprintf("merkleroot %s, calculada %s", merkleRoot, computed)}
+	}
+	return nil
+}
+
+// VerifyBlocks percorre o cache de blocos e retorna os problemas encontrados:
+// lacunas até o progresso salvo, blocos ilegíveis, altura trocada, raiz de
+// merkle que não confere e quebra no encadeamento entre blocos consecutivos.
+// Lacunas que a política de retenção explica (blocos podados) não são
+// problemas. Com checkNode, o hash de cada bloco também é comparado com o
+// getblockhash do nó, o que revela blocos de uma cadeia abandonada.
+func (db *DB) VerifyBlocks(policy RetentionPolicy, checkNode bool) ([]BlockIssue, error) {
+	var issues []BlockIssue
+	err := db.View(func(txn Txn) error {
+		progress := 0
+		if _, err := GetMeta(txn, MetaProgress, &progress); err != nil {
+			return err
+		}
+
+		// Blocos que a retenção manteria devem estar no cache
+		cached := make(map[int]bool)
+		heights, err := listBlockHeights(txn)
+		if err != nil {
+			return err
+		}
+		for _, height := range heights {
+			cached[height] = true
+		}
+		for height := 1; height <= progress; height++ {
+			if cached[height] {
+				continue
+			}
+			expected, err := retained(txn, policy, height, progress)
+			if err != nil {
+				return err
+			}
+			if expected {
+				issues = append(issues, BlockIssue{Height: height, Kind: BlockGap, Detail: "ausente do cache"})
+			}
+		}
+
+		prevHeight, prevHash := -1, ""
+		return txn.Iterate([]byte(PrefixBlock), func(key, value []byte) error {
+			height, err := strconv.Atoi(strings.TrimPrefix(string(key), PrefixBlock))
+			if err != nil {
+				return fmt.Errorf("chave de bloco inválida %s: %w", key, err)
+			}
+
+			var block map[string]interface{}
+			if err := json.Unmarshal(value, &block); err != nil {
+				issues = append(issues, BlockIssue{Height: height, Kind: BlockCorrupt, Detail: err.Error()})
+				prevHeight = -1
+				return nil
+			}
+			if issue := CheckBlock(block, height); issue != nil {
+				issues = append(issues, *issue)
+			}
+
+			hash, _ := block["hash"].(string)
+			previous, _ := block["previousblockhash"].(string)
+			if prevHeight == height-1 && prevHash != "" && previous != prevHash {
+				issues = append(issues, BlockIssue{Height: height, Kind: BlockLink,
+					Detail: fmt.Sprintf("previousblockhash %s, bloco %d em cache tem hash %s", previous, prevHeight, prevHash)})
+			}
+			prevHeight, prevHash = height, hash
+
+			if checkNode {
+				nodeHash, err := getBlockHash(height)
+				if err != nil {
+					return fmt.Errorf("erro ao consultar o nó no bloco %d: %w", height, err)
+				}
+				if nodeHash != hash {
+					issues = append(issues, BlockIssue{Height: height, Kind: BlockStale,
+						Detail: fmt.Sprintf("hash em cache %s, nó tem %s", hash, nodeHash)})
+				}
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Height < issues[j].Height })
+	return issues, err
+}
+
+// retained diz se a política de retenção mantém o bloco height depois de
+// processar até progress.
+func retained(txn Txn, policy RetentionPolicy, height, progress int) (bool, error) {
+	switch policy.Mode {
+	case RetainLast:
+		return height > progress-policy.Keep, nil
+	case RetainActivity:
+		_, err := txn.Get(indexKey(height))
+		if err == ErrNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return true, nil
+	}
+}
+
+// RepairBlocks corrige os problemas encontrados por VerifyBlocks: remove do
+// cache os blocos inválidos ou desatualizados (nos dois lados de uma quebra de
+// encadeamento, já que não dá para saber qual está errado) e, com refetch,
+// busca de novo no nó esses blocos e as lacunas. Retorna a menor altura
+// corrigida que já tinha sido aplicada ao estado da carteira, ou 0 se
+// nenhuma; a partir dela é preciso um rescan.
+func (db *DB) RepairBlocks(issues []BlockIssue, refetch bool) (int, error) {
+	progress := 0
+	if err := db.View(func(txn Txn) error {
+		_, err := GetMeta(txn, MetaProgress, &progress)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	repair := make(map[int]bool)
+	for _, issue := range issues {
+		repair[issue.Height] = true
+		if issue.Kind == BlockLink {
+			repair[issue.Height-1] = true
+		}
+	}
+
+	heights := make([]int, 0, len(repair))
+	for height := range repair {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+
+	rescanFrom := 0
+	for _, height := range heights {
+		if err := db.Update(func(txn Txn) error {
+			return txn.Delete(blockKey(height))
+		}); err != nil {
+			return 0, fmt.Errorf("erro ao remover bloco %d: %w", height, err)
+		}
+		if refetch {
+			if _, err := FetchAndStoreBlock(db, height); err != nil {
+				return 0, err
+			}
+		}
+		if height <= progress && rescanFrom == 0 {
+			rescanFrom = height
+		}
+	}
+	return rescanFrom, nil
+}
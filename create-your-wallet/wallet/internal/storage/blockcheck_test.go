@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"wallet/pkg/helpers"
+)
+
+// testChainBlock é o JSON de getblock, com os campos que VerifyBlocks confere,
+// do bloco height de uma cadeia de teste consistente.
+func testChainBlock(t *testing.T, height int) map[string]interface{} {
+	t.Helper()
+	var txids []string
+	var tx []interface{}
+	for i := 0; i < 3; i++ {
+		txid := fmt.Sprintf("%064x", height*10+i)
+		txids = append(txids, txid)
+		tx = append(tx, txid)
+	}
+	root, err := helpers.MerkleRoot(txids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"height":            height,
+		"hash":              fmt.Sprintf("%064x", 1000+height),
+		"previousblockhash": fmt.Sprintf("%064x", 1000+height-1),
+		"merkleroot":        root,
+		"tx":                tx,
+	}
+}
+
+func storeTestBlock(t *testing.T, db *DB, height int, block map[string]interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StoreBlock(height, raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	const progress = 5
+	all := RetentionPolicy{Mode: RetainAll}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		change func(t *testing.T, db *DB) // Estraga o cache consistente
+		want   []BlockIssue               // Só Height e Kind são comparados
+	}{
+		{"cache consistente", all, func(t *testing.T, db *DB) {}, nil},
+		{"lacuna", all, func(t *testing.T, db *DB) {
+			if err := db.Update(func(txn Txn) error { return txn.Delete(blockKey(3)) }); err != nil {
+				t.Fatal(err)
+			}
+		}, []BlockIssue{{Height: 3, Kind: BlockGap}}},
+		{"lacuna explicada pela retenção", RetentionPolicy{Mode: RetainLast, Keep: 3}, func(t *testing.T, db *DB) {
+			if err := db.Update(func(txn Txn) error { return txn.Delete(blockKey(1)) }); err != nil {
+				t.Fatal(err)
+			}
+		}, nil},
+		{"encadeamento quebrado", all, func(t *testing.T, db *DB) {
+			block := testChainBlock(t, 4)
+			block["previousblockhash"] = fmt.Sprintf("%064x", 9999)
+			storeTestBlock(t, db, 4, block)
+		}, []BlockIssue{{Height: 4, Kind: BlockLink}}},
+		{"merkleroot que não confere", all, func(t *testing.T, db *DB) {
+			block := testChainBlock(t, 2)
+			block["tx"] = block["tx"].([]interface{})[:2]
+			storeTestBlock(t, db, 2, block)
+		}, []BlockIssue{{Height: 2, Kind: BlockMerkle}}},
+		{"altura trocada", all, func(t *testing.T, db *DB) {
+			block := testChainBlock(t, 2)
+			block["height"] = 7
+			storeTestBlock(t, db, 2, block)
+		}, []BlockIssue{{Height: 2, Kind: BlockHeight}}},
+		{"JSON inválido", all, func(t *testing.T, db *DB) {
+			if err := db.StoreBlock(5, []byte("{")); err != nil {
+				t.Fatal(err)
+			}
+		}, []BlockIssue{{Height: 5, Kind: BlockCorrupt}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, db *DB) {
+				for height := 1; height <= progress; height++ {
+					storeTestBlock(t, db, height, testChainBlock(t, height))
+				}
+				if err := db.Update(func(txn Txn) error { return PutMeta(txn, MetaProgress, progress) }); err != nil {
+					t.Fatal(err)
+				}
+				tc.change(t, db)
+
+				issues, err := db.VerifyBlocks(tc.policy, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []BlockIssue
+				for _, issue := range issues {
+					got = append(got, BlockIssue{Height: issue.Height, Kind: issue.Kind})
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Fatalf("problemas %v, esperava %v", issues, tc.want)
+				}
+			})
+		})
+	}
+}
@@ -1,92 +1,91 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
-
-	badger "github.com/dgraph-io/badger/v4"
 )
 
-// ClearBlocks remove todas as chaves relacionadas a blocos ("block-").
-func (db *DB) ClearBlocks() error {
-	return db.Update(func(txn *badger.Txn) error {
-		prefix := []byte("block-")
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
+// keysPerDeleteTxn limita quantas chaves são removidas por transação, para
+// não estourar o tamanho máximo de transação do Badger com caches grandes.
+const keysPerDeleteTxn = 10000
 
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			if err := txn.Delete(it.Item().Key()); err != nil {
-				return fmt.Errorf("erro ao remover bloco: %w", err)
-			}
-		}
-		return nil
-	})
+// ClearPrefix remove todas as chaves com o prefixo em transações de até
+// keysPerDeleteTxn chaves. A remoção não é atômica: se for interrompida, parte
+// das chaves fica e basta repeti-la.
+func (db *DB) ClearPrefix(prefix string) error {
+	return db.clearKeys(prefix, nil)
 }
 
-// ClearWalletHashes remove todas as chaves relacionadas a hashes de carteiras ("found-wallet-").
-func (db *DB) ClearWalletHashes() error {
-	return db.Update(func(txn *badger.Txn) error {
-		prefix := []byte("found-wallet-")
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			key := it.Item().Key()
-			fmt.Printf("Removendo chave: %s\n", key) // Log para depuração
-			if err := txn.Delete(key); err != nil {
-				return fmt.Errorf("erro ao remover chave %s: %w", key, err)
+// clearKeys remove em lotes as chaves com o prefixo, exceto as que keep mantém.
+func (db *DB) clearKeys(prefix string, keep func(key []byte) bool) error {
+	for {
+		var keys [][]byte
+		err := db.Update(func(txn Txn) error {
+			keys = nil
+			if err := txn.IterateKeys([]byte(prefix), func(key []byte) error {
+				if keep != nil && keep(key) {
+					return nil
+				}
+				keys = append(keys, key)
+				if len(keys) == keysPerDeleteTxn {
+					return errStopIteration
+				}
+				return nil
+			}); err != nil && err != errStopIteration {
+				return err
 			}
-		}
-		return nil
-	})
-}
-
-// ClearProcessedBlocks remove todas as chaves relacionadas a blocos processados ("processed-block-").
-func (db *DB) ClearProcessedBlocks() error {
-	return db.Update(func(txn *badger.Txn) error {
-		prefix := []byte("processed-block-")
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			key := it.Item().Key()
-			fmt.Printf("Removendo chave: %s\n", key) // Log para depuração
-			if err := txn.Delete(key); err != nil {
-				return fmt.Errorf("erro ao remover chave %s: %w", key, err)
+			for _, key := range keys {
+				if err := txn.Delete(key); err != nil {
+					return fmt.Errorf("erro ao remover chave %s: %w", key, err)
+				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		return nil
-	})
+		if len(keys) < keysPerDeleteTxn {
+			return nil
+		}
+	}
 }
 
-// ClearHashes remove todas as chaves relacionadas a hashes de blocos ("hash-").
-func (db *DB) ClearHashes() error {
-	return db.Update(func(txn *badger.Txn) error {
-		prefix := []byte("hash-")
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
+// ClearBlocks remove todos os blocos em cache ("block/").
+func (db *DB) ClearBlocks() error {
+	return db.ClearPrefix(PrefixBlock)
+}
 
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			key := it.Item().Key()
-			fmt.Printf("Removendo chave: %s\n", key) // Log para depuração
-			if err := txn.Delete(key); err != nil {
-				return fmt.Errorf("erro ao remover chave %s: %w", key, err)
+// ClearProgress descarta o estado escaneado (progresso, UTXOs, ledger com as
+// provas SPV e as saídas OP_RETURN, índice de blocos, cadeia de cabeçalhos e falhas de busca), mantendo as chaves derivadas e o cache de blocos. O próximo scan
+// recomeça do bloco 1.
+func (db *DB) ClearProgress() error {
+	// O progresso sai primeiro: se a limpeza em lotes for interrompida, o
+	// próximo scan já recomeça do bloco 1 e regrava o que sobrou
+	if err := db.Update(func(txn Txn) error {
+		for _, name := range []string{MetaProgress, MetaFetchErrors} {
+			if err := txn.Delete(metaKey(name)); err != nil && err != ErrNotFound {
+				return err
 			}
 		}
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	for _, prefix := range []string{PrefixUTXO, PrefixLedger, PrefixIndex, PrefixHeader, PrefixProof, PrefixData} {
+		if err := db.ClearPrefix(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// ClearAll limpa todas as chaves do banco de dados.
+// ClearAll limpa todas as chaves do banco de dados, mantendo apenas a versão do formato.
 func (db *DB) ClearAll() error {
-	return db.Update(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			if err := txn.Delete(it.Item().Key()); err != nil {
-				return fmt.Errorf("erro ao limpar chave: %w", err)
-			}
-		}
-		return nil
+	schemaKey := metaKey(MetaSchemaVersion)
+	if err := db.clearKeys("", func(key []byte) bool { return bytes.Equal(key, schemaKey) }); err != nil {
+		return err
+	}
+	return db.Update(func(txn Txn) error {
+		return PutMeta(txn, MetaSchemaVersion, CurrentSchemaVersion)
 	})
 }
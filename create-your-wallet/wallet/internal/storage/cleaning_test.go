@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"testing"
+)
+
+// seedBlocks grava n blocos vazios em cache, em lotes.
+func seedBlocks(t *testing.T, db *DB, n int) {
+	t.Helper()
+	for start := 1; start <= n; start += keysPerDeleteTxn / 2 {
+		if err := db.Update(func(txn Txn) error {
+			for height := start; height < start+keysPerDeleteTxn/2 && height <= n; height++ {
+				if err := txn.Set(blockKey(height), []byte("{}")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClearBlocksInBatches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		n := 2*keysPerDeleteTxn + 5
+		seedBlocks(t, db, n)
+		if err := db.Update(func(txn Txn) error { return PutMeta(txn, MetaProgress, n) }); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.ClearBlocks(); err != nil {
+			t.Fatal(err)
+		}
+		heights, err := db.BlockHeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heights) != 0 {
+			t.Fatalf("%d blocos ficaram depois do ClearBlocks", len(heights))
+		}
+
+		seedBlocks(t, db, n)
+		if err := db.ClearAll(); err != nil {
+			t.Fatal(err)
+		}
+		var keys int
+		var version int
+		if err := db.View(func(txn Txn) error {
+			if err := txn.IterateKeys(nil, func(key []byte) error {
+				keys++
+				return nil
+			}); err != nil {
+				return err
+			}
+			_, err := GetMeta(txn, MetaSchemaVersion, &version)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if keys != 1 || version != CurrentSchemaVersion {
+			t.Fatalf("%d chaves e versão %d depois do ClearAll", keys, version)
+		}
+	})
+}
+
+func TestPruneBlocksInBatches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		n := 2*keysPerDeleteTxn + 5
+		seedBlocks(t, db, n)
+
+		// Só os 10 últimos até a altura processada ficam; acima dela, todos
+		processed := n - 100
+		removed, err := db.PruneBlocks(RetentionPolicy{Mode: RetainLast, Keep: 10}, processed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != processed-10 {
+			t.Fatalf("%d blocos removidos, esperava %d", removed, processed-10)
+		}
+		heights, err := db.BlockHeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heights) != 110 || heights[0] != processed-9 {
+			t.Fatalf("%d blocos a partir de %d depois do prune", len(heights), heights[0])
+		}
+	})
+}
@@ -6,15 +6,20 @@ import (
 	"wallet/pkg/helpers"
 )
 
+// FetchAndStoreBlock retorna o bloco do cache ou, se ele não estiver lá ou
+// não passar em CheckBlock, busca no nó e grava no cache.
 func FetchAndStoreBlock(db *DB, blockHeight int) (map[string]interface{}, error) {
 	// Verifique se o bloco já está no banco
 	blockData, err := db.GetBlock(blockHeight)
 	if err == nil {
 		var block map[string]interface{}
 		if err := json.Unmarshal(blockData, &block); err != nil {
-			return nil, fmt.Errorf("erro ao deserializar bloco: %v", err)
+			fmt.Printf("Bloco %d em cache ilegível, buscando de novo: %v\n", blockHeight, err)
+		} else if issue := CheckBlock(block, blockHeight); issue != nil {
+			fmt.Printf("Bloco em cache descartado (%s), buscando de novo\n", issue)
+		} else {
+			return block, nil
 		}
-		return block, nil
 	}
 
 	blockHash, err := getBlockHash(blockHeight)
@@ -32,6 +37,10 @@ func FetchAndStoreBlock(db *DB, blockHeight int) (map[string]interface{}, error)
 		return nil, fmt.Errorf("resultado inesperado do bloco: %v", blockResult)
 	}
 
+	if issue := CheckBlock(block, blockHeight); issue != nil {
+		return nil, fmt.Errorf("bloco recebido do nó inválido: %s", issue)
+	}
+
 	blockData, err = json.Marshal(block)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao serializar bloco: %v", err)
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"wallet/pkg/models"
+)
+
+// PrefixStats conta as chaves e o tamanho dos valores de um prefixo.
+type PrefixStats struct {
+	Prefix string
+	Keys   int
+	Bytes  int64
+}
+
+// Stats resume o conteúdo do banco.
+type Stats struct {
+	SchemaVersion int
+	Progress      int
+	HasProgress   bool
+	FirstBlock    int // Menor altura em cache (0 se o cache estiver vazio)
+	LastBlock     int // Maior altura em cache
+	Prefixes      []PrefixStats
+}
+
+// knownPrefixes são os prefixos reportados separadamente por Stats; o resto
+// entra como "outros".
+var knownPrefixes = []string{PrefixBlock, PrefixUTXO, PrefixKey, PrefixLedger, PrefixIndex, PrefixHeader, PrefixProof, PrefixData, PrefixLabel, PrefixMultisig, PrefixPending, PrefixMeta}
+
+// Stats percorre o banco e conta chaves e bytes por prefixo.
+func (db *DB) Stats() (*Stats, error) {
+	stats := &Stats{}
+	byPrefix := make(map[string]*PrefixStats)
+	for _, prefix := range append(knownPrefixes, "") {
+		byPrefix[prefix] = &PrefixStats{Prefix: prefix}
+	}
+
+	err := db.View(func(txn Txn) error {
+		if _, err := GetMeta(txn, MetaSchemaVersion, &stats.SchemaVersion); err != nil {
+			return err
+		}
+		found, err := GetMeta(txn, MetaProgress, &stats.Progress)
+		if err != nil {
+			return err
+		}
+		stats.HasProgress = found
+
+		heights, err := listBlockHeights(txn)
+		if err != nil {
+			return err
+		}
+		if len(heights) > 0 {
+			stats.FirstBlock = heights[0]
+			stats.LastBlock = heights[len(heights)-1]
+		}
+
+		return txn.Iterate(nil, func(key, value []byte) error {
+			prefix := ""
+			for _, p := range knownPrefixes {
+				if strings.HasPrefix(string(key), p) {
+					prefix = p
+					break
+				}
+			}
+			byPrefix[prefix].Keys++
+			byPrefix[prefix].Bytes += int64(len(key) + len(value))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, prefix := range append(knownPrefixes, "") {
+		stats.Prefixes = append(stats.Prefixes, *byPrefix[prefix])
+	}
+	return stats, nil
+}
+
+// Verify confere a consistência interna do banco e retorna a lista de problemas
+// encontrados. Um erro só é retornado se o banco não puder ser lido.
+func (db *DB) Verify() ([]string, error) {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	err := db.View(func(txn Txn) error {
+		version := 0
+		if _, err := GetMeta(txn, MetaSchemaVersion, &version); err != nil {
+			return err
+		}
+		if version != CurrentSchemaVersion {
+			report("versão do formato v%d, esperada v%d", version, CurrentSchemaVersion)
+		}
+
+		progress := 0
+		hasProgress, err := GetMeta(txn, MetaProgress, &progress)
+		if err != nil {
+			return err
+		}
+
+		// Chaves derivadas: índices contínuos a partir de 0 em cada branch
+		keys, err := ListDerivedKeys(txn, models.BranchReceive)
+		if err != nil {
+			report("chaves derivadas ilegíveis: %v", err)
+		}
+		changeKeys, err := ListDerivedKeys(txn, models.BranchChange)
+		if err != nil {
+			report("chaves de troco ilegíveis: %v", err)
+		}
+		addresses := make(map[string]bool, len(keys)+len(changeKeys))
+		for i, key := range keys {
+			if key.Index != i {
+				report("chave derivada fora de ordem: posição %d tem índice %d", i, key.Index)
+			}
+			addresses[key.Address] = true
+		}
+		for i, key := range changeKeys {
+			if key.Index != i {
+				report("chave de troco fora de ordem: posição %d tem índice %d", i, key.Index)
+			}
+			addresses[key.Address] = true
+		}
+		multisigs, err := ListMultisigs(txn)
+		if err != nil {
+			report("multisigs ilegíveis: %v", err)
+		}
+		for _, ms := range multisigs {
+			addresses[ms.Address] = true
+		}
+		changeIndex := 0
+		if _, err := GetMeta(txn, MetaChangeIndex, &changeIndex); err != nil {
+			return err
+		}
+		if changeIndex > len(changeKeys) {
+			report("próximo índice de troco %d além das %d chaves de troco derivadas", changeIndex, len(changeKeys))
+		}
+		if hasProgress && len(keys) == 0 {
+			report("há progresso salvo (bloco %d) mas nenhuma chave derivada", progress)
+		}
+
+		// UTXOs: pertencem à carteira e não estão acima do progresso
+		utxos, err := ListUTXOs(txn)
+		if err != nil {
+			report("UTXOs ilegíveis: %v", err)
+		}
+		for outpoint, utxo := range utxos {
+			if fmt.Sprintf("%s:%d", utxo.TxID, utxo.VoutIndex) != outpoint {
+				report("UTXO %s gravado com outpoint %s:%d", outpoint, utxo.TxID, utxo.VoutIndex)
+			}
+			if len(keys) > 0 && !addresses[utxo.Address] {
+				report("UTXO %s pertence a um endereço sem chave derivada (%s)", outpoint, utxo.Address)
+			}
+			if hasProgress && utxo.Height > progress {
+				report("UTXO %s na altura %d, acima do progresso %d", outpoint, utxo.Height, progress)
+			}
+		}
+
+		// Ledger: nenhum UTXO não gasto pode ter lançamento de gasto
+		entries, err := ListLedger(txn, 0, int(^uint(0)>>1))
+		if err != nil {
+			report("ledger ilegível: %v", err)
+		}
+		spent := make(map[string]bool)
+		for _, entry := range entries {
+			switch entry.Kind {
+			case models.LedgerReceive:
+			case models.LedgerSpend:
+				spent[entry.Outpoint] = true
+			default:
+				report("lançamento do ledger com tipo desconhecido %q", entry.Kind)
+			}
+		}
+		if len(entries) > 0 {
+			for outpoint := range utxos {
+				if spent[outpoint] {
+					report("UTXO %s consta como gasto no ledger", outpoint)
+				}
+			}
+		}
+
+		// Saídas OP_RETURN: só de transações do ledger
+		outputs, err := ListDataOutputs(txn)
+		if err != nil {
+			report("saídas OP_RETURN ilegíveis: %v", err)
+		}
+		txids := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			txids[entry.TxID] = true
+		}
+		for _, output := range outputs {
+			if !txids[output.TxID] {
+				report("saída OP_RETURN %s:%d de transação fora do ledger", output.TxID, output.Index)
+			}
+		}
+
+		// Índice de blocos: nada acima do progresso
+		indexed, err := ListIndexedHeights(txn, nil)
+		if err != nil {
+			report("índice de blocos ilegível: %v", err)
+		}
+		for _, height := range indexed {
+			if hasProgress && height > progress {
+				report("índice do bloco %d acima do progresso %d", height, progress)
+			}
+		}
+
+		// Cache de blocos: JSON válido e altura igual à da chave
+		return txn.Iterate([]byte(PrefixBlock), func(key, value []byte) error {
+			var header struct {
+				Height int `json:"height"`
+			}
+			if err := json.Unmarshal(value, &header); err != nil {
+				report("bloco %s ilegível: %v", key, err)
+				return nil
+			}
+			if string(blockKey(header.Height)) != string(key) {
+				report("bloco %s contém a altura %d", key, header.Height)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryBackend guarda tudo num mapa. Útil para testes e execuções que não
+// precisam persistir nada em disco.
+type memoryBackend struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// memoryTxn acumula as escritas e só as aplica ao backend no commit.
+type memoryTxn struct {
+	data     map[string][]byte
+	writes   map[string][]byte // nil = chave removida
+	readOnly bool
+}
+
+var errReadOnly = errors.New("transação somente leitura")
+
+// NewMemoryDB cria um DB em memória, vazio.
+func NewMemoryDB() *DB {
+	version, _ := json.Marshal(CurrentSchemaVersion)
+	return &DB{backend: &memoryBackend{data: map[string][]byte{
+		string(metaKey(MetaSchemaVersion)): version,
+	}}}
+}
+
+func (m *memoryBackend) View(fn func(txn Txn) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return fn(&memoryTxn{data: m.data, readOnly: true})
+}
+
+func (m *memoryBackend) Update(fn func(txn Txn) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txn := &memoryTxn{data: m.data, writes: make(map[string][]byte)}
+	if err := fn(txn); err != nil {
+		return err
+	}
+	for key, value := range txn.writes {
+		if value == nil {
+			delete(m.data, key)
+			continue
+		}
+		m.data[key] = value
+	}
+	return nil
+}
+
+func (m *memoryBackend) Compact() error {
+	return nil
+}
+
+func (m *memoryBackend) Close() error {
+	return nil
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	if value, ok := t.writes[string(key)]; ok {
+		if value == nil {
+			return nil, ErrNotFound
+		}
+		return append([]byte{}, value...), nil
+	}
+	value, ok := t.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (t *memoryTxn) Set(key, value []byte) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	t.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	t.writes[string(key)] = nil
+	return nil
+}
+
+func (t *memoryTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return t.IterateKeys(prefix, func(key []byte) error {
+		value, err := t.Get(key)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+func (t *memoryTxn) IterateKeys(prefix []byte, fn func(key []byte) error) error {
+	// Junta as chaves gravadas com as pendentes da transação, em ordem
+	p := string(prefix)
+	var keys []string
+	for key := range t.data {
+		if _, pending := t.writes[key]; !pending && strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range t.writes {
+		if value != nil && strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
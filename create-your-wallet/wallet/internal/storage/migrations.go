@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"wallet/pkg/models"
+)
+
+// CurrentSchemaVersion é a versão do layout do banco que este binário entende.
+const CurrentSchemaVersion = 2
+
+// MetaSchemaVersion guarda a versão do layout gravado no banco.
+const MetaSchemaVersion = "schema-version"
+
+// ErrSchemaTooNew indica um banco gravado por uma versão mais nova da carteira.
+var ErrSchemaTooNew = errors.New("banco de dados usa um formato mais novo que esta versão da carteira")
+
+// migration leva o banco da versão version-1 para version.
+type migration struct {
+	version int
+	name    string
+	apply   func(db *DB) error
+}
+
+// migrations em ordem crescente de versão. Novas mudanças de layout entram
+// aqui com a próxima versão e CurrentSchemaVersion é atualizada.
+var migrations = []migration{
+	{version: 1, name: "separa o blob wallet_state em chaves utxo/, key/ e meta/", apply: func(db *DB) error {
+		return db.Update(migrateLegacyState)
+	}},
+	{version: 2, name: "remove prefixos abandonados e renomeia block-N para block/<altura>", apply: migrateBlockKeys},
+}
+
+// SchemaVersion retorna a versão gravada no banco. Bancos antigos, sem a chave
+// de versão, são da versão 0.
+func (db *DB) SchemaVersion() (int, error) {
+	version := 0
+	err := db.View(func(txn Txn) error {
+		_, err := GetMeta(txn, MetaSchemaVersion, &version)
+		return err
+	})
+	return version, err
+}
+
+// migrate atualiza o banco até CurrentSchemaVersion. A versão só é gravada
+// depois que a migração termina, e toda migração pode ser executada de novo
+// sobre um resultado parcial, então uma falha no meio do caminho é retomada na
+// próxima abertura. Bancos vazios recebem a versão atual direto.
+func (db *DB) migrate() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("erro ao ler versão do banco: %w", err)
+	}
+	if version > CurrentSchemaVersion {
+		return fmt.Errorf("%w (banco: v%d, suportado: v%d)", ErrSchemaTooNew, version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return nil
+	}
+
+	empty := true
+	if err := db.View(func(txn Txn) error {
+		return txn.IterateKeys(nil, func(_ []byte) error {
+			empty = false
+			return errStopIteration
+		})
+	}); err != nil && err != errStopIteration {
+		return err
+	}
+	if empty {
+		return db.Update(func(txn Txn) error {
+			return PutMeta(txn, MetaSchemaVersion, CurrentSchemaVersion)
+		})
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		fmt.Printf("Migrando banco para v%d: %s\n", m.version, m.name)
+		if err := m.apply(db); err != nil {
+			return fmt.Errorf("erro na migração para v%d: %w", m.version, err)
+		}
+		if err := db.Update(func(txn Txn) error {
+			return PutMeta(txn, MetaSchemaVersion, m.version)
+		}); err != nil {
+			return fmt.Errorf("erro ao gravar versão v%d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+// errStopIteration interrompe um Iterate sem indicar falha.
+var errStopIteration = errors.New("fim da iteração")
+
+// Chaves da v0, em que todo o WalletState era um único blob JSON
+const (
+	legacyProgressKey    = "block_progress_state"
+	legacyWalletStateKey = "wallet_state"
+)
+
+// migrateLegacyState converte o blob "wallet_state" para o layout normalizado.
+func migrateLegacyState(txn Txn) error {
+	stateData, err := txn.Get([]byte(legacyWalletStateKey))
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state models.WalletState
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		return fmt.Errorf("erro ao desserializar estado antigo: %w", err)
+	}
+
+	var blockHeight int
+	progressData, err := txn.Get([]byte(legacyProgressKey))
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(progressData, &blockHeight); err != nil {
+			return fmt.Errorf("erro ao desserializar progresso antigo: %w", err)
+		}
+	}
+
+	// Versões antigas derivavam as chaves de novo a cada execução, duplicando as listas
+	seen := make(map[string]bool)
+	for i := range state.PublicKeys {
+		key := state.Key(i)
+		if seen[key.Address] {
+			continue
+		}
+		seen[key.Address] = true
+		if err := PutDerivedKey(txn, key); err != nil {
+			return err
+		}
+	}
+	for _, utxo := range state.UTXOs {
+		if err := PutUTXO(txn, utxo); err != nil {
+			return err
+		}
+	}
+	if err := PutMeta(txn, MetaProgress, blockHeight); err != nil {
+		return err
+	}
+	if err := txn.Delete([]byte(legacyWalletStateKey)); err != nil {
+		return err
+	}
+	return txn.Delete([]byte(legacyProgressKey))
+}
+
+// blocksPerMigrationTxn limita quantos blocos são movidos por transação,
+// para não estourar o tamanho máximo de transação do Badger.
+const blocksPerMigrationTxn = 50
+
+// migrateBlockKeys remove os prefixos que nunca foram lidos ("hash-",
+// "found-wallet-", "processed-block-" e o índice quebrado "block-h-") e move
+// os blocos de "block-N" para "block/<altura com zeros>", que itera em ordem de altura.
+func migrateBlockKeys(db *DB) error {
+	for _, prefix := range []string{"hash-", "found-wallet-", "processed-block-", "block-h-"} {
+		if err := db.ClearPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	for {
+		moved := 0
+		err := db.Update(func(txn Txn) error {
+			type rekey struct {
+				height int
+				old    []byte
+				data   []byte
+			}
+			var blocks []rekey
+			if err := txn.Iterate([]byte("block-"), func(key, value []byte) error {
+				height, err := strconv.Atoi(strings.TrimPrefix(string(key), "block-"))
+				if err != nil {
+					return nil // Chave desconhecida, mantida como está
+				}
+				blocks = append(blocks, rekey{height: height, old: key, data: value})
+				if len(blocks) == blocksPerMigrationTxn {
+					return errStopIteration
+				}
+				return nil
+			}); err != nil && err != errStopIteration {
+				return err
+			}
+
+			for _, b := range blocks {
+				if err := txn.Set(blockKey(b.height), b.data); err != nil {
+					return err
+				}
+				if err := txn.Delete(b.old); err != nil {
+					return err
+				}
+			}
+			moved = len(blocks)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if moved < blocksPerMigrationTxn {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"wallet/pkg/models"
+)
+
+// legacyBlocks é o número de blocos "block-N" do banco v0 de teste, o
+// suficiente para a migração usar mais de uma transação.
+const legacyBlocks = blocksPerMigrationTxn + 3
+
+// seedV0 grava no banco o layout da v0: o blob wallet_state, com chaves
+// duplicadas como as versões antigas deixavam, o progresso e os blocos em
+// "block-N", com o índice "block-h-N" e os prefixos abandonados.
+func seedV0(t *testing.T, db *DB) {
+	t.Helper()
+	state := models.WalletState{
+		UTXOs: map[string]models.UTXO{"aa:0": {TxID: "aa", VoutIndex: 0, Address: "tb1qa"}},
+	}
+	for _, name := range []string{"a", "b", "a", "b"} {
+		state.AddKey(models.DerivedKey{PrivateKey: []byte("priv-" + name), PublicKey: []byte("pub-" + name), Address: "tb1q" + name})
+	}
+	blob, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(txn Txn) error {
+		if err := txn.Delete(metaKey(MetaSchemaVersion)); err != nil && err != ErrNotFound {
+			return err
+		}
+		if err := txn.Set([]byte(legacyWalletStateKey), blob); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(legacyProgressKey), []byte("120")); err != nil {
+			return err
+		}
+		for height := 1; height <= legacyBlocks; height++ {
+			if err := txn.Set([]byte(fmt.Sprintf("block-%d", height)), []byte(fmt.Sprintf(`{"height":%d}`, height))); err != nil {
+				return err
+			}
+			if err := txn.Set([]byte(fmt.Sprintf("block-h-%d", height)), []byte("x")); err != nil {
+				return err
+			}
+		}
+		for _, key := range []string{"hash-1", "found-wallet-1", "processed-block-1", "block-extra"} {
+			if err := txn.Set([]byte(key), []byte("x")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkMigrated confere o banco depois da migração completa de seedV0.
+func checkMigrated(t *testing.T, db *DB) {
+	t.Helper()
+	if version, err := db.SchemaVersion(); err != nil || version != CurrentSchemaVersion {
+		t.Fatalf("versão %d (%v), esperava %d", version, err, CurrentSchemaVersion)
+	}
+
+	var keys []models.DerivedKey
+	var utxos map[string]models.UTXO
+	var height int
+	var leftover []string
+	if err := db.View(func(txn Txn) error {
+		var err error
+		if keys, err = ListDerivedKeys(txn, models.BranchReceive); err != nil {
+			return err
+		}
+		if utxos, err = ListUTXOs(txn); err != nil {
+			return err
+		}
+		if _, err := GetMeta(txn, MetaProgress, &height); err != nil {
+			return err
+		}
+		return txn.IterateKeys(nil, func(key []byte) error {
+			if !strings.Contains(string(key), "/") {
+				leftover = append(leftover, string(key))
+			}
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// As duplicatas de "a" e "b" viram uma chave cada
+	if len(keys) != 2 || keys[0].Address != "tb1qa" || keys[1].Address != "tb1qb" {
+		t.Fatalf("chaves migradas %+v, esperava tb1qa e tb1qb", keys)
+	}
+	if _, ok := utxos["aa:0"]; !ok || len(utxos) != 1 {
+		t.Fatalf("UTXOs migrados %v", utxos)
+	}
+	if height != 120 {
+		t.Fatalf("progresso %d, esperava 120", height)
+	}
+	// Só a chave "block-" desconhecida sobra fora do layout novo
+	if !reflect.DeepEqual(leftover, []string{"block-extra"}) {
+		t.Fatalf("chaves antigas restantes: %v", leftover)
+	}
+
+	heights, err := db.BlockHeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != legacyBlocks || heights[0] != 1 || heights[len(heights)-1] != legacyBlocks {
+		t.Fatalf("alturas em cache %v, esperava 1..%d", heights, legacyBlocks)
+	}
+	data, err := db.GetBlock(legacyBlocks)
+	if err != nil || string(data) != fmt.Sprintf(`{"height":%d}`, legacyBlocks) {
+		t.Fatalf("bloco %d migrado como %q (%v)", legacyBlocks, data, err)
+	}
+}
+
+func TestMigrateFromV0(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		seedV0(t, db)
+		if err := db.migrate(); err != nil {
+			t.Fatal(err)
+		}
+		checkMigrated(t, db)
+
+		// Um banco já migrado não muda
+		if err := db.migrate(); err != nil {
+			t.Fatal(err)
+		}
+		checkMigrated(t, db)
+	})
+}
+
+func TestMigrateResumesPartialMigration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		seedV0(t, db)
+
+		// Interrompida depois de separar o blob e de mover parte dos blocos,
+		// antes de gravar qualquer versão
+		if err := db.Update(migrateLegacyState); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Update(func(txn Txn) error {
+			for height := 1; height <= 10; height++ {
+				old := []byte(fmt.Sprintf("block-%d", height))
+				data, err := txn.Get(old)
+				if err != nil {
+					return err
+				}
+				if err := txn.Set(blockKey(height), data); err != nil {
+					return err
+				}
+				if err := txn.Delete(old); err != nil {
+					return err
+				}
+			}
+			return txn.Delete([]byte("hash-1"))
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.migrate(); err != nil {
+			t.Fatal(err)
+		}
+		checkMigrated(t, db)
+	})
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		if err := db.Update(func(txn Txn) error {
+			return PutMeta(txn, MetaSchemaVersion, CurrentSchemaVersion+1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.migrate(); !errors.Is(err, ErrSchemaTooNew) {
+			t.Fatalf("migrate de banco mais novo: %v, esperava ErrSchemaTooNew", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Modos de retenção do cache de blocos
+const (
+	RetainAll      = "all"      // Mantém todos os blocos
+	RetainLast     = "last"     // Mantém apenas os últimos Keep blocos
+	RetainActivity = "activity" // Mantém apenas blocos com atividade da carteira
+)
+
+// RetentionPolicy define quais blocos ficam no cache "block/" depois de processados.
+type RetentionPolicy struct {
+	Mode string
+	Keep int // Usado por RetainLast
+}
+
+// ParseRetention interpreta "all", "activity" ou um número N (últimos N blocos).
+func ParseRetention(value string) (RetentionPolicy, error) {
+	switch strings.ToLower(value) {
+	case "", RetainAll:
+		return RetentionPolicy{Mode: RetainAll}, nil
+	case RetainActivity:
+		return RetentionPolicy{Mode: RetainActivity}, nil
+	}
+	keep, err := strconv.Atoi(value)
+	if err != nil || keep < 0 {
+		return RetentionPolicy{}, fmt.Errorf("retenção inválida %q: use all, activity ou um número de blocos", value)
+	}
+	return RetentionPolicy{Mode: RetainLast, Keep: keep}, nil
+}
+
+func (p RetentionPolicy) String() string {
+	if p.Mode == RetainLast {
+		return fmt.Sprintf("últimos %d blocos", p.Keep)
+	}
+	return p.Mode
+}
+
+// PruneBlocks remove do cache os blocos até processedHeight que a política não
+// mantém. Blocos acima de processedHeight nunca são removidos. As remoções são
+// feitas em transações de até keysPerDeleteTxn blocos, já que o primeiro
+// prune de um cache completo pode remover centenas de milhares. Retorna
+// quantos blocos foram removidos.
+func (db *DB) PruneBlocks(policy RetentionPolicy, processedHeight int) (int, error) {
+	if policy.Mode == RetainAll || policy.Mode == "" {
+		return 0, nil
+	}
+	if policy.Mode != RetainLast && policy.Mode != RetainActivity {
+		return 0, fmt.Errorf("modo de retenção desconhecido: %s", policy.Mode)
+	}
+
+	heights, err := db.BlockHeights()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for start := 0; start < len(heights) && heights[start] <= processedHeight; start += keysPerDeleteTxn {
+		batch := heights[start:]
+		if len(batch) > keysPerDeleteTxn {
+			batch = batch[:keysPerDeleteTxn]
+		}
+		err := db.Update(func(txn Txn) error {
+			for _, height := range batch {
+				if height > processedHeight {
+					break
+				}
+				ok, err := retained(txn, policy, height, processedHeight)
+				if err != nil {
+					return err
+				}
+				if ok {
+					continue
+				}
+				if err := txn.Delete(blockKey(height)); err != nil {
+					return fmt.Errorf("erro ao remover bloco %d: %w", height, err)
+				}
+				removed++
+			}
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// listBlockHeights retorna as alturas dos blocos em cache, em ordem.
+func listBlockHeights(txn Txn) ([]int, error) {
+	var heights []int
+	err := txn.IterateKeys([]byte(PrefixBlock), func(key []byte) error {
+		height, err := strconv.Atoi(strings.TrimPrefix(string(key), PrefixBlock))
+		if err != nil {
+			return fmt.Errorf("chave de bloco inválida %s: %w", key, err)
+		}
+		heights = append(heights, height)
+		return nil
+	})
+	return heights, err
+}
+
+// BlockHeights retorna as alturas dos blocos em cache, em ordem.
+func (db *DB) BlockHeights() ([]int, error) {
+	var heights []int
+	err := db.View(func(txn Txn) error {
+		var err error
+		heights, err = listBlockHeights(txn)
+		return err
+	})
+	return heights, err
+}
@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"wallet/pkg/models"
+)
+
+// Layout das chaves do estado da carteira. Cada UTXO, chave derivada e
+// lançamento do ledger tem a sua própria chave, então um checkpoint só grava
+// o que mudou e os prefixos permitem consultas por intervalo.
+//
+//	block/<altura>                         -> bloco do getblock (verbosity 2)
+//	utxo/<txid>:<vout>                     -> models.UTXO
+//	key/<branch>/<índice>                  -> models.DerivedKey
+//	ledger/<altura>/<tipo>/<txid>:<índice> -> models.LedgerEntry
+//	index/<altura>                         -> models.BlockIndex
+//	header/<altura>                        -> cabeçalho de 80 bytes validado
+//	proof/<txid>                           -> models.TxProof
+//	data/<altura>/<txid>:<vout>            -> models.DataOutput
+//	label/<endereço ou outpoint>           -> texto
+//	multisig/<endereço>                    -> models.Multisig
+//	pending/<txid>                         -> models.PendingTx
+//	meta/<nome>                            -> valor JSON
+const (
+	PrefixBlock    = "block/"
+	PrefixUTXO     = "utxo/"
+	PrefixKey      = "key/"
+	PrefixLedger   = "ledger/"
+	PrefixIndex    = "index/"
+	PrefixHeader   = "header/"
+	PrefixProof    = "proof/"
+	PrefixData     = "data/"
+	PrefixLabel    = "label/"
+	PrefixMultisig = "multisig/"
+	PrefixPending  = "pending/"
+	PrefixMeta     = "meta/"
+)
+
+// Nomes das chaves de metadados
+const (
+	MetaProgress    = "progress"     // Última altura aplicada ao estado
+	MetaFetchErrors = "fetch-errors" // Blocos que o scan não conseguiu buscar, com o erro
+	MetaChangeIndex = "change-index" // Próximo índice de troco não usado
+	MetaAccount     = "account"      // Conta dona das chaves derivadas (models.Account)
+)
+
+func blockKey(height int) []byte {
+	return []byte(fmt.Sprintf("%s%010d", PrefixBlock, height))
+}
+
+func utxoKey(outpoint string) []byte {
+	return []byte(PrefixUTXO + outpoint)
+}
+
+func derivedKeyKey(branch, index int) []byte {
+	return []byte(fmt.Sprintf("%s%d/%06d", PrefixKey, branch, index))
+}
+
+func ledgerKey(entry models.LedgerEntry) []byte {
+	return []byte(fmt.Sprintf("%s%010d/%s/%s:%d", PrefixLedger, entry.Height, entry.Kind, entry.TxID, entry.Index))
+}
+
+func indexKey(height int) []byte {
+	return []byte(fmt.Sprintf("%s%010d", PrefixIndex, height))
+}
+
+func headerKey(height int) []byte {
+	return []byte(fmt.Sprintf("%s%010d", PrefixHeader, height))
+}
+
+func dataKey(output models.DataOutput) []byte {
+	return []byte(fmt.Sprintf("%s%010d/%s:%d", PrefixData, output.Height, output.TxID, output.Index))
+}
+
+func metaKey(name string) []byte {
+	return []byte(PrefixMeta + name)
+}
+
+func putJSON(txn Txn, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar %s: %w", key, err)
+	}
+	if err := txn.Set(key, data); err != nil {
+		return fmt.Errorf("erro ao gravar %s: %w", key, err)
+	}
+	return nil
+}
+
+// PutUTXO grava um UTXO sob utxo/<txid>:<vout>.
+func PutUTXO(txn Txn, utxo models.UTXO) error {
+	return putJSON(txn, utxoKey(fmt.Sprintf("%s:%d", utxo.TxID, utxo.VoutIndex)), utxo)
+}
+
+// DeleteUTXO remove um UTXO gasto.
+func DeleteUTXO(txn Txn, outpoint string) error {
+	if err := txn.Delete(utxoKey(outpoint)); err != nil {
+		return fmt.Errorf("erro ao remover UTXO %s: %w", outpoint, err)
+	}
+	return nil
+}
+
+// ListUTXOs retorna todos os UTXOs gravados, indexados por outpoint.
+func ListUTXOs(txn Txn) (map[string]models.UTXO, error) {
+	utxos := make(map[string]models.UTXO)
+	err := txn.Iterate([]byte(PrefixUTXO), func(key, val []byte) error {
+		var utxo models.UTXO
+		if err := json.Unmarshal(val, &utxo); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		utxos[strings.TrimPrefix(string(key), PrefixUTXO)] = utxo
+		return nil
+	})
+	return utxos, err
+}
+
+// PutDerivedKey grava um par de chaves derivado sob key/<branch>/<índice>.
+func PutDerivedKey(txn Txn, key models.DerivedKey) error {
+	return putJSON(txn, derivedKeyKey(key.Branch, key.Index), key)
+}
+
+// GetDerivedKey lê o par de chaves de key/<branch>/<índice>. Retorna false se
+// ele não existir.
+func GetDerivedKey(txn Txn, branch, index int) (models.DerivedKey, bool, error) {
+	var derived models.DerivedKey
+	val, err := txn.Get(derivedKeyKey(branch, index))
+	if err == ErrNotFound {
+		return derived, false, nil
+	}
+	if err != nil {
+		return derived, false, err
+	}
+	if err := json.Unmarshal(val, &derived); err != nil {
+		return derived, false, fmt.Errorf("erro ao desserializar %s: %w", derivedKeyKey(branch, index), err)
+	}
+	return derived, true, nil
+}
+
+// ListDerivedKeys retorna as chaves de um branch ordenadas pelo índice.
+func ListDerivedKeys(txn Txn, branch int) ([]models.DerivedKey, error) {
+	var keys []models.DerivedKey
+	prefix := []byte(fmt.Sprintf("%s%d/", PrefixKey, branch))
+	err := txn.Iterate(prefix, func(key, val []byte) error {
+		var derived models.DerivedKey
+		if err := json.Unmarshal(val, &derived); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		keys = append(keys, derived)
+		return nil
+	})
+	return keys, err
+}
+
+// PutLedgerEntry grava um lançamento do ledger.
+func PutLedgerEntry(txn Txn, entry models.LedgerEntry) error {
+	return putJSON(txn, ledgerKey(entry), entry)
+}
+
+// ListLedger retorna os lançamentos entre as alturas from e to (inclusive), em ordem.
+func ListLedger(txn Txn, from, to int) ([]models.LedgerEntry, error) {
+	var entries []models.LedgerEntry
+	err := txn.Iterate([]byte(PrefixLedger), func(key, val []byte) error {
+		var entry models.LedgerEntry
+		if err := json.Unmarshal(val, &entry); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		if entry.Height >= from && entry.Height <= to {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// PutBlockIndex grava o índice de scripts da carteira tocados no bloco.
+func PutBlockIndex(txn Txn, height int, index models.BlockIndex) error {
+	return putJSON(txn, indexKey(height), index)
+}
+
+// GetBlockIndex lê o índice do bloco. Retorna ErrNotFound se o bloco não tocou a carteira.
+func GetBlockIndex(txn Txn, height int) (models.BlockIndex, error) {
+	val, err := txn.Get(indexKey(height))
+	if err != nil {
+		return nil, err
+	}
+	var index models.BlockIndex
+	if err := json.Unmarshal(val, &index); err != nil {
+		return nil, fmt.Errorf("erro ao desserializar índice do bloco %d: %w", height, err)
+	}
+	return index, nil
+}
+
+// DeleteBlockIndex remove o índice do bloco.
+func DeleteBlockIndex(txn Txn, height int) error {
+	return txn.Delete(indexKey(height))
+}
+
+// ListIndexedHeights retorna, em ordem, as alturas cujo índice contém algum dos
+// scripts informados (em hex). Com scripts nil, retorna todas as alturas indexadas.
+func ListIndexedHeights(txn Txn, scripts map[string]bool) ([]int, error) {
+	var heights []int
+	err := txn.Iterate([]byte(PrefixIndex), func(key, val []byte) error {
+		height, err := strconv.Atoi(strings.TrimPrefix(string(key), PrefixIndex))
+		if err != nil {
+			return fmt.Errorf("chave de índice inválida %s: %w", key, err)
+		}
+		if scripts == nil {
+			heights = append(heights, height)
+			return nil
+		}
+		var index models.BlockIndex
+		if err := json.Unmarshal(val, &index); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		for script := range index {
+			if scripts[script] {
+				heights = append(heights, height)
+				break
+			}
+		}
+		return nil
+	})
+	return heights, err
+}
+
+// PutHeader grava o cabeçalho serializado (80 bytes) aceito na altura height.
+func PutHeader(txn Txn, height int, header []byte) error {
+	if err := txn.Set(headerKey(height), header); err != nil {
+		return fmt.Errorf("erro ao gravar cabeçalho %d: %w", height, err)
+	}
+	return nil
+}
+
+// GetHeader lê o cabeçalho da altura height. Retorna ErrNotFound se ele não foi aceito.
+func GetHeader(txn Txn, height int) ([]byte, error) {
+	return txn.Get(headerKey(height))
+}
+
+// PutProof grava a prova SPV de uma transação sob proof/<txid>.
+func PutProof(txn Txn, proof models.TxProof) error {
+	return putJSON(txn, []byte(PrefixProof+proof.TxID), proof)
+}
+
+// GetProof lê a prova SPV de uma transação. Retorna ErrNotFound se não houver.
+func GetProof(txn Txn, txid string) (models.TxProof, error) {
+	var proof models.TxProof
+	val, err := txn.Get([]byte(PrefixProof + txid))
+	if err != nil {
+		return proof, err
+	}
+	if err := json.Unmarshal(val, &proof); err != nil {
+		return proof, fmt.Errorf("erro ao desserializar prova de %s: %w", txid, err)
+	}
+	return proof, nil
+}
+
+// ListProofs retorna todas as provas SPV gravadas, em ordem de txid.
+func ListProofs(txn Txn) ([]models.TxProof, error) {
+	var proofs []models.TxProof
+	err := txn.Iterate([]byte(PrefixProof), func(key, val []byte) error {
+		var proof models.TxProof
+		if err := json.Unmarshal(val, &proof); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		proofs = append(proofs, proof)
+		return nil
+	})
+	return proofs, err
+}
+
+// PutDataOutput grava o conteúdo de uma saída OP_RETURN.
+func PutDataOutput(txn Txn, output models.DataOutput) error {
+	return putJSON(txn, dataKey(output), output)
+}
+
+// ListDataOutputs retorna as saídas OP_RETURN gravadas, em ordem de altura.
+func ListDataOutputs(txn Txn) ([]models.DataOutput, error) {
+	var outputs []models.DataOutput
+	err := txn.Iterate([]byte(PrefixData), func(key, val []byte) error {
+		var output models.DataOutput
+		if err := json.Unmarshal(val, &output); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		outputs = append(outputs, output)
+		return nil
+	})
+	return outputs, err
+}
+
+// PutLabel associa um rótulo a um endereço ou outpoint.
+func PutLabel(txn Txn, target, label string) error {
+	return txn.Set([]byte(PrefixLabel+target), []byte(label))
+}
+
+// DeleteLabel remove o rótulo de um endereço ou outpoint.
+func DeleteLabel(txn Txn, target string) error {
+	return txn.Delete([]byte(PrefixLabel + target))
+}
+
+// ListLabels retorna todos os rótulos, indexados pelo endereço ou outpoint.
+func ListLabels(txn Txn) (map[string]string, error) {
+	labels := make(map[string]string)
+	err := txn.Iterate([]byte(PrefixLabel), func(key, val []byte) error {
+		labels[strings.TrimPrefix(string(key), PrefixLabel)] = string(val)
+		return nil
+	})
+	return labels, err
+}
+
+// PutMeta grava um metadado serializado em JSON.
+func PutMeta(txn Txn, name string, value interface{}) error {
+	return putJSON(txn, metaKey(name), value)
+}
+
+// GetMeta lê um metadado em value. Retorna false se ele não existir.
+func GetMeta(txn Txn, name string, value interface{}) (bool, error) {
+	val, err := txn.Get(metaKey(name))
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(val, value); err != nil {
+		return false, fmt.Errorf("erro ao desserializar meta %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// DeletePrefix remove todas as chaves com o prefixo informado.
+func DeletePrefix(txn Txn, prefix string) error {
+	var keys [][]byte
+	if err := txn.IterateKeys([]byte(prefix), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return fmt.Errorf("erro ao remover chave %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// PutMultisig registra um multisig P2WSH sob multisig/<endereço>.
+func PutMultisig(txn Txn, ms models.Multisig) error {
+	return putJSON(txn, []byte(PrefixMultisig+ms.Address), ms)
+}
+
+// ListMultisigs retorna os multisigs registrados, ordenados pelo endereço.
+func ListMultisigs(txn Txn) ([]models.Multisig, error) {
+	var multisigs []models.Multisig
+	err := txn.Iterate([]byte(PrefixMultisig), func(key, val []byte) error {
+		var ms models.Multisig
+		if err := json.Unmarshal(val, &ms); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		multisigs = append(multisigs, ms)
+		return nil
+	})
+	return multisigs, err
+}
+
+// PutPending grava uma transação transmitida ainda não confirmada.
+func PutPending(txn Txn, pending models.PendingTx) error {
+	return putJSON(txn, []byte(PrefixPending+pending.TxID), pending)
+}
+
+// DeletePending remove uma transação que deixou de ser pendente.
+func DeletePending(txn Txn, txid string) error {
+	if err := txn.Delete([]byte(PrefixPending + txid)); err != nil && err != ErrNotFound {
+		return fmt.Errorf("erro ao remover pendente %s: %w", txid, err)
+	}
+	return nil
+}
+
+// ListPending retorna as transações pendentes, indexadas pelo txid.
+func ListPending(txn Txn) (map[string]models.PendingTx, error) {
+	pending := make(map[string]models.PendingTx)
+	err := txn.Iterate([]byte(PrefixPending), func(key, val []byte) error {
+		var tx models.PendingTx
+		if err := json.Unmarshal(val, &tx); err != nil {
+			return fmt.Errorf("erro ao desserializar %s: %w", key, err)
+		}
+		pending[tx.TxID] = tx
+		return nil
+	})
+	return pending, err
+}
@@ -1,108 +1,97 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
+	"time"
 
-	badger "github.com/dgraph-io/badger/v4"
+	"wallet/pkg/models"
 )
 
+// DB é o armazenamento da carteira, independente do backend usado.
 type DB struct {
-	badgerDB *badger.DB
+	backend Backend
 }
 
-// Setup inicializa o BadgerDB e retorna uma instância de DB
-func Setup(path string) (*DB, error) {
-	opts := badger.DefaultOptions(path)
-	opts.Logger = nil
-	badgerDB, err := badger.Open(opts)
-	if err != nil {
-		return nil, err
-	}
-	return &DB{badgerDB: badgerDB}, nil
+// NewDB cria um DB sobre um backend já aberto.
+func NewDB(backend Backend) *DB {
+	return &DB{backend: backend}
 }
 
 // Close fecha o banco de dados
 func (db *DB) Close() {
-	db.badgerDB.Close()
+	db.backend.Close()
 }
 
 // StoreBlock armazena o bloco no banco
 func (db *DB) StoreBlock(height int, blockData []byte) error {
-	return db.Update(func(txn *badger.Txn) error {
-		key := []byte(fmt.Sprintf("block-%d", height))
-		return txn.Set(key, blockData)
+	return db.Update(func(txn Txn) error {
+		return txn.Set(blockKey(height), blockData)
 	})
 }
 
-func (s *DB) GetBadgerDB() *badger.DB {
-	return s.badgerDB
-}
-
-// GetBlock recupera o bloco do banco
+// GetBlock recupera o bloco do banco. Retorna ErrNotFound se ele não estiver em cache.
 func (db *DB) GetBlock(height int) ([]byte, error) {
 	var blockData []byte
-	err := db.View(func(txn *badger.Txn) error {
-		key := []byte(fmt.Sprintf("block-%d", height))
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
-		return item.Value(func(val []byte) error {
-			blockData = append([]byte{}, val...) // Copia os dados
-			return nil
-		})
+	err := db.View(func(txn Txn) error {
+		var err error
+		blockData, err = txn.Get(blockKey(height))
+		return err
 	})
 	return blockData, err
 }
 
 // View permite executar uma função de leitura dentro de uma transação
-func (db *DB) View(fn func(txn *badger.Txn) error) error {
-	return db.badgerDB.View(fn)
+func (db *DB) View(fn func(txn Txn) error) error {
+	return db.backend.View(fn)
 }
 
 // Update permite executar uma função de escrita dentro de uma transação
-func (db *DB) Update(fn func(txn *badger.Txn) error) error {
-	return db.badgerDB.Update(fn)
+func (db *DB) Update(fn func(txn Txn) error) error {
+	return db.backend.Update(fn)
 }
 
 func (db *DB) Compact() error {
-	return db.badgerDB.RunValueLogGC(0.7)
+	return db.backend.Compact()
 }
 
-//! Daqui pra baixo.
-
-func (db *DB) StoreAddressesInBlock(height int, addressesFound map[string][]string) error {
-	key := []byte(fmt.Sprintf("block-h-%d", height))
-
-	// Serializa o mapa de endereços em JSON
-	addressesJSON, err := json.Marshal(addressesFound)
-	if err != nil {
-		return fmt.Errorf("erro ao serializar endereços: %w", err)
-	}
-
-	// Armazena os dados no BadgerDB
-	return db.Update(func(txn *badger.Txn) error {
-		return txn.Set(key, addressesJSON)
+// StoreAddressesInBlock grava o índice de scripts da carteira (hex) e das
+// transações que os tocaram no bloco.
+func (db *DB) StoreAddressesInBlock(height int, scriptsFound models.BlockIndex) error {
+	return db.Update(func(txn Txn) error {
+		return PutBlockIndex(txn, height, scriptsFound)
 	})
 }
 
-func (db *DB) GetAddressesInBlock(height int) (map[string][]string, error) {
-	key := []byte(fmt.Sprintf("block-%d", height))
-	var addressesFound map[string][]string
+// GetAddressesInBlock lê o índice gravado por StoreAddressesInBlock.
+func (db *DB) GetAddressesInBlock(height int) (models.BlockIndex, error) {
+	var scriptsFound models.BlockIndex
+	err := db.View(func(txn Txn) error {
+		var err error
+		scriptsFound, err = GetBlockIndex(txn, height)
+		return err
+	})
+	return scriptsFound, err
+}
 
-	// Recupera os dados do BadgerDB
-	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
+// RecordFetchError registra em meta que o bloco height não pôde ser buscado.
+// O registro fica mesmo depois que o bloco é obtido, para auditoria.
+func (db *DB) RecordFetchError(height int, fetchErr error) error {
+	return db.Update(func(txn Txn) error {
+		errors := make(map[int]string)
+		if _, err := GetMeta(txn, MetaFetchErrors, &errors); err != nil {
 			return err
 		}
-
-		// Deserializa o JSON de volta para o mapa
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &addressesFound)
-		})
+		errors[height] = fmt.Sprintf("%s: %v", time.Now().UTC().Format(time.RFC3339), fetchErr)
+		return PutMeta(txn, MetaFetchErrors, errors)
 	})
+}
 
-	return addressesFound, err
+// FetchErrors retorna os blocos registrados por RecordFetchError.
+func (db *DB) FetchErrors() (map[int]string, error) {
+	errors := make(map[int]string)
+	err := db.View(func(txn Txn) error {
+		_, err := GetMeta(txn, MetaFetchErrors, &errors)
+		return err
+	})
+	return errors, err
 }
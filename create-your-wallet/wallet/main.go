@@ -1,51 +1,215 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"wallet/internal/storage"
+	"wallet/pkg/chain"
+	"wallet/pkg/coinselect"
 	"wallet/pkg/helpers"
 	"wallet/pkg/models"
 	"wallet/pkg/progress"
+	"wallet/pkg/psbt"
+	"wallet/pkg/scanner"
+
+	"github.com/btcsuite/btcd/wire"
 )
 
-//!Edil: Sugestão, quando encontrar um outpoint (uma utxo) que você controla, já guarda o script dela junto. Você precisa do script para gastar essa utxo.
+// dataFlags acumula os valores de -data, que pode ser repetido.
+type dataFlags []string
+
+func (d *dataFlags) String() string { return strings.Join(*d, ",") }
+
+func (d *dataFlags) Set(value string) error {
+	*d = append(*d, value)
+	return nil
+}
+
+// walletKeys obtém o material de chaves da carteira só quando um comando
+// precisa dele: no modo watch-only, a tpub da conta do arquivo exportado; fora
+// dele, o xprv, lido uma única vez de -xprv-file, WALLET_XPRV ou do terminal.
+// Comandos que só leem o banco nunca pedem o xprv. Antes do primeiro uso, a
+// chave é conferida contra a conta dona do banco.
+type walletKeys struct {
+	db        *storage.DB
+	xprvFile  string
+	watchOnly *helpers.WatchOnly
+	xprv      string
+	checked   bool
+}
+
+// Key retorna o xprv ou, no modo watch-only, a tpub da conta.
+func (k *walletKeys) Key() (string, error) {
+	key, account := "", models.Account{}
+	if k.watchOnly != nil {
+		key, account = k.watchOnly.XPub, k.watchOnly.Account()
+	} else {
+		if k.xprv == "" {
+			xprv, err := helpers.ReadXprv(k.xprvFile)
+			if err != nil {
+				return "", err
+			}
+			k.xprv = xprv
+		}
+		w, err := helpers.ExportWatchOnly(k.xprv)
+		if err != nil {
+			return "", err
+		}
+		key, account = k.xprv, w.Account()
+	}
+
+	if !k.checked {
+		firstKey, err := helpers.FirstKey(key)
+		if err != nil {
+			return "", err
+		}
+		if err := progress.CheckAccount(k.db, account, firstKey); err != nil {
+			return "", err
+		}
+		k.checked = true
+	}
+	return key, nil
+}
+
+// Fingerprint retorna o fingerprint da chave mestre: do arquivo watch-only ou
+// calculado do xprv.
+func (k *walletKeys) Fingerprint() ([4]byte, error) {
+	if k.watchOnly != nil {
+		return k.watchOnly.FingerprintBytes()
+	}
+	xprv, err := k.Key()
+	if err != nil {
+		return [4]byte{}, err
+	}
+	return helpers.MasterFingerprint(xprv)
+}
 
 func main() {
 
 	start := time.Now()
 
-	db, err := storage.Setup("./internal/badgerdb")
+	recovery := flag.String("recovery", helpers.RecoveryFullScan, "modo de recuperação: fullscan (histórico completo) ou scantxoutset (apenas UTXOs atuais)")
+	checkpointEvery := flag.Int("checkpoint", 10, "salva estado e altura a cada N blocos (1 = todo bloco)")
+	backend := flag.String("backend", storage.BackendBadger, "backend de armazenamento: badger ou memory")
+	dbPath := flag.String("db", "./internal/badgerdb", "diretório do banco (backend badger)")
+	network := flag.String("network", helpers.NetworkSignet, "rede do nó: signet, testnet ou regtest")
+	retention := flag.String("cache-retention", storage.RetainAll, "blocos mantidos em cache: all, activity ou N (últimos N blocos)")
+	sendTo := flag.String("to", "tb1q2z0yg87sxpeqftrj7cpx7zd3q0cthh22vda6la", "endereço de destino do envio (P2WPKH ou P2WSH)")
+	sendAmount := flag.Float64("amount", 0.01, "valor do envio em BTC")
+	var dataOutputs dataFlags
+	flag.Var(&dataOutputs, "data", "saída OP_RETURN do envio: texto ou hex:<bytes> (pode repetir)")
+	fromMultisig := flag.String("from-multisig", "", "gasta apenas os UTXOs do multisig com este endereço")
+	strategy := flag.String("coinselect", coinselect.StrategyAuto, "seleção de entradas do envio: auto, bnb, knapsack, largest ou oldest")
+	feeRate := flag.Float64("feerate", 0, "taxa do envio em sat/vB (0 = estimatesmartfee com -conf-target)")
+	confTarget := flag.Int("conf-target", 6, "alvo de confirmação em blocos para o estimatesmartfee")
+	fallbackFee := flag.Float64("fallbackfee", 0, "taxa em sat/vB se o nó não tiver estimativa (0 = recusa o envio)")
+	maxFee := flag.Float64("maxfee", helpers.DefaultMaxFee, "taxa absoluta máxima do envio em BTC")
+	maxFeeRate := flag.Float64("maxfeerate", helpers.DefaultMaxFeeRate, "taxa máxima do envio em sat/vB")
+	psbtOut := flag.String("psbt", "", "grava o envio sem assinaturas como PSBT neste arquivo em vez de assinar")
+	psbtVersion := flag.Int("psbt-version", psbt.Version0, "versão do PSBT gravado com -psbt: 0 ou 2")
+	rbf := flag.Bool("rbf", false, "sinaliza substituição por taxa (BIP125) no envio, permitindo bumpfee")
+	broadcast := flag.Bool("broadcast", false, "transmite o envio com sendrawtransaction e o acompanha até confirmar")
+	watchOnly := flag.String("watch-only", "", "usa só a tpub exportada com export-watchonly: escaneia e grava envios como PSBT, sem chave privada")
+	xprvFile := flag.String("xprv-file", "", "arquivo com o xprv da carteira (sem ele, usa "+helpers.XprvEnv+" ou pede no terminal)")
+	flag.Parse()
+
+	// Comando opcional: "listunspent" ou "balances" imprimem relatórios e não criam
+	// transação; "rescan [-all]" reconstrói o histórico a partir do cache de blocos;
+	// "explain" refaz o scan e mostra a origem de cada outpoint e as anomalias;
+	// "db stats|clear|compact|verify|blocks" faz manutenção do banco; "backup" e "restore"
+	// exportam e importam a carteira; "label" associa rótulos a endereços e UTXOs;
+	// "proofs verify|fetch|export" confere e exporta as provas SPV do ledger;
+	// "reconcile [-follow]" compara os UTXOs salvos com o conjunto do nó;
+	// "multisig create|list" registra scripts P2WSH m-de-n acompanhados pelo scan;
+	// "signtx <hex>" acrescenta as assinaturas da carteira a um gasto multisig parcial;
+	// "opreturn" lista as saídas OP_RETURN das transações da carteira;
+	// "psbt decode|sign|combine|finalize" opera sobre PSBTs de envios com -psbt
+	// ou do walletprocesspsbt do Bitcoin Core; "export-watchonly" e
+	// "offline-sign" são o lado offline do fluxo air-gapped, só com o xprv;
+	// "bumpfee <txid>" substitui um envio não confirmado por um de taxa maior;
+	// "cpfp <txid:vout>" acelera uma transação recebida gastando a saída
+	// ainda não confirmada; "pending" lista os envios transmitidos que ainda
+	// não confirmaram
+	command := flag.Arg(0)
+
+	if *recovery != helpers.RecoveryFullScan && *recovery != helpers.RecoveryScanTxOutSet {
+		fmt.Printf("Modo de recuperação desconhecido: %s\n", *recovery)
+		return
+	}
+	if !coinselect.IsStrategy(*strategy) {
+		fmt.Printf("Estratégia de seleção desconhecida: %s\n", *strategy)
+		return
+	}
+	helpers.Network = *network
+	retentionPolicy, err := storage.ParseRetention(*retention)
 	if err != nil {
-		fmt.Printf("Erro ao configurar o BadgerDB: %v\n", err)
+		fmt.Println(err)
 		return
 	}
-	defer db.Close()
-
-	//? Limpeza
 
-	// if err := db.ClearHashes(); err != nil {
-	// 	log.Fatalf("Erro ao limpar hashes: %v", err)
-	// }
+	// Lado offline do fluxo air-gapped: só o material de chaves, sem banco nem bitcoind
+	switch command {
+	case "export-watchonly", "offline-sign":
+		xprv, err := helpers.ReadXprv(*xprvFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		run := runExportWatchOnly
+		if command == "offline-sign" {
+			run = runOfflineSign
+		}
+		if err := run(xprv, flag.Args()[1:]); err != nil {
+			fmt.Printf("Erro: %v\n", err)
+		}
+		return
+	}
 
-	// if err := db.ClearProcessedBlocks(); err != nil {
-	// 	log.Fatalf("Erro ao limpar hashes: %v", err)
-	// }
+	// No modo watch-only as chaves saem da tpub da conta e o xprv nunca é lido;
+	// o fingerprint da chave mestre vem do arquivo exportado
+	keys := &walletKeys{xprvFile: *xprvFile}
+	if *watchOnly != "" {
+		w, err := helpers.ReadWatchOnly(*watchOnly)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		keys.watchOnly = &w
+		fmt.Printf("Modo watch-only: conta %s (fingerprint %s)\n", w.XPub, w.Fingerprint)
+	}
 
-	// if err := db.ClearWalletHashes(); err != nil {
-	// 	log.Fatalf("Erro ao limpar hashes: %v", err)
-	// }
+	db, err := storage.Open(*backend, *dbPath)
+	if err != nil {
+		fmt.Printf("Erro ao configurar o banco (%s): %v\n", *backend, err)
+		return
+	}
+	defer db.Close()
+	keys.db = db
 
-	// if err := db.Compact(); err != nil {
-	// 	log.Printf("Erro ao compactar o banco: %v", err)
-	// }
+	// Comandos que só mexem no banco, sem carregar o estado nem escanear blocos
+	switch command {
+	case "db", "backup", "restore", "label", "proofs", "reconcile", "multisig", "signtx", "opreturn", "psbt", "bumpfee", "cpfp", "pending":
+		if err := runOffline(db, keys, retentionPolicy, command, flag.Args()[1:]); err != nil {
+			fmt.Printf("Erro: %v\n", err)
+		}
+		return
+	}
 
-	lastProcessed, state, err := progress.LoadProgress(db.GetBadgerDB())
+	lastProcessed, state, err := progress.LoadProgress(db)
 	if err != nil {
 		fmt.Printf("Erro ao carregar progresso: %v\n", err)
 		return
 	}
+	if *watchOnly != "" && state != nil && len(helpers.SigningKeys(state)) > 0 {
+		fmt.Println("O banco contém chaves privadas; use um banco próprio (-db) para o modo watch-only")
+		return
+	}
 
 	// Inicializar estado se não houver progresso salvo
 	if state == nil {
@@ -58,23 +222,57 @@ func main() {
 			Balance:         0,
 		}
 		fmt.Println("Inicializando estado da carteira...")
-	}
 
-	xprv := "tprv8ZgxMBicQKsPdt2JSGYoFa3bag1DMeGF8zdJC3ECLwCbUWdoZMq2wkqrN3zMaY9ep1RpD6yqLLmPohMgptXQ56YHr5NBLoUoXxLv97MjDcz"
-	if state == nil {
+		if state.Multisigs, err = progress.LoadMultisigs(db); err != nil {
+			fmt.Println(err)
+			return
+		}
 	}
 
-	helpers.DeriveKeyPairs(xprv, 2000, state)
-	fmt.Println("Break point")
+	// As chaves já vêm no estado salvo; derivar de novo duplicaria as listas
+	if len(state.PublicKeys) == 0 {
+		walletKey, err := keys.Key()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := helpers.DeriveKeyPairs(walletKey, 2000, state); err != nil {
+			fmt.Printf("Erro ao derivar chaves: %v\n", err)
+			return
+		}
+
+		// Gerar scriptPubKeys
+		for i := 0; i < 2000; i++ {
+			scriptPubKey, err := helpers.GetP2WPKHProgram(state.PublicKeys[i], 0)
+			if err != nil {
+				fmt.Printf("Erro no scriptPubKey: %v\n", err)
+				return
+			}
+			state.WitnessPrograms = append(state.WitnessPrograms, scriptPubKey)
+		}
+
+		if err := progress.SaveKeys(db, state); err != nil {
+			fmt.Printf("Erro ao salvar chaves: %v\n", err)
+			return
+		}
+	}
 
-	// Gerar scriptPubKeys
-	for i := 0; i < 2000; i++ {
-		scriptPubKey, err := helpers.GetP2WPKHProgram(state.PublicKeys[i], 0)
+	// Chaves de troco do branch interno, sempre com folga além da próxima
+	if len(state.ChangeKeys) < state.ChangeIndex+helpers.ChangeLookahead {
+		walletKey, err := keys.Key()
 		if err != nil {
-			fmt.Printf("Erro no scriptPubKey: %v\n", err)
+			fmt.Println(err)
+			return
+		}
+		changeKeys, err := helpers.DeriveChangeKeys(walletKey, state)
+		if err != nil {
+			fmt.Printf("Erro ao derivar chaves de troco: %v\n", err)
+			return
+		}
+		if err := progress.SaveChangeKeys(db, changeKeys, state.ChangeIndex); err != nil {
+			fmt.Printf("Erro ao salvar chaves de troco: %v\n", err)
 			return
 		}
-		state.WitnessPrograms = append(state.WitnessPrograms, scriptPubKey)
 	}
 
 	// Exibir algumas chaves derivadas
@@ -88,96 +286,86 @@ func main() {
 
 	// helpers.Gen(&state)
 
-	// Continuar do último bloco processado + 1
-	startBlock := lastProcessed + 1
-	targetBlock := 301
-	for blockHeight := startBlock; blockHeight <= targetBlock; blockHeight++ {
-		block, err := storage.FetchAndStoreBlock(db, blockHeight)
-		if err != nil {
-			fmt.Printf("Erro ao buscar o bloco %d: %v\n", blockHeight, err)
-			continue
+	switch command {
+	case "rescan":
+		if err := runRescan(db, state, lastProcessed, flag.Args()[1:]); err != nil {
+			fmt.Printf("Erro no rescan: %v\n", err)
 		}
-		fmt.Printf("Processando bloco: %d\n", blockHeight)
-
-		if txList, ok := block["tx"].([]interface{}); ok {
-			for _, tx := range txList {
-				txMap, ok := tx.(map[string]interface{})
-				if !ok {
-					fmt.Println("Erro ao converter transação")
-					continue
-				}
-
-				// Processar saídas (vout) para adicionar UTXOs
-				if voutList, ok := txMap["vout"].([]interface{}); ok {
-					for voutIndex, vout := range voutList {
-						voutMap, ok := vout.(map[string]interface{})
-						if !ok {
-							continue
-						}
-
-						scriptPubKey, ok := voutMap["scriptPubKey"].(map[string]interface{})
-						if !ok {
-							continue
-						}
-						address, ok := scriptPubKey["address"].(string)
-						if !ok {
-							continue
-						}
-
-						privateKey, found := helpers.GetPrivateKeyForAddress(state, address)
-						if found {
-							value, ok := voutMap["value"].(float64)
-							if !ok {
-								continue
-							}
-							txid, ok := txMap["txid"].(string)
-							if !ok {
-								continue
-							}
-							// fmt.Printf("Chave privada associada ao endereço %s: %x\n", address, privateKey)
-							helpers.UpdateUTXO(state, txid, voutIndex, value, address, privateKey)
-						}
-					}
-				}
-
-				// Processar entradas (vin) para remover UTXOs gastos
-				if vinList, ok := txMap["vin"].([]interface{}); ok {
-					for _, vin := range vinList {
-						vinMap, ok := vin.(map[string]interface{})
-						if !ok {
-							continue
-						}
-
-						txid, ok := vinMap["txid"].(string)
-						if !ok {
-							continue
-						}
-
-						voutIndex, ok := vinMap["vout"].(float64) // Índice do vout
-						if !ok {
-							continue
-						}
-
-						utxoKey := fmt.Sprintf("%s:%d", txid, int(voutIndex))
-						if _, exists := state.UTXOs[utxoKey]; exists {
-							delete(state.UTXOs, utxoKey)
-							fmt.Printf("Removendo UTXO gasto: %s\n", utxoKey)
-						}
-					}
-				}
-			}
+		return
+	case "explain":
+		if err := runExplain(db, state, lastProcessed, flag.Args()[1:]); err != nil {
+			fmt.Printf("Erro no explain: %v\n", err)
 		}
+		return
 	}
 
-	// Salva snapshot da blockchain
-	if targetBlock > lastProcessed {
-		if err := progress.SaveProgress(db.GetBadgerDB(), targetBlock, state); err != nil {
-			fmt.Printf("Erro ao salvar progresso ao final: %v\n", err)
+	// Recuperação rápida: sem progresso salvo, carrega o conjunto de UTXOs atual
+	// com um único scantxoutset e continua o scan a partir da altura retornada.
+	// O histórico anterior a essa altura não é reconstruído (use -recovery=fullscan).
+	if lastProcessed == 0 && *recovery == helpers.RecoveryScanTxOutSet {
+		walletKey, err := keys.Key()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		descriptors, err := helpers.WalletDescriptors(walletKey)
+		if err != nil {
+			fmt.Printf("Erro ao gerar descritores: %v\n", err)
+			return
+		}
+		descriptors = append(descriptors, helpers.MultisigDescriptors(state)...)
+		result, err := helpers.ScanTxOutSet(descriptors, len(state.PublicKeys))
+		if err != nil {
+			fmt.Printf("Erro na recuperação via scantxoutset: %v\n", err)
+			return
+		}
+		if unmatched := helpers.SeedStateFromScan(state, result); unmatched > 0 {
+			fmt.Printf("%d UTXOs do scantxoutset não foram associados à carteira\n", unmatched)
 		}
+		if err := progress.SaveSnapshot(db, result.Height, state); err != nil {
+			fmt.Printf("Erro ao salvar progresso da recuperação: %v\n", err)
+			return
+		}
+		lastProcessed = result.Height
+		fmt.Printf("Recuperados %d UTXOs via scantxoutset na altura %d\n", len(state.UTXOs), result.Height)
+	}
+
+	// Continuar do último bloco processado + 1, salvando checkpoints pelo caminho.
+	// Ctrl+C interrompe após o bloco atual e grava o progresso até ali.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Cada bloco é validado contra a cadeia de cabeçalhos antes de tocar o estado
+	chainParams, err := chain.NewParams(*network)
+	if err != nil {
+		fmt.Printf("Erro nas regras da rede: %v\n", err)
+		return
+	}
+
+	targetBlock := 301
+	scan := scanner.New(db, state, *checkpointEvery)
+	scan.SetRetention(retentionPolicy)
+	scan.SetChainParams(chainParams)
+	processed, err := scan.Run(ctx, lastProcessed, targetBlock)
+	if err != nil {
+		fmt.Printf("Scan parado no bloco %d: %v\n", processed, err)
 	}
 
 	// Calcular saldo ao final
-	helpers.CalculateBalance(state)
+	tipHeight := processed
+	helpers.CalculateBalance(state, tipHeight)
+
+	switch command {
+	case "listunspent":
+		if err := helpers.PrintListUnspent(state, tipHeight); err != nil {
+			fmt.Printf("Erro ao gerar relatório: %v\n", err)
+		}
+		return
+	case "balances":
+		helpers.PrintAddressBalances(state, tipHeight)
+		fmt.Printf("Saldo imaturo (coinbase): %.8f\n", state.ImmatureBalance)
+		return
+	}
 
 	// Imprimir saldo final
 	//wallet_126 31.31556107
@@ -186,30 +374,136 @@ func main() {
 
 	elapsed := time.Since(start) // Final da medição de tempo
 	fmt.Printf("Tempo total de execução: %s\n", elapsed)
-	fmt.Printf("Último bloco processado: %d\n", lastProcessed)
+	fmt.Printf("Último bloco processado: %d\n", processed)
 
-	destinationAddress := "tb1q2z0yg87sxpeqftrj7cpx7zd3q0cthh22vda6la"
+	destinationAddress := *sendTo
+	amount := *sendAmount // Valor a enviar
 
-	amount := 0.01 // Valor a enviar
-	fee := 0.0001  // Taxa de transação
-
-	selectedUTXOs := make(map[string]models.UTXO)
-	totalSelected := 0.0
+	// Coinbase imatura não pode ser gasta. O multisig só é gasto quando pedido,
+	// já que pode depender de assinaturas de outros participantes. UTXOs já
+	// gastos por um envio pendente ficam de fora até ele confirmar
+	pendingSpent := state.PendingSpent()
+	spendable := make(map[string]models.UTXO)
 	for key, utxo := range state.UTXOs {
-		if totalSelected >= amount+fee {
-			break
+		if !utxo.IsMature(tipHeight) {
+			continue
+		}
+		if _, spent := pendingSpent[key]; spent {
+			continue
+		}
+		wanted := len(utxo.WitnessScript) == 0
+		if *fromMultisig != "" {
+			wanted = utxo.Address == *fromMultisig
+		}
+		if wanted {
+			spendable[key] = utxo
 		}
-		selectedUTXOs[key] = utxo
-		totalSelected += utxo.Value
 	}
 
-	rawTx, err := helpers.CreateTransaction(selectedUTXOs, destinationAddress, amount, fee)
+	var data [][]byte
+	for _, value := range dataOutputs {
+		payload, err := helpers.ParseDataOutput(value)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		data = append(data, payload)
+	}
+
+	changeKey, err := helpers.NextChangeKey(state)
+	if err != nil {
+		fmt.Printf("Erro ao obter endereço de troco: %v\n", err)
+		return
+	}
+
+	options := helpers.SendOptions{
+		Strategy:        *strategy,
+		FeeRate:         *feeRate,
+		ConfTarget:      *confTarget,
+		FallbackFeeRate: *fallbackFee,
+		MaxFee:          *maxFee,
+		MaxFeeRate:      *maxFeeRate,
+		ChangeAddress:   changeKey.Address,
+		RBF:             *rbf,
+		Data:            data,
+		Keys:            helpers.SigningKeys(state),
+	}
+
+	if *watchOnly != "" && *psbtOut == "" {
+		fmt.Println("No modo watch-only o envio é gravado como PSBT: informe -psbt <arquivo> e assine com offline-sign")
+		return
+	}
+
+	// Com -psbt a transação sai sem assinaturas, com UTXOs e derivações para
+	// que cada participante (ou o Bitcoin Core) assine
+	var rawTx string
+	var selection *coinselect.Selection
+	var complete bool
+	var packet *psbt.Packet
+	if *psbtOut != "" {
+		var tx *wire.MsgTx
+		tx, selection, err = helpers.BuildTransaction(spendable, destinationAddress, amount, options)
+		if err == nil {
+			packet, err = psbt.FromTransaction(tx, selection.UTXOs(), *psbtVersion)
+		}
+		if err == nil {
+			addPrevTxs(db, packet, selection.UTXOs())
+			var fingerprint [4]byte
+			if fingerprint, err = keys.Fingerprint(); err == nil {
+				err = packet.AddDerivations(state, fingerprint)
+			}
+		}
+	} else {
+		rawTx, selection, complete, err = helpers.CreateTransaction(spendable, destinationAddress, amount, options)
+	}
 	if err != nil {
 		fmt.Printf("Erro ao criar transação: %v\n", err)
 		return
 	}
+	fmt.Printf("Seleção %s: %d entradas, total %d sat, taxa %d sat (%d vB), troco %d sat, waste %d\n",
+		selection.Strategy, len(selection.Coins), selection.Total, selection.Fee, helpers.VSize(selection.Weight), selection.Change, selection.Waste)
 
+	if selection.Change > 0 {
+		fmt.Printf("Troco para %s (/1/%d)\n", changeKey.Address, changeKey.Index)
+	}
+
+	if packet != nil {
+		if err := packet.WriteFile(*psbtOut); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("PSBT sem assinaturas gravado em %s; assine com offline-sign, psbt sign ou walletprocesspsbt\n", *psbtOut)
+		return
+	}
+	if !complete {
+		fmt.Printf("Transação parcialmente assinada; os outros participantes completam com signtx: %s\n", rawTx)
+		return
+	}
 	fmt.Printf("Transação criada com sucesso: %s\n", rawTx)
+	tx, err := helpers.DecodeTransaction(rawTx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("TxID: %s\n", helpers.TxID(tx))
+	if *broadcast {
+		if _, err := helpers.SendRawTransaction(rawTx); err != nil {
+			fmt.Printf("Erro ao transmitir: %v\n", err)
+			return
+		}
+		// O envio fica pendente até o scan encontrá-lo num bloco
+		if err := progress.SavePending(db, helpers.NewPendingTx(tx, selection.Fee)); err != nil {
+			fmt.Printf("Erro ao registrar envio pendente: %v\n", err)
+			return
+		}
+		// O endereço de troco só deixa de ser oferecido depois que o envio sai
+		// para a rede; PSBTs e transações parciais reservam ao transmitir
+		if err := markChangeUsed(db, state, tx); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Transação transmitida; replaceable=%t\n", helpers.SignalsRBF(tx))
+	}
 
 	fmt.Println("Break point")
 }
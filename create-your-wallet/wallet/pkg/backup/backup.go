@@ -0,0 +1,426 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"wallet/internal/storage"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Identificação do arquivo de backup
+const (
+	FileFormat  = "wallet-backup"
+	FileVersion = 1
+)
+
+// Parâmetros do scrypt para derivar a chave AES-256 da senha
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// Payload é o conteúdo da carteira guardado no backup.
+type Payload struct {
+	Descriptors []string             // Descritores privados da carteira
+	KeyCount    int                  // Quantas chaves de recebimento estavam derivadas
+	ChangeIndex int                  // Próximo índice de troco não usado
+	Height      int                  // Altura do snapshot de UTXOs
+	UTXOs       []models.UTXO        // Snapshot de UTXOs na altura Height
+	Ledger      []models.LedgerEntry // Histórico até Height
+	Data        []models.DataOutput  // Saídas OP_RETURN do histórico
+	Labels      map[string]string    // Rótulos por endereço ou outpoint
+	Multisigs   []models.Multisig    // Multisigs P2WSH registrados
+
+	// Envios transmitidos ainda não confirmados (RBF e CPFP)
+	Pending []models.PendingTx `json:",omitempty"`
+}
+
+// File é o arquivo de backup gravado em disco. Sem senha, o payload vai em
+// claro; com senha, vai cifrado com AES-256-GCM e chave derivada por scrypt.
+// Checksum é o SHA-256 do payload em claro, conferido na restauração.
+type File struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	Created    time.Time       `json:"created"`
+	Encrypted  bool            `json:"encrypted"`
+	Checksum   string          `json:"checksum"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Salt       string          `json:"salt,omitempty"`
+	Nonce      string          `json:"nonce,omitempty"`
+	Ciphertext string          `json:"ciphertext,omitempty"`
+}
+
+// Collect lê do banco tudo o que vai para o backup.
+func Collect(db *storage.DB, xprv string) (*Payload, error) {
+	payload := &Payload{Descriptors: []string{helpers.WalletDescriptor(xprv), helpers.WalletChangeDescriptor(xprv)}}
+
+	err := db.View(func(txn storage.Txn) error {
+		found, err := storage.GetMeta(txn, storage.MetaProgress, &payload.Height)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("nenhum progresso salvo para fazer backup")
+		}
+
+		keys, err := storage.ListDerivedKeys(txn, 0)
+		if err != nil {
+			return err
+		}
+		payload.KeyCount = len(keys)
+		if _, err := storage.GetMeta(txn, storage.MetaChangeIndex, &payload.ChangeIndex); err != nil {
+			return err
+		}
+
+		utxos, err := storage.ListUTXOs(txn)
+		if err != nil {
+			return err
+		}
+		outpoints := make([]string, 0, len(utxos))
+		for outpoint := range utxos {
+			outpoints = append(outpoints, outpoint)
+		}
+		sort.Strings(outpoints)
+		for _, outpoint := range outpoints {
+			payload.UTXOs = append(payload.UTXOs, utxos[outpoint])
+		}
+
+		if payload.Ledger, err = storage.ListLedger(txn, 0, payload.Height); err != nil {
+			return err
+		}
+		if payload.Data, err = storage.ListDataOutputs(txn); err != nil {
+			return err
+		}
+		if payload.Multisigs, err = storage.ListMultisigs(txn); err != nil {
+			return err
+		}
+		pending, err := storage.ListPending(txn)
+		if err != nil {
+			return err
+		}
+		txids := make([]string, 0, len(pending))
+		for txid := range pending {
+			txids = append(txids, txid)
+		}
+		sort.Strings(txids)
+		for _, txid := range txids {
+			payload.Pending = append(payload.Pending, pending[txid])
+		}
+		payload.Labels, err = storage.ListLabels(txn)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler carteira para backup: %w", err)
+	}
+	return payload, nil
+}
+
+// Write grava o payload em path. Com passphrase vazia o arquivo não é cifrado.
+func Write(path string, payload *Payload, passphrase string) error {
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar backup: %w", err)
+	}
+	sum := sha256.Sum256(plain)
+
+	file := File{
+		Format:   FileFormat,
+		Version:  FileVersion,
+		Created:  time.Now().UTC(),
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+
+	if passphrase == "" {
+		file.Payload = plain
+	} else {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("erro ao gerar salt: %w", err)
+		}
+		gcm, err := newGCM(passphrase, salt)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("erro ao gerar nonce: %w", err)
+		}
+		file.Encrypted = true
+		file.Salt = hex.EncodeToString(salt)
+		file.Nonce = hex.EncodeToString(nonce)
+		file.Ciphertext = hex.EncodeToString(gcm.Seal(nil, nonce, plain, nil))
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar arquivo de backup: %w", err)
+	}
+	// 0600: o backup contém o xprv
+	return os.WriteFile(path, data, 0o600)
+}
+
+// Read lê, decifra e confere a integridade de um arquivo de backup.
+func Read(path, passphrase string) (*Payload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler backup: %w", err)
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("arquivo de backup inválido: %w", err)
+	}
+	if file.Format != FileFormat {
+		return nil, fmt.Errorf("formato de backup desconhecido: %q", file.Format)
+	}
+	if file.Version > FileVersion {
+		return nil, fmt.Errorf("backup v%d é mais novo que o suportado (v%d)", file.Version, FileVersion)
+	}
+
+	// O payload em claro foi reindentado junto com o arquivo; compactado, volta
+	// aos bytes do checksum
+	var compact bytes.Buffer
+	if !file.Encrypted {
+		if err := json.Compact(&compact, file.Payload); err != nil {
+			return nil, fmt.Errorf("conteúdo do backup inválido: %w", err)
+		}
+	}
+	plain := compact.Bytes()
+	if file.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("backup cifrado: informe a senha")
+		}
+		salt, err := hex.DecodeString(file.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("salt inválido: %w", err)
+		}
+		nonce, err := hex.DecodeString(file.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("nonce inválido: %w", err)
+		}
+		ciphertext, err := hex.DecodeString(file.Ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("conteúdo cifrado inválido: %w", err)
+		}
+		gcm, err := newGCM(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		if len(nonce) != gcm.NonceSize() {
+			return nil, fmt.Errorf("nonce com tamanho inválido")
+		}
+		if plain, err = gcm.Open(nil, nonce, ciphertext, nil); err != nil {
+			return nil, fmt.Errorf("senha incorreta ou backup corrompido")
+		}
+	}
+
+	sum := sha256.Sum256(plain)
+	if hex.EncodeToString(sum[:]) != file.Checksum {
+		return nil, fmt.Errorf("checksum do backup não confere: arquivo corrompido")
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return nil, fmt.Errorf("conteúdo do backup inválido: %w", err)
+	}
+	return &payload, nil
+}
+
+// Restore reconstrói a carteira num banco sem progresso salvo: deriva as chaves
+// a partir do descritor, grava o snapshot de UTXOs, o ledger, os rótulos e os
+// envios pendentes, e deixa o progresso na altura do snapshot para o scan
+// continuar dali. Todo o payload é conferido antes de tocar o banco, então um
+// backup inválido deixa a carteira anterior intacta. Com replace, o conteúdo
+// atual é apagado em lotes (um cache de blocos grande não cabe numa transação
+// do Badger) e só então o backup é gravado; se a gravação falhar, basta
+// restaurar de novo.
+func Restore(db *storage.DB, payload *Payload, replace bool) (*models.WalletState, error) {
+	if len(payload.Descriptors) == 0 {
+		return nil, fmt.Errorf("backup sem descritores")
+	}
+	xprv, err := helpers.XprvFromDescriptor(payload.Descriptors[0])
+	if err != nil {
+		return nil, err
+	}
+
+	watchOnly, err := helpers.ExportWatchOnly(xprv)
+	if err != nil {
+		return nil, err
+	}
+	account := watchOnly.Account()
+
+	state := &models.WalletState{UTXOs: make(map[string]models.UTXO)}
+	if err := helpers.DeriveKeyPairs(xprv, payload.KeyCount, state); err != nil {
+		return nil, err
+	}
+	keyByAddress := make(map[string]int, len(state.Addresses))
+	for i := range state.PublicKeys {
+		program, err := helpers.GetP2WPKHProgram(state.PublicKeys[i], 0)
+		if err != nil {
+			return nil, err
+		}
+		state.WitnessPrograms = append(state.WitnessPrograms, program)
+		keyByAddress[state.Addresses[i][0]] = i
+	}
+
+	state.ChangeIndex = payload.ChangeIndex
+	state.Multisigs = payload.Multisigs
+	if _, err := helpers.DeriveChangeKeys(xprv, state); err != nil {
+		return nil, err
+	}
+
+	// Todo UTXO precisa pertencer às chaves derivadas e estar dentro do snapshot
+	for _, utxo := range payload.UTXOs {
+		if i, ok := keyByAddress[utxo.Address]; ok {
+			utxo.PrivateKey = state.PrivateKeys[i]
+		} else if key, ok := state.ChangeKey(utxo.Address); ok {
+			utxo.PrivateKey = key.PrivateKey
+		} else if _, ok := state.Multisig(utxo.Address); !ok {
+			return nil, fmt.Errorf("UTXO %s:%d não pertence às chaves do descritor", utxo.TxID, utxo.VoutIndex)
+		}
+		if utxo.Height > payload.Height {
+			return nil, fmt.Errorf("UTXO %s:%d na altura %d, acima do snapshot %d", utxo.TxID, utxo.VoutIndex, utxo.Height, payload.Height)
+		}
+		state.UTXOs[fmt.Sprintf("%s:%d", utxo.TxID, utxo.VoutIndex)] = utxo
+	}
+	if err := validate(payload); err != nil {
+		return nil, err
+	}
+
+	if replace {
+		if err := db.ClearAll(); err != nil {
+			return nil, fmt.Errorf("erro ao limpar o banco antes de restaurar: %w", err)
+		}
+	}
+	err = db.Update(func(txn storage.Txn) error {
+		found, err := storage.GetMeta(txn, storage.MetaProgress, new(int))
+		if err != nil {
+			return err
+		}
+		if found {
+			return fmt.Errorf("o banco já tem progresso salvo; use -force ou limpe-o com db clear --all antes de restaurar")
+		}
+		var stored models.Account
+		found, err = storage.GetMeta(txn, storage.MetaAccount, &stored)
+		if err != nil {
+			return err
+		}
+		if found && stored != account {
+			return fmt.Errorf("o banco é da conta de fingerprint %s, não da conta do backup (fingerprint %s); use -force para substituí-lo", stored.Fingerprint, account.Fingerprint)
+		}
+		if err := storage.PutMeta(txn, storage.MetaAccount, account); err != nil {
+			return err
+		}
+
+		for i := range state.PublicKeys {
+			if err := storage.PutDerivedKey(txn, state.Key(i)); err != nil {
+				return err
+			}
+		}
+		for _, key := range state.ChangeKeys {
+			if err := storage.PutDerivedKey(txn, key); err != nil {
+				return err
+			}
+		}
+		if err := storage.PutMeta(txn, storage.MetaChangeIndex, state.ChangeIndex); err != nil {
+			return err
+		}
+		for _, ms := range state.Multisigs {
+			if err := storage.PutMultisig(txn, ms); err != nil {
+				return err
+			}
+		}
+		for _, utxo := range state.UTXOs {
+			if err := storage.PutUTXO(txn, utxo); err != nil {
+				return err
+			}
+		}
+		for _, entry := range payload.Ledger {
+			if err := storage.PutLedgerEntry(txn, entry); err != nil {
+				return err
+			}
+		}
+		for _, output := range payload.Data {
+			if err := storage.PutDataOutput(txn, output); err != nil {
+				return err
+			}
+		}
+		for target, label := range payload.Labels {
+			if err := storage.PutLabel(txn, target, label); err != nil {
+				return err
+			}
+		}
+		for _, pending := range payload.Pending {
+			if err := storage.PutPending(txn, pending); err != nil {
+				return err
+			}
+		}
+		return storage.PutMeta(txn, storage.MetaProgress, payload.Height)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao restaurar backup: %w", err)
+	}
+	return state, nil
+}
+
+// validate confere os registros do payload que Restore grava sem derivar:
+// ledger, saídas OP_RETURN, multisigs e envios pendentes.
+func validate(payload *Payload) error {
+	for _, entry := range payload.Ledger {
+		if entry.Kind != models.LedgerReceive && entry.Kind != models.LedgerSpend {
+			return fmt.Errorf("lançamento %s com tipo desconhecido: %q", entry.Outpoint, entry.Kind)
+		}
+		if entry.Outpoint == "" || entry.TxID == "" {
+			return fmt.Errorf("lançamento na altura %d sem outpoint ou txid", entry.Height)
+		}
+		if entry.Height > payload.Height {
+			return fmt.Errorf("lançamento %s na altura %d, acima do snapshot %d", entry.Outpoint, entry.Height, payload.Height)
+		}
+	}
+	for _, output := range payload.Data {
+		if output.Height > payload.Height {
+			return fmt.Errorf("saída OP_RETURN %s:%d na altura %d, acima do snapshot %d", output.TxID, output.Index, output.Height, payload.Height)
+		}
+	}
+	for _, ms := range payload.Multisigs {
+		if !bytes.Equal(helpers.P2WSHProgram(ms.WitnessScript), ms.WitnessProgram) {
+			return fmt.Errorf("multisig %s com witness program que não confere com o script", ms.Address)
+		}
+	}
+	for _, pending := range payload.Pending {
+		tx, err := helpers.DecodeTransaction(pending.RawTx)
+		if err != nil {
+			return fmt.Errorf("envio pendente %s: %w", pending.TxID, err)
+		}
+		if txid := helpers.TxID(tx); txid != pending.TxID {
+			return fmt.Errorf("envio pendente %s com transação de txid %s", pending.TxID, txid)
+		}
+	}
+	return nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao derivar chave do backup: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"wallet/internal/storage"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const testXprv = "tprv8ZgxMBicQKsPdt2JSGYoFa3bag1DMeGF8zdJC3ECLwCbUWdoZMq2wkqrN3zMaY9ep1RpD6yqLLmPohMgptXQ56YHr5NBLoUoXxLv97MjDcz"
+
+// testPayload é um backup mínimo com um envio pendente.
+func testPayload(t *testing.T) *Payload {
+	t.Helper()
+	hash, _ := chainhash.NewHashFromStr("1111111111111111111111111111111111111111111111111111111111111111")
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x00, 0x14, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	return &Payload{
+		Descriptors: []string{helpers.WalletDescriptor(testXprv), helpers.WalletChangeDescriptor(testXprv)},
+		KeyCount:    3,
+		Height:      10,
+		Ledger:      []models.LedgerEntry{{Height: 5, Kind: models.LedgerReceive, TxID: "aa", Outpoint: "aa:0"}},
+		Labels:      map[string]string{"aa:0": "teste"},
+		Pending:     []models.PendingTx{helpers.NewPendingTx(tx, 200)},
+	}
+}
+
+func TestWriteReadRestoreCollect(t *testing.T) {
+	payload := testPayload(t)
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := Write(path, payload, "senha"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path, "senha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, "errada"); err == nil {
+		t.Fatal("Read com senha errada não falhou")
+	}
+
+	db := storage.NewMemoryDB()
+	if _, err := Restore(db, read, false); err != nil {
+		t.Fatal(err)
+	}
+	collected, err := Collect(db, testXprv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(collected.Pending, payload.Pending) {
+		t.Fatalf("pendentes %v, esperava %v", collected.Pending, payload.Pending)
+	}
+	if !reflect.DeepEqual(collected.Ledger, payload.Ledger) || collected.Height != payload.Height {
+		t.Fatalf("ledger %v na altura %d, esperava %v na %d", collected.Ledger, collected.Height, payload.Ledger, payload.Height)
+	}
+
+	// Sem replace, um banco com progresso é recusado
+	if _, err := Restore(db, read, false); err == nil {
+		t.Fatal("Restore sobre progresso salvo não falhou")
+	}
+
+	// Sem replace, um banco de outra conta é recusado mesmo sem progresso
+	other := storage.NewMemoryDB()
+	if err := other.Update(func(txn storage.Txn) error {
+		return storage.PutMeta(txn, storage.MetaAccount, models.Account{XPub: "tpub", Fingerprint: "00000000"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(other, read, false); err == nil {
+		t.Fatal("Restore sobre banco de outra conta não falhou")
+	}
+}
+
+func TestRestoreInvalidPayloadKeepsWallet(t *testing.T) {
+	db := storage.NewMemoryDB()
+	if _, err := Restore(db, testPayload(t), false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(p *Payload)
+	}{
+		{"lançamento de tipo desconhecido", func(p *Payload) { p.Ledger[0].Kind = "x" }},
+		{"lançamento acima do snapshot", func(p *Payload) { p.Ledger[0].Height = 11 }},
+		{"pendente com txid errado", func(p *Payload) { p.Pending[0].TxID = "bb" }},
+		{"pendente que não decodifica", func(p *Payload) { p.Pending[0].RawTx = "zz" }},
+		{"UTXO fora das chaves", func(p *Payload) {
+			p.UTXOs = []models.UTXO{{TxID: "cc", Address: "tb1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"}}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := testPayload(t)
+			payload.Labels = map[string]string{"dd:0": "novo"}
+			tc.corrupt(payload)
+			if _, err := Restore(db, payload, true); err == nil {
+				t.Fatal("Restore de payload inválido não falhou")
+			}
+
+			// A carteira anterior continua lá
+			var labels map[string]string
+			if err := db.View(func(txn storage.Txn) error {
+				var err error
+				labels, err = storage.ListLabels(txn)
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(labels, map[string]string{"aa:0": "teste"}) {
+				t.Fatalf("rótulos %v depois de restauração falha", labels)
+			}
+		})
+	}
+
+	// Com replace e payload válido, o conteúdo é trocado e o cache de blocos
+	// apagado
+	if err := db.StoreBlock(7, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	payload := testPayload(t)
+	payload.Labels = map[string]string{"dd:0": "novo"}
+	if _, err := Restore(db, payload, true); err != nil {
+		t.Fatal(err)
+	}
+	if heights, err := db.BlockHeights(); err != nil || len(heights) != 0 {
+		t.Fatalf("blocos %v em cache depois de restaurar (%v)", heights, err)
+	}
+	collected, err := Collect(db, testXprv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(collected.Labels, payload.Labels) {
+		t.Fatalf("rótulos %v, esperava %v", collected.Labels, payload.Labels)
+	}
+}
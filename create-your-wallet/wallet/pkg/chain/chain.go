@@ -0,0 +1,145 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HeaderSource retorna o cabeçalho já aceito na altura informada, ou nil sem
+// erro se ele não for conhecido (antes do início do scan, por exemplo).
+type HeaderSource func(height int) (*wire.BlockHeader, error)
+
+// Chain é a cadeia de cabeçalhos mantida pela carteira. Cada bloco é validado
+// contra o cabeçalho anterior antes de ser aceito.
+type Chain struct {
+	params  *Params
+	source  HeaderSource
+	headers map[int]*wire.BlockHeader // Cabeçalhos aceitos ou já lidos de source
+}
+
+// New cria uma Chain que busca em source os cabeçalhos aceitos em execuções anteriores.
+func New(params *Params, source HeaderSource) *Chain {
+	return &Chain{
+		params:  params,
+		source:  source,
+		headers: make(map[int]*wire.BlockHeader),
+	}
+}
+
+func (c *Chain) header(height int) (*wire.BlockHeader, error) {
+	if header, ok := c.headers[height]; ok {
+		return header, nil
+	}
+	if height < 0 || c.source == nil {
+		return nil, nil
+	}
+	header, err := c.source(height)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler cabeçalho %d: %w", height, err)
+	}
+	if header != nil {
+		c.headers[height] = header
+	}
+	return header, nil
+}
+
+// Validate confere o bloco (formato do getblock verbosity 2) na altura height:
+// hash do cabeçalho, encadeamento com o cabeçalho anterior, prova de trabalho,
+// dificuldade esperada e, na signet, a solução BIP325. Se o cabeçalho anterior
+// não é conhecido (primeiro bloco depois de um snapshot), o encadeamento e a
+// dificuldade não podem ser conferidos e o bloco vira a âncora da cadeia.
+// Só blocos válidos são acrescentados à cadeia.
+func (c *Chain) Validate(block map[string]interface{}, height int) (*wire.BlockHeader, error) {
+	header, err := HeaderFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := c.header(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		if prevHash := prev.BlockHash(); header.PrevBlock != prevHash {
+			return nil, fmt.Errorf("cabeçalho não encadeia: previousblockhash %s, bloco %d aceito é %s", header.PrevBlock, height-1, prevHash)
+		}
+	}
+
+	if err := CheckProofOfWork(header, c.params); err != nil {
+		return nil, err
+	}
+
+	expected, known, err := c.nextBits(height, header, prev)
+	if err != nil {
+		return nil, err
+	}
+	if known && header.Bits != expected {
+		return nil, fmt.Errorf("dificuldade inesperada: bits %08x, esperado %08x", header.Bits, expected)
+	}
+
+	if c.params.SignetChallenge != nil && height > 0 {
+		if err := CheckSignetSolution(block, header, c.params.SignetChallenge); err != nil {
+			return nil, err
+		}
+	}
+
+	c.headers[height] = header
+	return header, nil
+}
+
+// nextBits calcula os bits esperados para o bloco height, seguindo
+// GetNextWorkRequired do Bitcoin Core. Retorna known=false quando os
+// cabeçalhos necessários não estão na cadeia.
+func (c *Chain) nextBits(height int, header, prev *wire.BlockHeader) (uint32, bool, error) {
+	if prev == nil {
+		return 0, false, nil
+	}
+	p := c.params
+
+	if height%p.RetargetInterval != 0 {
+		if !p.ReduceMinDifficulty {
+			return prev.Bits, true, nil
+		}
+		// testnet/regtest: bloco atrasado pode usar a dificuldade mínima
+		if header.Timestamp.After(prev.Timestamp.Add(p.MinDiffReductionTime)) {
+			return p.PowLimitBits, true, nil
+		}
+		// Senão vale a dificuldade do último bloco que não usou a mínima
+		h, last := height-1, prev
+		for h%p.RetargetInterval != 0 && last.Bits == p.PowLimitBits {
+			h--
+			var err error
+			if last, err = c.header(h); err != nil || last == nil {
+				return 0, false, err
+			}
+		}
+		return last.Bits, true, nil
+	}
+
+	if p.NoRetargeting {
+		return prev.Bits, true, nil
+	}
+
+	first, err := c.header(height - p.RetargetInterval)
+	if err != nil || first == nil {
+		return 0, false, err
+	}
+	timespan := int64(p.TargetTimespan.Seconds())
+	actual := prev.Timestamp.Unix() - first.Timestamp.Unix()
+	if actual < timespan/4 {
+		actual = timespan / 4
+	}
+	if actual > timespan*4 {
+		actual = timespan * 4
+	}
+
+	target := CompactToBig(prev.Bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(timespan))
+	if target.Cmp(p.PowLimit) > 0 {
+		target.Set(p.PowLimit)
+	}
+	return BigToCompact(target), true, nil
+}
@@ -0,0 +1,164 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// easyParams tem o limite de prova de trabalho da regtest, para os testes
+// minerarem cabeçalhos na hora, e ajuste de dificuldade a cada 10 blocos.
+var easyParams = &Params{
+	Name:             "teste",
+	PowLimit:         chaincfg.RegressionNetParams.PowLimit,
+	PowLimitBits:     chaincfg.RegressionNetParams.PowLimitBits,
+	RetargetInterval: 10,
+	TargetTimespan:   100 * time.Minute,
+}
+
+// mine procura um nonce que satisfaça os bits do cabeçalho.
+func mine(t *testing.T, header *wire.BlockHeader) *wire.BlockHeader {
+	t.Helper()
+	for header.Nonce = 0; header.Nonce < 1000; header.Nonce++ {
+		if CheckProofOfWork(header, easyParams) == nil {
+			return header
+		}
+	}
+	t.Fatalf("nenhum nonce satisfaz bits %08x", header.Bits)
+	return nil
+}
+
+// blockFields monta os campos do getblock de um cabeçalho.
+func blockFields(header *wire.BlockHeader) map[string]interface{} {
+	return map[string]interface{}{
+		"version":           float64(header.Version),
+		"time":              float64(header.Timestamp.Unix()),
+		"nonce":             float64(header.Nonce),
+		"bits":              fmt.Sprintf("%08x", header.Bits),
+		"merkleroot":        header.MerkleRoot.String(),
+		"previousblockhash": header.PrevBlock.String(),
+		"hash":              header.BlockHash().String(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	anchor := mine(t, &wire.BlockHeader{Version: 1, Timestamp: start, Bits: easyParams.PowLimitBits})
+	next := func(prev *wire.BlockHeader, bits uint32) *wire.BlockHeader {
+		return &wire.BlockHeader{Version: 1, PrevBlock: prev.BlockHash(), Timestamp: prev.Timestamp.Add(10 * time.Minute), Bits: bits}
+	}
+
+	c := New(easyParams, func(height int) (*wire.BlockHeader, error) {
+		if height == 4 {
+			return anchor, nil
+		}
+		return nil, nil
+	})
+	good := mine(t, next(anchor, easyParams.PowLimitBits))
+	if _, err := c.Validate(blockFields(good), 5); err != nil {
+		t.Fatalf("bloco válido recusado: %v", err)
+	}
+	// O bloco aceito passa a ser o anterior do seguinte
+	if _, err := c.Validate(blockFields(mine(t, next(good, easyParams.PowLimitBits))), 6); err != nil {
+		t.Fatalf("bloco encadeado ao aceito recusado: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		block  func() map[string]interface{}
+		reason string
+	}{
+		{"não encadeia", func() map[string]interface{} {
+			return blockFields(mine(t, next(good, easyParams.PowLimitBits)))
+		}, "não encadeia"},
+		{"hash informado diferente", func() map[string]interface{} {
+			block := blockFields(mine(t, next(anchor, easyParams.PowLimitBits)))
+			block["nonce"] = block["nonce"].(float64) + 1
+			return block
+		}, "não confere"},
+		{"alvo acima do limite", func() map[string]interface{} {
+			return blockFields(next(anchor, 0x2100ffff))
+		}, "acima do limite"},
+		{"hash acima do alvo", func() map[string]interface{} {
+			return blockFields(next(anchor, 0x1d00ffff))
+		}, "acima do alvo"},
+		{"dificuldade inesperada", func() map[string]interface{} {
+			return blockFields(mine(t, next(anchor, 0x203fffff)))
+		}, "dificuldade inesperada"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := c.Validate(tc.block(), 5)
+			if err == nil || !strings.Contains(err.Error(), tc.reason) {
+				t.Fatalf("erro %v, esperava %q", err, tc.reason)
+			}
+		})
+	}
+}
+
+func TestNextBits(t *testing.T) {
+	testnet := fromChaincfg("testnet", &chaincfg.TestNet3Params, false)
+	noMinDiff := *testnet
+	noMinDiff.ReduceMinDifficulty = false
+	const (
+		base     = 2016 * 10
+		minBits  = 0x1d00ffff
+		prevBits = 0x1c0ffff0
+	)
+	start := time.Unix(1600000000, 0)
+	at := func(bits uint32, offset time.Duration) *wire.BlockHeader {
+		return &wire.BlockHeader{Bits: bits, Timestamp: start.Add(offset)}
+	}
+
+	tests := []struct {
+		name    string
+		params  *Params
+		height  int
+		headers map[int]*wire.BlockHeader // height-1 é o anterior
+		header  *wire.BlockHeader
+		want    uint32
+		known   bool
+	}{
+		{"sem anterior", testnet, base + 5, nil, at(prevBits, 0), 0, false},
+		{"mantém a do anterior", &noMinDiff, base + 5,
+			map[int]*wire.BlockHeader{base + 4: at(prevBits, 0)}, at(prevBits, time.Hour), prevBits, true},
+		{"bloco atrasado usa a mínima", testnet, base + 5,
+			map[int]*wire.BlockHeader{base + 4: at(prevBits, 0)}, at(minBits, 21*time.Minute), minBits, true},
+		{"volta até o último sem a mínima", testnet, base + 5,
+			map[int]*wire.BlockHeader{base + 2: at(prevBits, 0), base + 3: at(minBits, 0), base + 4: at(minBits, 0)},
+			at(prevBits, time.Minute), prevBits, true},
+		{"volta para no ajuste", testnet, base + 2,
+			map[int]*wire.BlockHeader{base: at(minBits, 0), base + 1: at(minBits, 0)}, at(minBits, time.Minute), minBits, true},
+		{"volta sem o cabeçalho", testnet, base + 5,
+			map[int]*wire.BlockHeader{base + 4: at(minBits, 0)}, at(prevBits, time.Minute), 0, false},
+		{"ajuste no tempo esperado", testnet, base + 2016,
+			map[int]*wire.BlockHeader{base: at(prevBits, 0), base + 2015: at(prevBits, 14*24*time.Hour)}, at(prevBits, 0), prevBits, true},
+		{"ajuste limitado a 1/4 do alvo", testnet, base + 2016,
+			map[int]*wire.BlockHeader{base: at(prevBits, 0), base + 2015: at(prevBits, time.Hour)}, at(prevBits, 0), 0x1c03fffc, true},
+		{"ajuste limitado a 4x o alvo", testnet, base + 2016,
+			map[int]*wire.BlockHeader{base: at(prevBits, 0), base + 2015: at(prevBits, 1000*24*time.Hour)}, at(prevBits, 0), 0x1c3fffc0, true},
+		{"ajuste limitado ao limite da rede", testnet, base + 2016,
+			map[int]*wire.BlockHeader{base: at(minBits, 0), base + 2015: at(minBits, 1000*24*time.Hour)}, at(minBits, 0), minBits, true},
+		{"ajuste sem o primeiro do período", testnet, base + 2016,
+			map[int]*wire.BlockHeader{base + 2015: at(prevBits, 0)}, at(prevBits, 0), 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(tc.params, func(height int) (*wire.BlockHeader, error) {
+				return tc.headers[height], nil
+			})
+			prev, _ := c.header(tc.height - 1)
+			got, known, err := c.nextBits(tc.height, tc.header, prev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if known != tc.known || got != tc.want {
+				t.Fatalf("bits %08x (conhecido %t), esperava %08x (%t)", got, known, tc.want, tc.known)
+			}
+		})
+	}
+}
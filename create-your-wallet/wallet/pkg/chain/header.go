@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HeaderFromBlock monta o cabeçalho de 80 bytes a partir dos campos do
+// getblock e confere que ele tem o hash informado pelo nó.
+func HeaderFromBlock(block map[string]interface{}) (*wire.BlockHeader, error) {
+	version, ok := block["version"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("bloco sem version")
+	}
+	blockTime, ok := block["time"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("bloco sem time")
+	}
+	nonce, ok := block["nonce"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("bloco sem nonce")
+	}
+	bitsHex, ok := block["bits"].(string)
+	if !ok {
+		return nil, fmt.Errorf("bloco sem bits")
+	}
+	bits, err := strconv.ParseUint(bitsHex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bits inválido %q: %w", bitsHex, err)
+	}
+	merkleRoot, err := hashField(block, "merkleroot")
+	if err != nil {
+		return nil, err
+	}
+	// O bloco gênese não tem previousblockhash
+	prevBlock := &chainhash.Hash{}
+	if _, ok := block["previousblockhash"]; ok {
+		if prevBlock, err = hashField(block, "previousblockhash"); err != nil {
+			return nil, err
+		}
+	}
+	hash, err := hashField(block, "hash")
+	if err != nil {
+		return nil, err
+	}
+
+	header := &wire.BlockHeader{
+		Version:    int32(version),
+		PrevBlock:  *prevBlock,
+		MerkleRoot: *merkleRoot,
+		Timestamp:  time.Unix(int64(blockTime), 0),
+		Bits:       uint32(bits),
+		Nonce:      uint32(nonce),
+	}
+	if computed := header.BlockHash(); computed != *hash {
+		return nil, fmt.Errorf("hash do cabeçalho %s não confere com o informado %s", computed, hash)
+	}
+	return header, nil
+}
+
+func hashField(block map[string]interface{}, field string) (*chainhash.Hash, error) {
+	value, ok := block[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("bloco sem %s", field)
+	}
+	hash, err := chainhash.NewHashFromStr(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s inválido: %w", field, err)
+	}
+	return hash, nil
+}
+
+// CheckProofOfWork confere que o alvo codificado em bits está dentro do limite
+// da rede e que o hash do cabeçalho não passa do alvo.
+func CheckProofOfWork(header *wire.BlockHeader, params *Params) error {
+	target := CompactToBig(header.Bits)
+	if target.Sign() <= 0 {
+		return fmt.Errorf("alvo de dificuldade inválido (bits %08x)", header.Bits)
+	}
+	if target.Cmp(params.PowLimit) > 0 {
+		return fmt.Errorf("alvo acima do limite da rede %s (bits %08x)", params.Name, header.Bits)
+	}
+	hash := header.BlockHash()
+	if hashToBig(&hash).Cmp(target) > 0 {
+		return fmt.Errorf("hash %s acima do alvo (bits %08x)", hash, header.Bits)
+	}
+	return nil
+}
+
+// hashToBig interpreta o hash (little-endian) como número.
+func hashToBig(hash *chainhash.Hash) *big.Int {
+	buf := *hash
+	for i := 0; i < chainhash.HashSize/2; i++ {
+		buf[i], buf[chainhash.HashSize-1-i] = buf[chainhash.HashSize-1-i], buf[i]
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+// CompactToBig converte o formato compacto de bits (mantissa de 23 bits com
+// sinal e expoente em bytes) para o alvo completo.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	negative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+	if negative {
+		n = n.Neg(n)
+	}
+	return n
+}
+
+// BigToCompact converte um alvo para o formato compacto de bits.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Set(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// O bit 0x00800000 é o sinal: se a mantissa o usa, desloca um byte
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
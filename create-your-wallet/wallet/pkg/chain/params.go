@@ -0,0 +1,123 @@
+package chain
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// DefaultSignetChallenge é o desafio da signet pública, usado quando o
+// bitcoin.conf não define signetchallenge.
+const DefaultSignetChallenge = "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be430210359ef5021964fe22d6f8e05b2463c9540ce96883fe3b278760f048f5189f2e6c452ae"
+
+// Params são as regras de consenso dos cabeçalhos de uma rede.
+type Params struct {
+	Name                 string
+	PowLimit             *big.Int
+	PowLimitBits         uint32
+	RetargetInterval     int           // Blocos entre ajustes de dificuldade
+	TargetTimespan       time.Duration // Tempo esperado para RetargetInterval blocos
+	ReduceMinDifficulty  bool          // testnet/regtest: dificuldade mínima após MinDiffReductionTime sem blocos
+	MinDiffReductionTime time.Duration
+	NoRetargeting        bool   // regtest: a dificuldade nunca é ajustada
+	SignetChallenge      []byte // Script que a solução BIP325 de cada bloco precisa satisfazer
+}
+
+// NewParams retorna as regras da rede usada pelo bitcoin-cli (signet, testnet
+// ou regtest). Na signet o desafio vem de config/bitcoin.conf.
+func NewParams(network string) (*Params, error) {
+	switch network {
+	case helpers.NetworkSignet:
+		challenge, err := ReadSignetChallenge(filepath.Join(helpers.GetConfigBasePath(), "config", "bitcoin.conf"))
+		if err != nil {
+			return nil, err
+		}
+		powLimit, _ := new(big.Int).SetString("00000377ae000000000000000000000000000000000000000000000000000000", 16)
+		return &Params{
+			Name:             network,
+			PowLimit:         powLimit,
+			PowLimitBits:     0x1e0377ae,
+			RetargetInterval: 2016,
+			TargetTimespan:   14 * 24 * time.Hour,
+			SignetChallenge:  challenge,
+		}, nil
+	case helpers.NetworkTestnet:
+		return fromChaincfg(network, &chaincfg.TestNet3Params, false), nil
+	case helpers.NetworkRegtest:
+		return fromChaincfg(network, &chaincfg.RegressionNetParams, true), nil
+	default:
+		return nil, fmt.Errorf("rede desconhecida: %s", network)
+	}
+}
+
+func fromChaincfg(name string, p *chaincfg.Params, noRetargeting bool) *Params {
+	return &Params{
+		Name:                 name,
+		PowLimit:             p.PowLimit,
+		PowLimitBits:         p.PowLimitBits,
+		RetargetInterval:     int(p.TargetTimespan / p.TargetTimePerBlock),
+		TargetTimespan:       p.TargetTimespan,
+		ReduceMinDifficulty:  p.ReduceMinDifficulty,
+		MinDiffReductionTime: p.MinDiffReductionTime,
+		NoRetargeting:        noRetargeting,
+	}
+}
+
+// ReadSignetChallenge lê signetchallenge do bitcoin.conf, na seção [signet] ou
+// fora de seções. Sem a opção (ou sem o arquivo), retorna o desafio da signet
+// pública. Um valor que não é hex, como o marcador "xxxxxxx" do bitcoin.conf
+// de exemplo, também cai no desafio público, com um aviso.
+func ReadSignetChallenge(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return hex.DecodeString(DefaultSignetChallenge)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir %s: %w", path, err)
+	}
+	defer file.Close()
+
+	section := ""
+	value := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "signetchallenge" {
+			continue
+		}
+		if section == "" || section == helpers.NetworkSignet {
+			value = strings.TrimSpace(val)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+
+	if value == "" {
+		return hex.DecodeString(DefaultSignetChallenge)
+	}
+	challenge, err := hex.DecodeString(value)
+	if err != nil || len(challenge) == 0 {
+		fmt.Printf("Aviso: signetchallenge inválido em %s (%q); usando o desafio da signet pública\n", path, value)
+		return hex.DecodeString(DefaultSignetChallenge)
+	}
+	return challenge, nil
+}
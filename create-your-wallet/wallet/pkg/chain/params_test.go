@@ -0,0 +1,44 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSignetChallenge(t *testing.T) {
+	public, _ := hex.DecodeString(DefaultSignetChallenge)
+	custom := []byte{0x51}
+
+	tests := []struct {
+		name string
+		conf string // Conteúdo do bitcoin.conf; vazio = arquivo ausente
+		want []byte
+	}{
+		{"sem arquivo", "", public},
+		{"sem a opção", "signet=1\nrpcuser=x\n", public},
+		{"marcador do arquivo de exemplo", "signet=1\nsignetchallenge=xxxxxxx\n", public},
+		{"desafio próprio", "signetchallenge=51\n", custom},
+		{"desafio na seção signet", "[signet]\nsignetchallenge=51 # comentário\n", custom},
+		{"desafio de outra seção", "[test]\nsignetchallenge=51\n", public},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bitcoin.conf")
+			if tc.conf != "" {
+				if err := os.WriteFile(path, []byte(tc.conf), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ReadSignetChallenge(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Fatalf("desafio %x, esperava %x", got, tc.want)
+			}
+		})
+	}
+}
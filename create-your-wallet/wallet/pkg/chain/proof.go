@@ -0,0 +1,201 @@
+package chain
+
+import (
+	"bytes"
+	"fmt"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// As provas seguem o formato CMerkleBlock do Bitcoin Core (o mesmo do
+// gettxoutproof e da mensagem merkleblock da rede): cabeçalho, total de
+// transações do bloco e a árvore de merkle parcial em hashes e bits de flag.
+
+// BuildMerkleBlock monta a prova de que as transações em match estão no bloco
+// cujo cabeçalho é header e cujos txids, em ordem, são txids.
+func BuildMerkleBlock(header *wire.BlockHeader, txids []string, match map[string]bool) ([]byte, error) {
+	if len(txids) == 0 {
+		return nil, fmt.Errorf("bloco sem transações")
+	}
+	tree := &partialTree{total: len(txids)}
+	for _, txid := range txids {
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, fmt.Errorf("txid inválido %q: %w", txid, err)
+		}
+		tree.leaves = append(tree.leaves, *hash)
+		tree.matched = append(tree.matched, match[txid])
+	}
+	tree.build(tree.height(), 0)
+
+	msg := wire.MsgMerkleBlock{
+		Header:       *header,
+		Transactions: uint32(len(txids)),
+		Flags:        make([]byte, (len(tree.bits)+7)/8),
+	}
+	for i := range tree.hashes {
+		msg.Hashes = append(msg.Hashes, &tree.hashes[i])
+	}
+	for i, bit := range tree.bits {
+		if bit {
+			msg.Flags[i/8] |= 1 << uint(i%8)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+		return nil, fmt.Errorf("erro ao serializar prova: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// VerifyMerkleBlock decodifica uma prova, reconstrói a raiz de merkle e confere
+// com a do cabeçalho. Retorna o cabeçalho e os txids provados.
+func VerifyMerkleBlock(raw []byte) (*wire.BlockHeader, []string, error) {
+	var msg wire.MsgMerkleBlock
+	r := bytes.NewReader(raw)
+	if err := msg.BtcDecode(r, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+		return nil, nil, fmt.Errorf("prova inválida: %w", err)
+	}
+	if r.Len() != 0 {
+		return nil, nil, fmt.Errorf("prova com %d bytes sobrando", r.Len())
+	}
+	if msg.Transactions == 0 {
+		return nil, nil, fmt.Errorf("prova de bloco sem transações")
+	}
+	if len(msg.Hashes) > int(msg.Transactions) {
+		return nil, nil, fmt.Errorf("prova com mais hashes que transações")
+	}
+	if len(msg.Flags)*8 < len(msg.Hashes) {
+		return nil, nil, fmt.Errorf("prova com menos bits de flag que hashes")
+	}
+
+	tree := &partialTree{total: int(msg.Transactions)}
+	for _, hash := range msg.Hashes {
+		tree.hashes = append(tree.hashes, *hash)
+	}
+	for i := 0; i < len(msg.Flags)*8; i++ {
+		tree.bits = append(tree.bits, msg.Flags[i/8]&(1<<uint(i%8)) != 0)
+	}
+
+	root, err := tree.extract(tree.height(), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Todos os hashes e todos os bytes de flag precisam ter sido usados
+	if (tree.bitsUsed+7)/8 != len(msg.Flags) || tree.hashesUsed != len(tree.hashes) {
+		return nil, nil, fmt.Errorf("prova com dados não utilizados")
+	}
+	if root != msg.Header.MerkleRoot {
+		return nil, nil, fmt.Errorf("raiz da prova %s difere da merkleroot do cabeçalho %s", root, msg.Header.MerkleRoot)
+	}
+
+	var txids []string
+	for _, leaf := range tree.leaves {
+		txids = append(txids, leaf.String())
+	}
+	return &msg.Header, txids, nil
+}
+
+// partialTree implementa CPartialMerkleTree. Na construção, leaves e matched
+// descrevem o bloco inteiro; na extração, leaves recebe os txids provados.
+type partialTree struct {
+	total   int
+	leaves  []chainhash.Hash
+	matched []bool
+
+	bits       []bool
+	hashes     []chainhash.Hash
+	bitsUsed   int
+	hashesUsed int
+}
+
+// width é o número de nós no nível height (0 = folhas).
+func (t *partialTree) width(height int) int {
+	return (t.total + (1 << uint(height)) - 1) >> uint(height)
+}
+
+// height é a altura da raiz.
+func (t *partialTree) height() int {
+	height := 0
+	for t.width(height) > 1 {
+		height++
+	}
+	return height
+}
+
+func hashPair(left, right chainhash.Hash) chainhash.Hash {
+	var hash chainhash.Hash
+	copy(hash[:], helpers.DoubleSHA256(append(left[:], right[:]...)))
+	return hash
+}
+
+// hash calcula o hash do nó (height, pos) a partir de todas as folhas.
+func (t *partialTree) hash(height, pos int) chainhash.Hash {
+	if height == 0 {
+		return t.leaves[pos]
+	}
+	left := t.hash(height-1, pos*2)
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		right = t.hash(height-1, pos*2+1)
+	}
+	return hashPair(left, right)
+}
+
+func (t *partialTree) build(height, pos int) {
+	// O nó é ancestral de alguma transação provada?
+	parentOfMatch := false
+	for p := pos << uint(height); p < (pos+1)<<uint(height) && p < t.total; p++ {
+		parentOfMatch = parentOfMatch || t.matched[p]
+	}
+	t.bits = append(t.bits, parentOfMatch)
+
+	if height == 0 || !parentOfMatch {
+		t.hashes = append(t.hashes, t.hash(height, pos))
+		return
+	}
+	t.build(height-1, pos*2)
+	if pos*2+1 < t.width(height-1) {
+		t.build(height-1, pos*2+1)
+	}
+}
+
+func (t *partialTree) extract(height, pos int) (chainhash.Hash, error) {
+	if t.bitsUsed >= len(t.bits) {
+		return chainhash.Hash{}, fmt.Errorf("prova com bits de flag insuficientes")
+	}
+	parentOfMatch := t.bits[t.bitsUsed]
+	t.bitsUsed++
+
+	if height == 0 || !parentOfMatch {
+		if t.hashesUsed >= len(t.hashes) {
+			return chainhash.Hash{}, fmt.Errorf("prova com hashes insuficientes")
+		}
+		hash := t.hashes[t.hashesUsed]
+		t.hashesUsed++
+		if height == 0 && parentOfMatch {
+			t.leaves = append(t.leaves, hash)
+		}
+		return hash, nil
+	}
+
+	left, err := t.extract(height-1, pos*2)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	right := left
+	if pos*2+1 < t.width(height-1) {
+		if right, err = t.extract(height-1, pos*2+1); err != nil {
+			return chainhash.Hash{}, err
+		}
+		// Ramos iguais permitiriam forjar transações duplicadas (CVE-2012-2459)
+		if right == left {
+			return chainhash.Hash{}, fmt.Errorf("prova com ramos idênticos")
+		}
+	}
+	return hashPair(left, right), nil
+}
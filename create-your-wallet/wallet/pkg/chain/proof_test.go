@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testBlock retorna n txids e um cabeçalho cuja merkleroot é a deles.
+func testBlock(t *testing.T, n int) (*wire.BlockHeader, []string) {
+	t.Helper()
+	var txids []string
+	for i := 0; i < n; i++ {
+		txids = append(txids, fmt.Sprintf("%064x", i+1))
+	}
+	root, err := helpers.MerkleRoot(txids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merkle, err := chainhash.NewHashFromStr(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wire.BlockHeader{Version: 4, MerkleRoot: *merkle, Bits: 0x207fffff}, txids
+}
+
+func TestMerkleBlockRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int
+		match []int // Posições provadas
+	}{
+		{"bloco de uma transação", 1, []int{0}},
+		{"par, a segunda", 2, []int{1}},
+		{"ímpar, a última", 3, []int{2}},
+		{"ímpar, nenhuma", 3, nil},
+		{"sete, várias", 7, []int{0, 3, 6}},
+		{"sete, todas", 7, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"oito, a do meio", 8, []int{4}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header, txids := testBlock(t, tc.total)
+			match := make(map[string]bool)
+			var want []string
+			for _, pos := range tc.match {
+				match[txids[pos]] = true
+				want = append(want, txids[pos])
+			}
+
+			raw, err := BuildMerkleBlock(header, txids, match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotHeader, got, err := VerifyMerkleBlock(raw)
+			if err != nil {
+				t.Fatalf("prova válida recusada: %v", err)
+			}
+			if gotHeader.BlockHash() != header.BlockHash() {
+				t.Fatalf("cabeçalho %s, esperava %s", gotHeader.BlockHash(), header.BlockHash())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("txids provados %v, esperava %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleBlockRejects(t *testing.T) {
+	header, txids := testBlock(t, 5)
+	raw, err := BuildMerkleBlock(header, txids, map[string]bool{txids[2]: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reencode altera a prova decodificada e a serializa de novo
+	reencode := func(t *testing.T, change func(msg *wire.MsgMerkleBlock)) []byte {
+		t.Helper()
+		var msg wire.MsgMerkleBlock
+		if err := msg.BtcDecode(bytes.NewReader(raw), wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+			t.Fatal(err)
+		}
+		change(&msg)
+		var buf bytes.Buffer
+		if err := msg.BtcEncode(&buf, wire.ProtocolVersion, wire.BaseEncoding); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name  string
+		proof func(t *testing.T) []byte
+	}{
+		{"bytes sobrando", func(t *testing.T) []byte {
+			return append(append([]byte{}, raw...), 0)
+		}},
+		{"byte de flag a mais", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Flags = append(msg.Flags, 0) })
+		}},
+		{"hash a mais", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Hashes = append(msg.Hashes, msg.Hashes[0]) })
+		}},
+		{"hash faltando", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Hashes = msg.Hashes[:len(msg.Hashes)-1] })
+		}},
+		{"hash adulterado", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Hashes[0][0] ^= 1 })
+		}},
+		{"merkleroot do cabeçalho trocada", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Header.MerkleRoot[0] ^= 1 })
+		}},
+		{"total de transações trocado", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Transactions = 9 })
+		}},
+		{"sem transações", func(t *testing.T) []byte {
+			return reencode(t, func(msg *wire.MsgMerkleBlock) { msg.Transactions = 0 })
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := VerifyMerkleBlock(tc.proof(t)); err == nil {
+				t.Fatal("prova inválida aceita")
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleBlockRejectsDuplicateBranches(t *testing.T) {
+	// Repetir a última transação de um bloco ímpar não muda a merkleroot
+	// (CVE-2012-2459); a prova que usa os dois ramos iguais é recusada
+	header, txids := testBlock(t, 3)
+	forged := append(append([]string{}, txids...), txids[2])
+	raw, err := BuildMerkleBlock(header, forged, map[string]bool{txids[2]: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyMerkleBlock(raw); err == nil {
+		t.Fatal("prova com transação duplicada aceita")
+	}
+}
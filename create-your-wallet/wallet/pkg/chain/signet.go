@@ -0,0 +1,233 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// signetHeader marca, dentro do compromisso de witness da coinbase, o push
+// que carrega a solução do bloco (BIP325).
+var signetHeader = []byte{0xec, 0xc7, 0xda, 0xa2}
+
+// witnessCommitmentHeader inicia o script OP_RETURN do compromisso de witness (BIP141).
+var witnessCommitmentHeader = []byte{txscript.OP_RETURN, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// signetVerifyFlags são as regras de script usadas para validar a solução,
+// as mesmas aplicadas pelo Bitcoin Core (P2SH, witness, DER e NULLDUMMY).
+const signetVerifyFlags = txscript.ScriptBip16 | txscript.ScriptVerifyWitness |
+	txscript.ScriptVerifyDERSignatures | txscript.ScriptStrictMultiSig
+
+// CheckSignetSolution valida a solução BIP325 do bloco contra o desafio da
+// signet: o bloco precisa "assinar" uma transação virtual que gasta o script
+// do desafio, com a solução tirada do compromisso de witness da coinbase.
+func CheckSignetSolution(block map[string]interface{}, header *wire.BlockHeader, challenge []byte) error {
+	txList, ok := block["tx"].([]interface{})
+	if !ok || len(txList) == 0 {
+		return fmt.Errorf("bloco sem transações")
+	}
+	coinbaseMap, ok := txList[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("coinbase sem dados decodificados (use getblock com verbosity 2)")
+	}
+	rawHex, ok := coinbaseMap["hex"].(string)
+	if !ok {
+		return fmt.Errorf("coinbase sem hex")
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return fmt.Errorf("hex da coinbase inválido: %w", err)
+	}
+	var coinbase wire.MsgTx
+	if err := coinbase.Deserialize(bytes.NewReader(raw)); err != nil {
+		return fmt.Errorf("erro ao decodificar coinbase: %w", err)
+	}
+
+	// O último output com o compromisso de witness é o que vale
+	commitment := -1
+	for i, out := range coinbase.TxOut {
+		if len(out.PkScript) >= 38 && bytes.HasPrefix(out.PkScript, witnessCommitmentHeader) {
+			commitment = i
+		}
+	}
+	if commitment < 0 {
+		return fmt.Errorf("coinbase sem compromisso de witness")
+	}
+
+	// Sem push de solução, a solução é vazia (desafios triviais como OP_TRUE)
+	script, solution, err := extractSolution(coinbase.TxOut[commitment].PkScript)
+	if err != nil {
+		return err
+	}
+	coinbase.TxOut[commitment].PkScript = script
+
+	// Raiz de merkle do bloco com a coinbase sem a solução
+	txids, err := helpers.BlockTxIDs(block)
+	if err != nil {
+		return err
+	}
+	txids[0] = coinbase.TxHash().String()
+	merkleHex, err := helpers.MerkleRoot(txids)
+	if err != nil {
+		return err
+	}
+	signetMerkle, err := chainhash.NewHashFromStr(merkleHex)
+	if err != nil {
+		return err
+	}
+
+	toSign, err := signetToSign(header, signetMerkle, challenge)
+	if err != nil {
+		return err
+	}
+	if err := decodeSolution(solution, toSign.TxIn[0]); err != nil {
+		return err
+	}
+
+	vm, err := txscript.NewEngine(challenge, toSign, 0, signetVerifyFlags, nil, txscript.NewTxSigHashes(toSign), 0)
+	if err != nil {
+		return fmt.Errorf("erro ao preparar validação da solução signet: %w", err)
+	}
+	if err := vm.Execute(); err != nil {
+		return fmt.Errorf("solução signet não satisfaz o desafio: %w", err)
+	}
+	return nil
+}
+
+// signetToSign monta a transação virtual to_sign do BIP325, ainda sem a
+// solução: ela gasta a to_spend, que compromete versão, bloco anterior, raiz
+// de merkle sem a solução e horário do cabeçalho com o script do desafio.
+func signetToSign(header *wire.BlockHeader, signetMerkle *chainhash.Hash, challenge []byte) (*wire.MsgTx, error) {
+	var blockData bytes.Buffer
+	binary.Write(&blockData, binary.LittleEndian, header.Version)
+	blockData.Write(header.PrevBlock[:])
+	blockData.Write(signetMerkle[:])
+	binary.Write(&blockData, binary.LittleEndian, uint32(header.Timestamp.Unix()))
+
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(blockData.Bytes()).Script()
+	if err != nil {
+		return nil, err
+	}
+	toSpend := wire.NewMsgTx(0)
+	toSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  sigScript,
+	})
+	toSpend.AddTxOut(wire.NewTxOut(0, challenge))
+
+	toSign := wire.NewMsgTx(0)
+	toSign.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash()}})
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return toSign, nil
+}
+
+// extractSolution procura no script do compromisso o primeiro push que começa
+// com signetHeader e tem dados depois dele. Retorna o script com esse push
+// reduzido ao cabeçalho, reescrito como o Bitcoin Core faz, e os dados da solução.
+func extractSolution(script []byte) ([]byte, []byte, error) {
+	var rebuilt, solution []byte
+	found := false
+
+	for pc := 0; pc < len(script); {
+		op := script[pc]
+		pc++
+
+		var size int
+		switch {
+		case op >= 0x01 && op <= 0x4b:
+			size = int(op)
+		case op == txscript.OP_PUSHDATA1 && pc+1 <= len(script):
+			size = int(script[pc])
+			pc++
+		case op == txscript.OP_PUSHDATA2 && pc+2 <= len(script):
+			size = int(binary.LittleEndian.Uint16(script[pc:]))
+			pc += 2
+		case op == txscript.OP_PUSHDATA4 && pc+4 <= len(script):
+			size = int(binary.LittleEndian.Uint32(script[pc:]))
+			pc += 4
+		case op == txscript.OP_PUSHDATA1 || op == txscript.OP_PUSHDATA2 || op == txscript.OP_PUSHDATA4:
+			return nil, nil, fmt.Errorf("push truncado no compromisso de witness")
+		default:
+			rebuilt = append(rebuilt, op)
+			continue
+		}
+		if size < 0 || pc+size > len(script) {
+			return nil, nil, fmt.Errorf("push truncado no compromisso de witness")
+		}
+		data := script[pc : pc+size]
+		pc += size
+
+		if !found && len(data) > len(signetHeader) && bytes.HasPrefix(data, signetHeader) {
+			solution = append([]byte{}, data[len(signetHeader):]...)
+			data = signetHeader
+			found = true
+		}
+		rebuilt = append(rebuilt, pushData(data)...)
+	}
+
+	if !found {
+		return script, nil, nil
+	}
+	return rebuilt, solution, nil
+}
+
+// pushData codifica um push com o menor opcode de tamanho, sem converter
+// valores pequenos em OP_1..OP_16 (como CScript << vector no Core).
+func pushData(data []byte) []byte {
+	n := len(data)
+	var out []byte
+	switch {
+	case n < txscript.OP_PUSHDATA1:
+		out = []byte{byte(n)}
+	case n <= 0xff:
+		out = []byte{txscript.OP_PUSHDATA1, byte(n)}
+	case n <= 0xffff:
+		out = []byte{txscript.OP_PUSHDATA2, 0, 0}
+		binary.LittleEndian.PutUint16(out[1:], uint16(n))
+	default:
+		out = []byte{txscript.OP_PUSHDATA4, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(out[1:], uint32(n))
+	}
+	return append(out, data...)
+}
+
+// decodeSolution lê da solução o scriptSig e a pilha de witness da entrada.
+// A solução precisa ser consumida por inteiro.
+func decodeSolution(solution []byte, in *wire.TxIn) error {
+	if len(solution) == 0 {
+		return nil
+	}
+	r := bytes.NewReader(solution)
+	sigScript, err := wire.ReadVarBytes(r, 0, uint32(len(solution)), "scriptSig")
+	if err != nil {
+		return fmt.Errorf("solução signet inválida: %w", err)
+	}
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return fmt.Errorf("solução signet inválida: %w", err)
+	}
+	if count > uint64(len(solution)) {
+		return fmt.Errorf("solução signet inválida: %d itens de witness", count)
+	}
+	witness := make(wire.TxWitness, 0, count)
+	for i := uint64(0); i < count; i++ {
+		item, err := wire.ReadVarBytes(r, 0, uint32(len(solution)), "witness")
+		if err != nil {
+			return fmt.Errorf("solução signet inválida: %w", err)
+		}
+		witness = append(witness, item)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("solução signet com %d bytes sobrando", r.Len())
+	}
+	in.SignatureScript = sigScript
+	in.Witness = witness
+	return nil
+}
@@ -0,0 +1,147 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// signetBlock monta um bloco signet de duas transações cuja solução BIP325,
+// gravada no compromisso de witness da coinbase, assina o desafio 1-de-1 de key.
+func signetBlock(t *testing.T, key *btcec.PrivateKey, challenge []byte) (map[string]interface{}, *wire.BlockHeader) {
+	t.Helper()
+	other := strings.Repeat("ab", 32)
+	commitment := func(push []byte) []byte {
+		script := append(append([]byte{}, witnessCommitmentHeader...), make([]byte, 32)...)
+		return append(script, pushData(push)...)
+	}
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex}, SignatureScript: []byte{0x01, 0x01}})
+	coinbase.AddTxOut(wire.NewTxOut(50e8, []byte{txscript.OP_TRUE}))
+	coinbase.AddTxOut(wire.NewTxOut(0, commitment(signetHeader)))
+
+	// A solução assina a raiz de merkle da coinbase sem ela
+	merkleHex, err := helpers.MerkleRoot([]string{coinbase.TxHash().String(), other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signetMerkle, _ := chainhash.NewHashFromStr(merkleHex)
+	prev, _ := chainhash.NewHashFromStr(strings.Repeat("00", 31) + "01")
+	header := &wire.BlockHeader{Version: 0x20000000, PrevBlock: *prev, Timestamp: time.Unix(1600000000, 0), Bits: 0x1e0377ae}
+	toSign, err := signetToSign(header, signetMerkle, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := txscript.RawTxInSignature(toSign, 0, challenge, txscript.SigHashAll, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(sig).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var solution bytes.Buffer
+	if err := wire.WriteVarBytes(&solution, 0, sigScript); err != nil {
+		t.Fatal(err)
+	}
+	if err := wire.WriteVarInt(&solution, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	coinbase.TxOut[1].PkScript = commitment(append(append([]byte{}, signetHeader...), solution.Bytes()...))
+
+	var raw bytes.Buffer
+	if err := coinbase.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	block := map[string]interface{}{
+		"tx": []interface{}{
+			map[string]interface{}{"txid": coinbase.TxHash().String(), "hex": hex.EncodeToString(raw.Bytes())},
+			other,
+		},
+	}
+	return block, header
+}
+
+func TestCheckSignetSolution(t *testing.T) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := txscript.NewScriptBuilder().AddOp(txscript.OP_1).
+		AddData(key.PubKey().SerializeCompressed()).AddOp(txscript.OP_1).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultChallenge, _ := hex.DecodeString(DefaultSignetChallenge)
+
+	block, header := signetBlock(t, key, challenge)
+	if err := CheckSignetSolution(block, header, challenge); err != nil {
+		t.Fatalf("solução válida recusada: %v", err)
+	}
+
+	// A mesma solução não satisfaz o desafio da signet pública
+	if err := CheckSignetSolution(block, header, defaultChallenge); err == nil {
+		t.Fatal("solução de outra chave aceita pelo desafio público")
+	}
+
+	// A assinatura cobre o horário do cabeçalho e as demais transações
+	later := *header
+	later.Timestamp = later.Timestamp.Add(time.Second)
+	if err := CheckSignetSolution(block, &later, challenge); err == nil {
+		t.Fatal("solução aceita com horário alterado")
+	}
+	swapped, _ := signetBlock(t, key, challenge)
+	swapped["tx"].([]interface{})[1] = strings.Repeat("cd", 32)
+	if err := CheckSignetSolution(swapped, header, challenge); err == nil {
+		t.Fatal("solução aceita com transação trocada")
+	}
+}
+
+func TestExtractSolution(t *testing.T) {
+	commitment := append(append([]byte{}, witnessCommitmentHeader...), make([]byte, 32)...)
+	long := bytes.Repeat([]byte{0x42}, 80)
+
+	tests := []struct {
+		name         string
+		script       []byte
+		wantScript   []byte
+		wantSolution []byte
+		wantErr      bool
+	}{
+		{"sem solução", commitment, commitment, nil, false},
+		{"só o cabeçalho, sem dados", append(append([]byte{}, commitment...), pushData(signetHeader)...), append(append([]byte{}, commitment...), pushData(signetHeader)...), nil, false},
+		{"solução curta", append(append([]byte{}, commitment...), pushData(append(append([]byte{}, signetHeader...), 0x01, 0x02))...),
+			append(append([]byte{}, commitment...), pushData(signetHeader)...), []byte{0x01, 0x02}, false},
+		{"solução em OP_PUSHDATA1", append(append([]byte{}, commitment...), pushData(append(append([]byte{}, signetHeader...), long...))...),
+			append(append([]byte{}, commitment...), pushData(signetHeader)...), long, false},
+		{"push truncado", append(append([]byte{}, commitment...), 0x05, 0x01), nil, nil, true},
+		{"OP_PUSHDATA2 sem tamanho", append(append([]byte{}, commitment...), txscript.OP_PUSHDATA2, 0x01), nil, nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script, solution, err := extractSolution(tc.script)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("script truncado aceito")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(script, tc.wantScript) || !bytes.Equal(solution, tc.wantSolution) {
+				t.Fatalf("script %x e solução %x, esperava %x e %x", script, solution, tc.wantScript, tc.wantSolution)
+			}
+		})
+	}
+}
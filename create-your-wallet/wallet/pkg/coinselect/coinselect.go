@@ -0,0 +1,280 @@
+package coinselect
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"wallet/pkg/models"
+)
+
+// Estratégias de seleção de entradas
+const (
+	StrategyAuto     = "auto"     // Roda todas e fica com a de menor waste
+	StrategyBnB      = "bnb"      // Branch-and-Bound: combinação exata, sem troco
+	StrategyKnapsack = "knapsack" // Aproximação aleatória do Bitcoin Core, com troco
+	StrategyLargest  = "largest"  // Maiores valores efetivos primeiro
+	StrategyOldest   = "oldest"   // UTXOs mais antigos primeiro
+)
+
+// Strategies lista as estratégias na ordem de preferência em caso de empate no waste.
+var Strategies = []string{StrategyBnB, StrategyKnapsack, StrategyLargest, StrategyOldest}
+
+// IsStrategy indica se name é uma estratégia conhecida (incluindo auto).
+func IsStrategy(name string) bool {
+	if name == StrategyAuto {
+		return true
+	}
+	for _, s := range Strategies {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Pesos (weight units) usados nas estimativas de tamanho
+const (
+	TxOverheadWeight      = 4*(4+1+1+4) + 2 // version, contagens de vin/vout, locktime + marker/flag segwit
+	P2WPKHInputWeight     = 4*(36+1+4) + (1 + 1 + 72 + 1 + 33)
+	P2TRInputWeight       = 4*(36+1+4) + (1 + 1 + 64)
+	P2SHP2WPKHInputWeight = 4*(36+1+23+4) + (1 + 1 + 72 + 1 + 33)
+	P2PKHInputWeight      = 4 * (36 + 1 + 1 + 72 + 1 + 33 + 4)
+	P2WPKHOutputWeight    = 4 * (8 + 1 + 22)
+
+	// DustLimit é o menor troco P2WPKH aceito pela política padrão de relay
+	DustLimit = 294
+)
+
+// DefaultLongTermFeeRate é a taxa (sat/vB) esperada para gastar o troco no futuro.
+const DefaultLongTermFeeRate = 10.0
+
+// Coin é um UTXO candidato com o valor em satoshis e o peso da entrada que o gasta.
+type Coin struct {
+	Outpoint string
+	UTXO     models.UTXO
+	Value    int64
+	Weight   int
+}
+
+// NewCoin cria o candidato, estimando o peso da entrada pelo scriptPubKey ou,
+// em UTXOs multisig, pelo witness script.
+func NewCoin(outpoint string, utxo models.UTXO) (Coin, error) {
+	weight, err := InputWeight(utxo.ScriptPubKey)
+	if len(utxo.WitnessScript) > 0 {
+		weight, err = P2WSHMultisigInputWeight(utxo.WitnessScript)
+	}
+	if err != nil {
+		return Coin{}, fmt.Errorf("%s: %w", outpoint, err)
+	}
+	return Coin{
+		Outpoint: outpoint,
+		UTXO:     utxo,
+		Value:    int64(math.Round(utxo.Value * 1e8)),
+		Weight:   weight,
+	}, nil
+}
+
+// InputWeight estima o peso de uma entrada que gasta script, com assinatura
+// DER de 72 bytes. Scripts cujo witness depende de dados que o scriptPubKey
+// não revela (P2WSH) não são suportados; veja P2WSHMultisigInputWeight.
+func InputWeight(script []byte) (int, error) {
+	switch {
+	case len(script) == 22 && script[0] == 0x00 && script[1] == 0x14:
+		return P2WPKHInputWeight, nil
+	case len(script) == 34 && script[0] == 0x51 && script[1] == 0x20:
+		return P2TRInputWeight, nil
+	case len(script) == 23 && script[0] == 0xa9 && script[1] == 0x14 && script[22] == 0x87:
+		// Assume P2SH-P2WPKH, o único P2SH que a carteira gera
+		return P2SHP2WPKHInputWeight, nil
+	case len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9:
+		return P2PKHInputWeight, nil
+	}
+	return 0, fmt.Errorf("tipo de script sem estimativa de peso: %x", script)
+}
+
+// P2WSHMultisigInputWeight estima o peso de uma entrada que gasta um P2WSH
+// m-de-n: dummy vazio do OP_CHECKMULTISIG, m assinaturas de 72 bytes e o
+// witness script.
+func P2WSHMultisigInputWeight(witnessScript []byte) (int, error) {
+	if len(witnessScript) < 3 || witnessScript[len(witnessScript)-1] != 0xae {
+		return 0, fmt.Errorf("witness script não é multisig: %x", witnessScript)
+	}
+	m := int(witnessScript[0]) - 0x50 // OP_1 a OP_16
+	if m < 1 || m > 16 {
+		return 0, fmt.Errorf("witness script multisig malformado: %x", witnessScript)
+	}
+	witness := compactSizeLen(m+2) + 1 + m*(1+72) + compactSizeLen(len(witnessScript)) + len(witnessScript)
+	return 4*(36+1+4) + witness, nil
+}
+
+// compactSizeLen é o tamanho do inteiro compact-size que codifica n.
+func compactSizeLen(n int) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
+
+// OutputWeight é o peso de uma saída com o scriptPubKey informado.
+func OutputWeight(script []byte) int {
+	return 4 * (8 + 1 + len(script))
+}
+
+// Params são os parâmetros de custo da seleção.
+type Params struct {
+	FeeRate           float64 // Taxa da transação em sat/vB
+	LongTermFeeRate   float64 // Taxa esperada no futuro, para o custo do troco e o waste
+	BaseWeight        int     // Peso da transação sem entradas e sem troco
+	ChangeWeight      int     // Peso da saída de troco
+	ChangeSpendWeight int     // Peso da entrada que gastará o troco
+}
+
+// fee é a taxa de weight unidades de peso à taxa rate, arredondada para cima.
+func fee(weight int, rate float64) int64 {
+	return int64(math.Ceil(float64(weight) * rate / 4))
+}
+
+func (p Params) fee(weight int) int64 {
+	return fee(weight, p.FeeRate)
+}
+
+// effectiveValue é o valor do coin descontada a taxa de gastá-lo.
+func (p Params) effectiveValue(c Coin) int64 {
+	return c.Value - p.fee(c.Weight)
+}
+
+// costOfChange é o custo de criar o troco agora e gastá-lo depois.
+func (p Params) costOfChange() int64 {
+	return p.fee(p.ChangeWeight) + fee(p.ChangeSpendWeight, p.LongTermFeeRate)
+}
+
+// Selection é o resultado de uma estratégia.
+type Selection struct {
+	Strategy string
+	Coins    []Coin
+	Total    int64 // Soma dos valores das entradas
+	Fee      int64 // Taxa paga, incluindo o excesso quando não há troco
+	Change   int64 // Valor do troco, 0 se não houver
+	Weight   int   // Peso estimado da transação
+	Waste    int64
+}
+
+// UTXOs retorna os UTXOs selecionados, na ordem das entradas.
+func (s *Selection) UTXOs() []models.UTXO {
+	utxos := make([]models.UTXO, len(s.Coins))
+	for i, c := range s.Coins {
+		utxos[i] = c.UTXO
+	}
+	return utxos
+}
+
+// finish monta a Selection para as entradas escolhidas, decidindo o troco.
+// O waste é o custo das entradas acima da taxa de longo prazo somado ao custo
+// do troco ou, sem troco, ao excesso entregue como taxa.
+func finish(strategy string, coins []Coin, target int64, p Params) *Selection {
+	s := &Selection{Strategy: strategy, Coins: coins}
+	inputWeight := 0
+	for _, c := range coins {
+		s.Total += c.Value
+		inputWeight += c.Weight
+	}
+	s.Weight = p.BaseWeight + inputWeight
+	s.Waste = p.fee(inputWeight) - fee(inputWeight, p.LongTermFeeRate)
+
+	change := s.Total - target - p.fee(s.Weight+p.ChangeWeight)
+	if change >= DustLimit {
+		s.Change = change
+		s.Weight += p.ChangeWeight
+		s.Fee = s.Total - target - change
+		s.Waste += p.costOfChange()
+		return s
+	}
+	s.Fee = s.Total - target
+	s.Waste += s.Fee - p.fee(s.Weight)
+	return s
+}
+
+// Select escolhe entradas de coins que paguem target satoshis mais a taxa.
+// Os candidatos são ordenados por outpoint antes da seleção, de modo que o
+// resultado não dependa da ordem de entrada.
+func Select(strategy string, coins []Coin, target int64, p Params) (*Selection, error) {
+	if target <= 0 {
+		return nil, fmt.Errorf("valor a enviar deve ser positivo")
+	}
+	if p.LongTermFeeRate == 0 {
+		p.LongTermFeeRate = DefaultLongTermFeeRate
+	}
+	if p.ChangeWeight == 0 {
+		p.ChangeWeight = P2WPKHOutputWeight
+	}
+	if p.ChangeSpendWeight == 0 {
+		p.ChangeSpendWeight = P2WPKHInputWeight
+	}
+
+	// Coins que custam mais para gastar do que valem ficam de fora
+	pool := make([]Coin, 0, len(coins))
+	var available int64
+	for _, c := range coins {
+		if p.effectiveValue(c) > 0 {
+			pool = append(pool, c)
+			available += p.effectiveValue(c)
+		}
+	}
+	sort.Slice(pool, func(i, j int) bool { return pool[i].Outpoint < pool[j].Outpoint })
+
+	// Valor efetivo que as entradas precisam somar
+	required := target + p.fee(p.BaseWeight)
+	if available < required {
+		return nil, fmt.Errorf("saldo insuficiente: %d sat efetivos disponíveis, necessários %d", available, required)
+	}
+
+	if strategy != StrategyAuto {
+		selected, err := run(strategy, pool, required, p)
+		if err != nil {
+			return nil, err
+		}
+		if selected == nil {
+			return nil, fmt.Errorf("estratégia %s não encontrou solução", strategy)
+		}
+		return finish(strategy, selected, target, p), nil
+	}
+
+	var best *Selection
+	for _, name := range Strategies {
+		selected, err := run(name, pool, required, p)
+		if err != nil {
+			return nil, err
+		}
+		if selected == nil {
+			continue
+		}
+		s := finish(name, selected, target, p)
+		if best == nil || s.Waste < best.Waste || (s.Waste == best.Waste && len(s.Coins) < len(best.Coins)) {
+			best = s
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("nenhuma estratégia encontrou solução")
+	}
+	return best, nil
+}
+
+func run(strategy string, pool []Coin, required int64, p Params) ([]Coin, error) {
+	switch strategy {
+	case StrategyBnB:
+		return branchAndBound(pool, required, p), nil
+	case StrategyKnapsack:
+		return knapsack(pool, required, p), nil
+	case StrategyLargest:
+		return largestFirst(pool, required, p), nil
+	case StrategyOldest:
+		return oldestFirst(pool, required, p), nil
+	}
+	return nil, fmt.Errorf("estratégia de seleção desconhecida: %s", strategy)
+}
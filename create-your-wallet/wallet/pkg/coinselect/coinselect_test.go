@@ -0,0 +1,208 @@
+package coinselect
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"wallet/pkg/models"
+)
+
+// Parâmetros dos testes: 1 sat/vB, uma saída P2WPKH de pagamento
+var testParams = Params{
+	FeeRate:           1,
+	LongTermFeeRate:   DefaultLongTermFeeRate,
+	BaseWeight:        TxOverheadWeight + P2WPKHOutputWeight,
+	ChangeWeight:      P2WPKHOutputWeight,
+	ChangeSpendWeight: P2WPKHInputWeight,
+}
+
+// Taxa de gastar uma entrada P2WPKH a 1 sat/vB
+var inputFee = testParams.fee(P2WPKHInputWeight)
+
+// testCoin cria um coin P2WPKH com o valor efetivo informado a 1 sat/vB.
+func testCoin(t *testing.T, n int, effective int64, height int) Coin {
+	t.Helper()
+	script := append([]byte{0x00, 0x14}, make([]byte, 20)...)
+	script[2] = byte(n)
+	txid := fmt.Sprintf("%064x", n)
+	coin, err := NewCoin(txid+":0", models.UTXO{
+		TxID:         txid,
+		Value:        float64(effective+inputFee) / 1e8,
+		Height:       height,
+		ScriptPubKey: script,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return coin
+}
+
+// outpoints lista os outpoints selecionados em ordem, para comparação.
+func outpoints(coins []Coin) []string {
+	list := make([]string, 0, len(coins))
+	for _, c := range coins {
+		list = append(list, c.Outpoint)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func sameCoins(got, want []Coin) bool {
+	return fmt.Sprint(outpoints(got)) == fmt.Sprint(outpoints(want))
+}
+
+func TestBranchAndBound(t *testing.T) {
+	const required = 100000
+	upper := required + testParams.costOfChange()
+
+	tests := []struct {
+		name   string
+		values []int64 // Valores efetivos do pool
+		want   []int   // Índices esperados em values; nil = sem solução
+	}{
+		{"um coin exato, sem troco", []int64{required}, []int{0}},
+		{"dois coins exatos, o último completa", []int64{60000, 40000}, []int{0, 1}},
+		{"exato ao lado de um coin maior", []int64{500000, required}, []int{1}},
+		{"exato com o último coin de vários", []int64{70000, 20000, 30000}, []int{0, 2}},
+		{"dentro da janela do custo do troco", []int64{upper}, []int{0}},
+		{"acima da janela", []int64{upper + 1}, nil},
+		{"insuficiente", []int64{30000, 20000}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var pool, want []Coin
+			for i, v := range tc.values {
+				pool = append(pool, testCoin(t, i+1, v, 100))
+			}
+			for _, i := range tc.want {
+				want = append(want, pool[i])
+			}
+			got := branchAndBound(pool, required, testParams)
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("esperava sem solução, veio %v", outpoints(got))
+				}
+				return
+			}
+			if !sameCoins(got, want) {
+				t.Fatalf("seleção %v, esperava %v", outpoints(got), outpoints(want))
+			}
+		})
+	}
+}
+
+func TestKnapsack(t *testing.T) {
+	const required = 100000
+	withChange := required + testParams.fee(testParams.ChangeWeight) + DustLimit
+
+	tests := []struct {
+		name   string
+		values []int64
+		want   []int
+	}{
+		{"coin exato", []int64{300000, required, 50000}, []int{1}},
+		{"menores somam exatamente", []int64{60000, 40000, 500000}, []int{0, 1}},
+		{"menores insuficientes usam o menor maior", []int64{30000, 400000, 200000}, []int{2}},
+		{"menores com troco válido", []int64{withChange, 10000}, []int{0}},
+		{"insuficiente", []int64{30000, 20000}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var pool, want []Coin
+			for i, v := range tc.values {
+				pool = append(pool, testCoin(t, i+1, v, 100))
+			}
+			for _, i := range tc.want {
+				want = append(want, pool[i])
+			}
+			got := knapsack(pool, required, testParams)
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("esperava sem solução, veio %v", outpoints(got))
+				}
+				return
+			}
+			if !sameCoins(got, want) {
+				t.Fatalf("seleção %v, esperava %v", outpoints(got), outpoints(want))
+			}
+		})
+	}
+}
+
+func TestLargestAndOldestFirst(t *testing.T) {
+	const required = 100000
+	// Valores efetivos e alturas: o mais antigo é o menor
+	pool := []Coin{
+		testCoin(t, 1, 30000, 10),
+		testCoin(t, 2, 80000, 30),
+		testCoin(t, 3, 50000, 20),
+		testCoin(t, 4, 10000, 40),
+	}
+
+	tests := []struct {
+		name string
+		run  func([]Coin, int64, Params) []Coin
+		want []int
+	}{
+		{"largest", largestFirst, []int{1, 2}},
+		{"oldest", oldestFirst, []int{0, 2, 1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var want []Coin
+			for _, i := range tc.want {
+				want = append(want, pool[i])
+			}
+			got := tc.run(pool, required, testParams)
+			if !sameCoins(got, want) {
+				t.Fatalf("seleção %v, esperava %v", outpoints(got), outpoints(want))
+			}
+			if tc.run(pool, 1000000, testParams) != nil {
+				t.Fatal("esperava sem solução com saldo insuficiente")
+			}
+		})
+	}
+}
+
+func TestWaste(t *testing.T) {
+	const target = 100000
+	required := target + testParams.fee(testParams.BaseWeight)
+	exact := testCoin(t, 1, required, 100)
+	large := testCoin(t, 2, 10*required, 100)
+	pool := []Coin{exact, large}
+
+	// Sem troco, a taxa de 1 sat/vB abaixo da de longo prazo dá waste negativo
+	noChange := finish(StrategyBnB, []Coin{exact}, target, testParams)
+	if noChange.Change != 0 {
+		t.Fatalf("troco %d no gasto exato", noChange.Change)
+	}
+	wantWaste := testParams.fee(P2WPKHInputWeight) - fee(P2WPKHInputWeight, testParams.LongTermFeeRate)
+	if noChange.Waste != wantWaste {
+		t.Fatalf("waste sem troco %d, esperava %d", noChange.Waste, wantWaste)
+	}
+
+	// Com troco, o waste soma o custo de criar e gastar o troco
+	withChange := finish(StrategyLargest, []Coin{large}, target, testParams)
+	if withChange.Change == 0 {
+		t.Fatal("esperava troco")
+	}
+	if withChange.Waste != wantWaste+testParams.costOfChange() {
+		t.Fatalf("waste com troco %d, esperava %d", withChange.Waste, wantWaste+testParams.costOfChange())
+	}
+	if withChange.Total != withChange.Change+withChange.Fee+target {
+		t.Fatalf("total %d não fecha com troco %d e taxa %d", withChange.Total, withChange.Change, withChange.Fee)
+	}
+
+	// O modo auto fica com a solução de menor waste
+	best, err := Select(StrategyAuto, pool, target, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.Strategy != StrategyBnB || !sameCoins(best.Coins, []Coin{exact}) {
+		t.Fatalf("auto escolheu %s %v, esperava bnb com o coin exato", best.Strategy, outpoints(best.Coins))
+	}
+	if best.Waste >= withChange.Waste {
+		t.Fatalf("waste %d do auto não é menor que %d", best.Waste, withChange.Waste)
+	}
+}
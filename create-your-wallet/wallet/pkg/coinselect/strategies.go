@@ -0,0 +1,235 @@
+package coinselect
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Limite de nós visitados pelo Branch-and-Bound, como no Bitcoin Core
+const bnbMaxTries = 100000
+
+// Iterações da aproximação do knapsack, como no Bitcoin Core
+const knapsackIterations = 1000
+
+// Semente fixa do knapsack: a mesma carteira produz sempre a mesma seleção
+const knapsackSeed = 1
+
+// branchAndBound procura o conjunto cujo valor efetivo fica entre required e
+// required + custo do troco, dispensando a saída de troco, e entre as
+// soluções fica com a de menor waste. Retorna nil se não houver solução.
+func branchAndBound(pool []Coin, required int64, p Params) []Coin {
+	coins := append([]Coin(nil), pool...)
+	sort.SliceStable(coins, func(i, j int) bool {
+		return p.effectiveValue(coins[i]) > p.effectiveValue(coins[j])
+	})
+	values := make([]int64, len(coins))
+	inputWaste := make([]int64, len(coins))
+	var lookahead int64
+	for i, c := range coins {
+		values[i] = p.effectiveValue(c)
+		inputWaste[i] = p.fee(c.Weight) - fee(c.Weight, p.LongTermFeeRate)
+		lookahead += values[i]
+	}
+	upper := required + p.costOfChange()
+
+	var (
+		current             = make([]bool, len(coins))
+		best                []bool
+		bestWaste           int64
+		value, currentWaste int64
+	)
+	i := 0
+	for tries := 0; tries < bnbMaxTries; tries++ {
+		backtrack := false
+		// A solução é registrada antes de conferir o fim do pool, senão a que
+		// se completa com o último coin nunca seria vista
+		switch {
+		case value+lookahead < required, value > upper:
+			backtrack = true
+		case p.FeeRate > p.LongTermFeeRate && best != nil && currentWaste > bestWaste:
+			// Com taxa alta, mais entradas só aumentam o waste
+			backtrack = true
+		case value >= required:
+			waste := currentWaste + value - required
+			if best == nil || waste <= bestWaste {
+				best = append([]bool(nil), current...)
+				bestWaste = waste
+			}
+			backtrack = true
+		case i >= len(coins):
+			backtrack = true
+		}
+
+		if backtrack {
+			// Volta até o último coin incluído e tenta o ramo sem ele
+			i--
+			for i >= 0 && !current[i] {
+				lookahead += values[i]
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			current[i] = false
+			value -= values[i]
+			currentWaste -= inputWaste[i]
+			i++
+			continue
+		}
+		lookahead -= values[i]
+		// Pular um coin igual ao anterior excluído explora o mesmo ramo
+		if i > 0 && !current[i-1] && values[i] == values[i-1] && coins[i].Weight == coins[i-1].Weight {
+			i++
+			continue
+		}
+		current[i] = true
+		value += values[i]
+		currentWaste += inputWaste[i]
+		i++
+	}
+
+	if best == nil {
+		return nil
+	}
+	var selected []Coin
+	for i, in := range best {
+		if in {
+			selected = append(selected, coins[i])
+		}
+	}
+	return selected
+}
+
+// knapsack segue o KnapsackSolver do Bitcoin Core sobre valores efetivos: usa
+// um coin que pague exatamente o necessário, ou todos os menores se somarem
+// exatamente, ou a melhor aproximação aleatória que deixe um troco válido,
+// comparada com o menor coin que sozinho cobre o valor.
+func knapsack(pool []Coin, required int64, p Params) []Coin {
+	// Com troco, as entradas também pagam a saída de troco e um troco mínimo
+	withChange := required + p.fee(p.ChangeWeight) + DustLimit
+
+	var smaller []Coin
+	var lowestLarger *Coin
+	var smallerTotal int64
+	for i := range pool {
+		value := p.effectiveValue(pool[i])
+		switch {
+		case value == required:
+			return []Coin{pool[i]}
+		case value < withChange:
+			smaller = append(smaller, pool[i])
+			smallerTotal += value
+		case lowestLarger == nil || value < p.effectiveValue(*lowestLarger):
+			lowestLarger = &pool[i]
+		}
+	}
+
+	if smallerTotal == required {
+		return smaller
+	}
+	if smallerTotal < required {
+		if lowestLarger == nil {
+			return nil
+		}
+		return []Coin{*lowestLarger}
+	}
+
+	sort.SliceStable(smaller, func(i, j int) bool {
+		return p.effectiveValue(smaller[i]) > p.effectiveValue(smaller[j])
+	})
+	rng := rand.New(rand.NewSource(knapsackSeed))
+	best, bestValue := approximateBestSubset(rng, smaller, smallerTotal, required, p)
+	if bestValue != required && smallerTotal >= withChange {
+		best, bestValue = approximateBestSubset(rng, smaller, smallerTotal, withChange, p)
+	}
+
+	// O menor coin maior é preferível se a aproximação não chegou ao alvo
+	// ou se ele sozinho fica mais próximo
+	if lowestLarger != nil && ((bestValue != required && bestValue < withChange) || p.effectiveValue(*lowestLarger) <= bestValue) {
+		return []Coin{*lowestLarger}
+	}
+	if bestValue < required {
+		return nil
+	}
+	var selected []Coin
+	for i, in := range best {
+		if in {
+			selected = append(selected, smaller[i])
+		}
+	}
+	return selected
+}
+
+// approximateBestSubset procura, com inclusões aleatórias, o subconjunto de
+// menor valor que ainda alcança target.
+func approximateBestSubset(rng *rand.Rand, coins []Coin, total, target int64, p Params) ([]bool, int64) {
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	included := make([]bool, len(coins))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var value int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i := range coins {
+				// Primeira passada aleatória; a segunda inclui o que faltou
+				if included[i] || (pass == 0 && rng.Intn(2) == 0) {
+					continue
+				}
+				value += p.effectiveValue(coins[i])
+				included[i] = true
+				if value >= target {
+					reached = true
+					if value < bestValue {
+						bestValue = value
+						copy(best, included)
+					}
+					value -= p.effectiveValue(coins[i])
+					included[i] = false
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
+
+// accumulate inclui os coins na ordem dada até cobrir required.
+func accumulate(coins []Coin, required int64, p Params) []Coin {
+	var selected []Coin
+	var value int64
+	for _, c := range coins {
+		if value >= required {
+			break
+		}
+		selected = append(selected, c)
+		value += p.effectiveValue(c)
+	}
+	if value < required {
+		return nil
+	}
+	return selected
+}
+
+// largestFirst usa os coins de maior valor efetivo, minimizando o número de entradas.
+func largestFirst(pool []Coin, required int64, p Params) []Coin {
+	coins := append([]Coin(nil), pool...)
+	sort.SliceStable(coins, func(i, j int) bool {
+		return p.effectiveValue(coins[i]) > p.effectiveValue(coins[j])
+	})
+	return accumulate(coins, required, p)
+}
+
+// oldestFirst usa os coins confirmados há mais tempo, consolidando UTXOs antigos.
+func oldestFirst(pool []Coin, required int64, p Params) []Coin {
+	coins := append([]Coin(nil), pool...)
+	sort.SliceStable(coins, func(i, j int) bool {
+		return coins[i].UTXO.Height < coins[j].UTXO.Height
+	})
+	return accumulate(coins, required, p)
+}
@@ -9,9 +9,19 @@ import (
 	"strings"
 )
 
+// Redes aceitas pelo bitcoin-cli
+const (
+	NetworkSignet  = "signet"
+	NetworkTestnet = "testnet"
+	NetworkRegtest = "regtest"
+)
+
+// Network é a rede passada ao bitcoin-cli (-signet, -testnet ou -regtest).
+var Network = NetworkSignet
+
 func RunBitcoinCLI(command string, args ...string) (interface{}, error) {
 	configPath := filepath.Join(GetConfigBasePath(), "config", "bitcoin.conf")
-	cliArgs := append([]string{"-conf=" + configPath, "-signet", command}, args...)
+	cliArgs := append([]string{"-conf=" + configPath, "-" + Network, command}, args...)
 	cmd := exec.Command("bitcoin-cli", cliArgs...)
 
 	var out bytes.Buffer
@@ -33,3 +43,16 @@ func RunBitcoinCLI(command string, args ...string) (interface{}, error) {
 	// Se não for JSON, retorna a string
 	return output, nil
 }
+
+// SendRawTransaction transmite a transação em hex pelo nó e retorna o txid.
+func SendRawTransaction(rawTx string) (string, error) {
+	result, err := RunBitcoinCLI("sendrawtransaction", rawTx)
+	if err != nil {
+		return "", err
+	}
+	txid, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("resultado inesperado do sendrawtransaction: %v", result)
+	}
+	return txid, nil
+}
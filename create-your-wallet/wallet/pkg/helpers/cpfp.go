@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"wallet/pkg/coinselect"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// UnconfirmedUTXO retorna a saída vout de parent, uma transação ainda no
+// mempool, como UTXO da carteira com Height 0. O scan só registra UTXOs
+// confirmados e os envios comuns escolhem só entre eles; saídas não
+// confirmadas são gastas apenas pelo CPFP, que as pede explicitamente.
+func UnconfirmedUTXO(state *models.WalletState, parent *wire.MsgTx, vout int) (models.UTXO, error) {
+	txid := TxID(parent)
+	if vout < 0 || vout >= len(parent.TxOut) {
+		return models.UTXO{}, fmt.Errorf("%s tem %d saídas, sem a saída %d", txid, len(parent.TxOut), vout)
+	}
+	txOut := parent.TxOut[vout]
+	utxo, ok := walletUTXO(state, txOut.PkScript)
+	if !ok {
+		return models.UTXO{}, fmt.Errorf("saída %s:%d não pertence à carteira", txid, vout)
+	}
+	utxo.TxID = txid
+	utxo.VoutIndex = vout
+	utxo.Value = float64(txOut.Value) / 1e8
+	return utxo, nil
+}
+
+// CPFPResult descreve a transação filha montada por CPFP.
+type CPFPResult struct {
+	AncestorFee     int64   // Taxa da mãe e dos seus ancestrais no mempool, em satoshis
+	AncestorVSize   int     // Tamanho virtual da mãe e dos seus ancestrais
+	Fee             int64   // Taxa da filha em satoshis
+	Weight          int     // Peso estimado da filha
+	Output          int64   // Valor que volta para a carteira na saída da filha
+	Added           int     // Entradas confirmadas acrescentadas à não confirmada
+	PackageFeeRate  float64 // Taxa do pacote (ancestrais mais a filha) em sat/vB
+	ChildFeeRate    float64 // Taxa da filha sozinha em sat/vB
+	TargetFeeRate   float64 // Taxa pedida para o pacote em sat/vB
+	AncestorFeeRate float64 // Taxa dos ancestrais sem a filha em sat/vB
+}
+
+// CPFP monta e assina uma transação filha que gasta utxo, saída ainda não
+// confirmada de parent (veja UnconfirmedUTXO), e manda o valor para
+// destScript, um endereço da própria carteira. A taxa da filha leva o pacote
+// (parent, seus ancestrais no mempool e a filha) à taxa de options: como o
+// minerador avalia a filha junto com os ancestrais, ela paga o que falta a
+// eles. Se o valor de utxo não bastar, entradas de spendable (as maiores
+// primeiro) são acrescentadas. MaxFee limita a taxa da filha e MaxFeeRate a
+// do pacote, já que a da filha sozinha é alta por construção.
+func CPFP(utxo models.UTXO, parent *MempoolEntry, destScript []byte, options SendOptions, spendable map[string]models.UTXO) (*wire.MsgTx, *CPFPResult, error) {
+	result := &CPFPResult{
+		AncestorFee:   int64(math.Round(parent.Fees.Ancestor * 1e8)),
+		AncestorVSize: parent.AncestorSize,
+	}
+	if result.AncestorVSize <= 0 {
+		return nil, nil, fmt.Errorf("tamanho dos ancestrais inválido no mempool: %d", parent.AncestorSize)
+	}
+	result.AncestorFeeRate = float64(result.AncestorFee) / float64(result.AncestorVSize)
+
+	feeRate, err := ResolveFeeRate(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if feeRate <= result.AncestorFeeRate {
+		return nil, nil, fmt.Errorf("a mãe já paga %.3f sat/vB com os ancestrais, sem precisar de CPFP para %.3f sat/vB", result.AncestorFeeRate, feeRate)
+	}
+	result.TargetFeeRate = feeRate
+
+	outpoint := fmt.Sprintf("%s:%d", utxo.TxID, utxo.VoutIndex)
+	first, err := coinselect.NewCoin(outpoint, utxo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Entradas confirmadas que podem ser acrescentadas, das maiores para as menores
+	var extra []coinselect.Coin
+	for key, u := range spendable {
+		if key == outpoint {
+			continue
+		}
+		coin, err := coinselect.NewCoin(key, u)
+		if err != nil {
+			return nil, nil, err
+		}
+		extra = append(extra, coin)
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		if extra[i].Value != extra[j].Value {
+			return extra[i].Value > extra[j].Value
+		}
+		return extra[i].Outpoint < extra[j].Outpoint
+	})
+
+	// A filha cobre o que falta ao pacote e, no mínimo, a própria banda. O nó
+	// soma os tamanhos virtuais já arredondados de cada transação
+	requiredFee := func(weight int) int64 {
+		fee := FeeForWeight((result.AncestorVSize+VSize(weight))*4, feeRate) - result.AncestorFee
+		if min := FeeForWeight(weight, MinRelayFeeRate); fee < min {
+			fee = min
+		}
+		return fee
+	}
+
+	coins := []coinselect.Coin{first}
+	total := first.Value
+	var tx *wire.MsgTx
+	for {
+		tx = wire.NewMsgTx(2)
+		for _, coin := range coins {
+			txIn, err := spendInput(coin.UTXO, inputSequence(options))
+			if err != nil {
+				return nil, nil, err
+			}
+			tx.AddTxIn(txIn)
+		}
+		tx.AddTxOut(wire.NewTxOut(0, destScript))
+
+		result.Weight = TxWeight(tx)
+		result.Fee = requiredFee(result.Weight)
+		if output := total - result.Fee; output >= coinselect.DustLimit {
+			tx.TxOut[0].Value = output
+			result.Output = output
+			break
+		}
+		if result.Added == len(extra) {
+			return nil, nil, fmt.Errorf("saldo insuficiente para a taxa de %d sat da filha", result.Fee)
+		}
+		coins = append(coins, extra[result.Added])
+		total += extra[result.Added].Value
+		result.Added++
+	}
+	result.ChildFeeRate = float64(result.Fee) / float64(VSize(result.Weight))
+	result.PackageFeeRate = float64(result.AncestorFee+result.Fee) / float64(result.AncestorVSize+VSize(result.Weight))
+
+	if options.MaxFee > 0 && result.Fee > int64(math.Round(options.MaxFee*1e8)) {
+		return nil, nil, fmt.Errorf("taxa de %d sat acima do limite de %.8f BTC", result.Fee, options.MaxFee)
+	}
+	if options.MaxFeeRate > 0 && result.PackageFeeRate > options.MaxFeeRate {
+		return nil, nil, fmt.Errorf("taxa do pacote de %.3f sat/vB acima do limite de %.3f sat/vB", result.PackageFeeRate, options.MaxFeeRate)
+	}
+
+	prevouts := make([]models.UTXO, 0, len(coins))
+	for _, coin := range coins {
+		prevouts = append(prevouts, coin.UTXO)
+	}
+	for _, txIn := range tx.TxIn {
+		txIn.Witness = nil
+	}
+	complete, err := SignTransaction(tx, prevouts, options.Keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !complete {
+		return nil, nil, fmt.Errorf("faltam chaves para assinar todas as entradas da filha")
+	}
+	return tx, result, nil
+}
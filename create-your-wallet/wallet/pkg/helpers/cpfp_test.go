@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCPFPPackageFeeRate(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         int64   // Saída não confirmada gasta pela filha
+		extra         int64   // UTXO confirmado disponível; 0 = nenhum
+		ancestorFee   float64 // Em BTC, como no getmempoolentry
+		ancestorVSize int
+		options       SendOptions
+		wantErr       string
+		wantAdded     int
+	}{
+		{name: "mãe sozinha a 1 sat/vB", value: 50000, ancestorFee: 0.00000141, ancestorVSize: 141,
+			options: SendOptions{FeeRate: 10}},
+		{name: "mãe com ancestral", value: 50000, ancestorFee: 0.00000500, ancestorVSize: 400,
+			options: SendOptions{FeeRate: 25}},
+		{name: "saída pequena acrescenta entrada", value: 1000, extra: 50000, ancestorFee: 0.00000141, ancestorVSize: 141,
+			options: SendOptions{FeeRate: 10}, wantAdded: 1},
+		{name: "saída pequena sem entradas", value: 1000, ancestorFee: 0.00000141, ancestorVSize: 141,
+			options: SendOptions{FeeRate: 10}, wantErr: "saldo insuficiente"},
+		{name: "ancestrais já pagam a taxa", value: 50000, ancestorFee: 0.00002000, ancestorVSize: 141,
+			options: SendOptions{FeeRate: 10}, wantErr: "sem precisar de CPFP"},
+		{name: "acima da taxa absoluta máxima", value: 50000, ancestorFee: 0.00000141, ancestorVSize: 141,
+			options: SendOptions{FeeRate: 10, MaxFee: 0.00001}, wantErr: "acima do limite"},
+		{name: "tamanho dos ancestrais inválido", value: 50000, ancestorFee: 0.00000141,
+			options: SendOptions{FeeRate: 10}, wantErr: "tamanho dos ancestrais"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values := []int64{}
+			if tc.extra > 0 {
+				values = append(values, tc.extra)
+			}
+			state, spendable := testWallet(t, values...)
+			utxo := testUTXO(state, len(values), strings.Repeat("f", 64), tc.value)
+			utxo.Height = 0
+			parent := &MempoolEntry{AncestorSize: tc.ancestorVSize, Fees: MempoolFees{Ancestor: tc.ancestorFee}}
+			dest := state.ChangeKeys[0].WitnessProgram
+
+			tx, result, err := CPFP(utxo, parent, dest, tc.options, spendable)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("erro %v, esperava %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tx.TxIn[0].PreviousOutPoint.Hash.String() != utxo.TxID || result.Added != tc.wantAdded {
+				t.Fatalf("filha não gasta a saída da mãe primeiro ou acrescentou %d entradas", result.Added)
+			}
+			if len(tx.TxOut) != 1 || tx.TxOut[0].Value != result.Output {
+				t.Fatalf("saídas %v, esperava só %d sat para a carteira", tx.TxOut, result.Output)
+			}
+			var total int64 = tc.value + int64(result.Added)*tc.extra
+			if fee := total - result.Output; fee != result.Fee {
+				t.Fatalf("taxa paga %d, relatada %d", fee, result.Fee)
+			}
+
+			// A filha cobre o que falta ao pacote, somando tamanhos virtuais
+			// já arredondados como o nó
+			packageVSize := tc.ancestorVSize + VSize(result.Weight)
+			want := FeeForWeight(packageVSize*4, tc.options.FeeRate) - result.AncestorFee
+			if result.Fee != want {
+				t.Fatalf("taxa da filha %d, esperava %d", result.Fee, want)
+			}
+			if result.PackageFeeRate < tc.options.FeeRate {
+				t.Fatalf("pacote a %.3f sat/vB, abaixo de %.3f", result.PackageFeeRate, tc.options.FeeRate)
+			}
+			if result.ChildFeeRate <= result.PackageFeeRate {
+				t.Fatalf("filha a %.3f sat/vB não paga acima do pacote (%.3f)", result.ChildFeeRate, result.PackageFeeRate)
+			}
+			if weight := TxWeight(tx); weight > result.Weight {
+				t.Fatalf("peso assinado %d maior que o estimado %d", weight, result.Weight)
+			}
+		})
+	}
+}
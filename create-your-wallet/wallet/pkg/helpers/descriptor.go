@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Caminhos de derivação das chaves de recebimento e de troco da carteira
+const (
+	ReceivePath = "84h/1h/0h/0/*"
+	ChangePath  = "84h/1h/0h/1/*"
+)
+
+// WalletDescriptor retorna o descritor privado da carteira, no mesmo formato
+// fornecido pelo enunciado (sem checksum).
+func WalletDescriptor(xprv string) string {
+	return fmt.Sprintf("wpkh(%s/%s)", xprv, ReceivePath)
+}
+
+// WalletChangeDescriptor retorna o descritor privado das chaves de troco.
+func WalletChangeDescriptor(xprv string) string {
+	return fmt.Sprintf("wpkh(%s/%s)", xprv, ChangePath)
+}
+
+// XprvFromDescriptor extrai o xprv de um descritor gerado por WalletDescriptor.
+// O checksum (#...) é opcional e o caminho precisa ser ReceivePath.
+func XprvFromDescriptor(descriptor string) (string, error) {
+	desc := descriptor
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		desc = desc[:i]
+	}
+	if !strings.HasPrefix(desc, "wpkh(") || !strings.HasSuffix(desc, ")") {
+		return "", fmt.Errorf("descritor não suportado: %s", descriptor)
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(desc, "wpkh("), ")")
+	slash := strings.IndexByte(inner, '/')
+	if slash < 0 || inner[slash+1:] != ReceivePath {
+		return "", fmt.Errorf("caminho de derivação não suportado em %s (esperado /%s)", descriptor, ReceivePath)
+	}
+	return inner[:slash], nil
+}
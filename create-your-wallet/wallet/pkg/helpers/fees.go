@@ -0,0 +1,79 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Limites padrão de taxa dos envios
+const (
+	DefaultMaxFee     = 0.01   // Taxa absoluta máxima em BTC
+	DefaultMaxFeeRate = 1000.0 // Taxa máxima em sat/vB
+	MinRelayFeeRate   = 1.0    // Taxa mínima de relay em sat/vB
+)
+
+// EstimateSmartFee consulta o estimatesmartfee do nó para confirmação em até
+// confTarget blocos e retorna a taxa em sat/vB.
+func EstimateSmartFee(confTarget int) (float64, error) {
+	result, err := RunBitcoinCLI("estimatesmartfee", fmt.Sprint(confTarget))
+	if err != nil {
+		return 0, err
+	}
+	estimate, ok := result.(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("resposta inesperada do estimatesmartfee: %v", result)
+	}
+	// BTC/kvB; ausente quando o nó não tem dados suficientes
+	feeRate, ok := estimate["feerate"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("estimatesmartfee sem estimativa para %d blocos: %v", confTarget, estimate["errors"])
+	}
+	return feeRate * 1e8 / 1000, nil
+}
+
+// ResolveFeeRate retorna a taxa em sat/vB do envio: a informada em options ou,
+// sem ela, a estimativa do nó para options.ConfTarget, com FallbackFeeRate se
+// o nó não tiver estimativa. A taxa precisa estar entre a mínima de relay e
+// options.MaxFeeRate.
+func ResolveFeeRate(options SendOptions) (float64, error) {
+	feeRate := options.FeeRate
+	if feeRate == 0 {
+		if options.ConfTarget < 1 {
+			return 0, fmt.Errorf("informe a taxa em sat/vB ou o alvo de confirmação")
+		}
+		estimate, err := EstimateSmartFee(options.ConfTarget)
+		switch {
+		case err == nil:
+			feeRate = estimate
+		case options.FallbackFeeRate > 0:
+			fmt.Printf("Usando a taxa de fallback de %.3f sat/vB: %v\n", options.FallbackFeeRate, err)
+			feeRate = options.FallbackFeeRate
+		default:
+			return 0, err
+		}
+	}
+	if feeRate < MinRelayFeeRate {
+		return 0, fmt.Errorf("taxa de %.3f sat/vB abaixo da mínima de relay (%.0f sat/vB)", feeRate, MinRelayFeeRate)
+	}
+	if options.MaxFeeRate > 0 && feeRate > options.MaxFeeRate {
+		return 0, fmt.Errorf("taxa de %.3f sat/vB acima do limite de %.3f sat/vB", feeRate, options.MaxFeeRate)
+	}
+	return feeRate, nil
+}
+
+// TxWeight é o peso da transação: bytes sem witness contam 4, com witness 1.
+func TxWeight(tx *wire.MsgTx) int {
+	return len(SerializeTx(tx, false))*3 + len(SerializeTx(tx, true))
+}
+
+// VSize é o tamanho virtual (vbytes) de um peso.
+func VSize(weight int) int {
+	return (weight + 3) / 4
+}
+
+// FeeForWeight é a taxa em satoshis de weight unidades de peso a feeRate sat/vB.
+func FeeForWeight(weight int, feeRate float64) int64 {
+	return int64(math.Ceil(float64(weight) * feeRate / 4))
+}
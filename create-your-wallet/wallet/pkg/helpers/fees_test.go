@@ -0,0 +1,153 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"wallet/pkg/coinselect"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcutil"
+)
+
+func TestResolveFeeRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SendOptions
+		want    float64
+		wantErr string
+	}{
+		{"taxa informada", SendOptions{FeeRate: 12.5}, 12.5, ""},
+		{"taxa mínima de relay", SendOptions{FeeRate: MinRelayFeeRate}, MinRelayFeeRate, ""},
+		{"abaixo da mínima de relay", SendOptions{FeeRate: 0.5}, 0, "abaixo da mínima"},
+		{"no limite", SendOptions{FeeRate: 100, MaxFeeRate: 100}, 100, ""},
+		{"acima do limite", SendOptions{FeeRate: 101, MaxFeeRate: 100}, 0, "acima do limite"},
+		{"sem taxa nem alvo", SendOptions{}, 0, "alvo de confirmação"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveFeeRate(tc.options)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("erro %v, esperava %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("taxa %v (%v), esperava %v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVSizeAndFeeForWeight(t *testing.T) {
+	tests := []struct {
+		weight  int
+		feeRate float64
+		vsize   int
+		fee     int64
+	}{
+		{561, 1, 141, 141},
+		{564, 1, 141, 141},
+		{565, 1, 142, 142},
+		{565, 10, 142, 1413},
+		{438, 2.5, 110, 274},
+	}
+	for _, tc := range tests {
+		if vsize := VSize(tc.weight); vsize != tc.vsize {
+			t.Errorf("VSize(%d) = %d, esperava %d", tc.weight, vsize, tc.vsize)
+		}
+		if fee := FeeForWeight(tc.weight, tc.feeRate); fee != tc.fee {
+			t.Errorf("FeeForWeight(%d, %v) = %d, esperava %d", tc.weight, tc.feeRate, fee, tc.fee)
+		}
+	}
+}
+
+func TestCheckFeeCaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection coinselect.Selection
+		options   SendOptions
+		wantErr   bool
+	}{
+		{"sem limites", coinselect.Selection{Fee: 1e6, Weight: 400}, SendOptions{}, false},
+		{"taxa absoluta no limite", coinselect.Selection{Fee: 1000, Weight: 400}, SendOptions{MaxFee: 0.00001}, false},
+		{"taxa absoluta acima", coinselect.Selection{Fee: 1001, Weight: 400}, SendOptions{MaxFee: 0.00001}, true},
+		{"taxa por vbyte no limite", coinselect.Selection{Fee: 1000, Weight: 400}, SendOptions{MaxFeeRate: 10}, false},
+		{"excesso sem troco acima da taxa por vbyte", coinselect.Selection{Fee: 1001, Weight: 400}, SendOptions{MaxFeeRate: 10}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkFeeCaps(&tc.selection, tc.options); (err != nil) != tc.wantErr {
+				t.Fatalf("erro %v, esperava erro: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateTransactionFee(t *testing.T) {
+	many := make([]int64, 260)
+	for i := range many {
+		many[i] = 1000
+	}
+	tests := []struct {
+		name    string
+		values  []int64
+		amount  int64
+		feeRate float64
+		inputs  int // Mínimo de entradas esperado
+	}{
+		{"uma entrada", []int64{100000}, 50000, 5, 1},
+		{"várias entradas", []int64{30000, 30000, 30000}, 80000, 20, 3},
+		// Mais de 252 entradas: o contador de vin cresce 2 bytes além da estimativa
+		{"contador de vin de 3 bytes", many, 235000, 1, 253},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state, utxos := testWallet(t, tc.values...)
+			options := SendOptions{
+				Strategy:      coinselect.StrategyLargest,
+				FeeRate:       tc.feeRate,
+				ChangeAddress: state.ChangeKeys[0].Address,
+			}
+			rawTx, selection, complete, err := CreateTransaction(utxos, state.Addresses[len(tc.values)][0], float64(tc.amount)/1e8, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !complete {
+				t.Fatal("transação P2WPKH incompleta")
+			}
+			tx, err := DecodeTransaction(rawTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tx.TxIn) < tc.inputs {
+				t.Fatalf("%d entradas, esperava ao menos %d", len(tx.TxIn), tc.inputs)
+			}
+
+			// O peso estimado cobre o da transação assinada, calculado pelo btcd
+			weight := TxWeight(tx)
+			if oracle := int(blockchain.GetTransactionWeight(btcutil.NewTx(tx))); weight != oracle {
+				t.Fatalf("TxWeight %d, btcd calcula %d", weight, oracle)
+			}
+			if weight > selection.Weight {
+				t.Fatalf("peso assinado %d maior que o estimado %d", weight, selection.Weight)
+			}
+
+			var outTotal int64
+			for _, out := range tx.TxOut {
+				outTotal += out.Value
+			}
+			if fee := selection.Total - outTotal; fee != selection.Fee {
+				t.Fatalf("taxa paga %d, relatada %d", fee, selection.Fee)
+			}
+			if min := FeeForWeight(selection.Weight, tc.feeRate); selection.Fee < min {
+				t.Fatalf("taxa %d abaixo de %d para o peso %d", selection.Fee, min, selection.Weight)
+			}
+			// Com troco, o que sobra da estimativa volta para ele
+			if selection.Change > 0 && selection.Fee != FeeForWeight(selection.Weight, tc.feeRate) {
+				t.Fatalf("taxa %d com troco, esperava exatamente %d", selection.Fee, FeeForWeight(selection.Weight, tc.feeRate))
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"wallet/pkg/models"
 
+	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcutil/bech32"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"golang.org/x/crypto/ripemd160"
@@ -17,6 +18,9 @@ func GetPrivateKeyForAddress(state *models.WalletState, address string) ([]byte,
 			return state.PrivateKeys[i], true
 		}
 	}
+	if key, ok := state.ChangeKey(address); ok {
+		return key.PrivateKey, true
+	}
 	// Se não encontrado, retorna nil e false
 	return nil, false
 }
@@ -26,8 +30,6 @@ func GetP2WPKHProgram(pubKey []byte, version byte) ([]byte, error) {
 		return nil, fmt.Errorf("chave pública inválida: esperado 33 bytes, recebido %d bytes", len(pubKey))
 	}
 
-	fmt.Printf("Public Key (hex): %x\n", pubKey)
-
 	sha256Hash := sha256.Sum256(pubKey)
 	ripemdHasher := ripemd160.New()
 	_, err := ripemdHasher.Write(sha256Hash[:])
@@ -44,26 +46,162 @@ func GetP2WPKHProgram(pubKey []byte, version byte) ([]byte, error) {
 	return scriptPubKey, nil
 }
 
-func DeriveKeyPairs(xprv string, count int, state *models.WalletState) error {
+// DeriveAccountKey deriva a chave da conta no caminho /84h/1h/0h a partir do
+// xprv. No modo watch-only recebe a tpub da conta, já nesse caminho, e a
+// retorna como está: sem chave privada não há derivação hardened.
+func DeriveAccountKey(xprv string) (*hdkeychain.ExtendedKey, error) {
 	masterKey, err := hdkeychain.NewKeyFromString(xprv)
 	if err != nil {
-		return fmt.Errorf("erro ao parsear xprv: %w", err)
+		return nil, fmt.Errorf("erro ao parsear xprv: %w", err)
+	}
+	if !masterKey.IsPrivate() {
+		if masterKey.Depth() != uint8(len(AccountPath)) {
+			return nil, fmt.Errorf("chave pública de profundidade %d; o modo watch-only precisa da tpub da conta (84h/1h/0h)", masterKey.Depth())
+		}
+		return masterKey, nil
 	}
 
 	// Caminho de derivação: /84h/1h/0h
 	purposeKey, err := masterKey.Child(84 + hdkeychain.HardenedKeyStart)
 	if err != nil {
-		return fmt.Errorf("erro ao derivar propósito (84h): %w", err)
+		return nil, fmt.Errorf("erro ao derivar propósito (84h): %w", err)
 	}
 
 	coinTypeKey, err := purposeKey.Child(1 + hdkeychain.HardenedKeyStart) // Testnet (1h)
 	if err != nil {
-		return fmt.Errorf("erro ao derivar moeda (1h): %w", err)
+		return nil, fmt.Errorf("erro ao derivar moeda (1h): %w", err)
 	}
 
 	accountKey, err := coinTypeKey.Child(0 + hdkeychain.HardenedKeyStart) // Conta (0h)
 	if err != nil {
-		return fmt.Errorf("erro ao derivar conta (0h): %w", err)
+		return nil, fmt.Errorf("erro ao derivar conta (0h): %w", err)
+	}
+
+	return accountKey, nil
+}
+
+// AccountPath é o caminho da conta a partir da chave mestre: 84h/1h/0h.
+var AccountPath = []uint32{84 + hdkeychain.HardenedKeyStart, 1 + hdkeychain.HardenedKeyStart, 0 + hdkeychain.HardenedKeyStart}
+
+// KeyPath é o caminho completo de uma chave derivada: conta, branch e índice.
+func KeyPath(key models.DerivedKey) []uint32 {
+	return append(append([]uint32{}, AccountPath...), uint32(key.Branch), uint32(key.Index))
+}
+
+// MasterFingerprint são os 4 primeiros bytes do HASH160 da chave pública
+// mestre do xprv, que identificam a carteira nas origens de chave (BIP32).
+func MasterFingerprint(xprv string) ([4]byte, error) {
+	var fingerprint [4]byte
+	masterKey, err := hdkeychain.NewKeyFromString(xprv)
+	if err != nil {
+		return fingerprint, fmt.Errorf("erro ao parsear xprv: %w", err)
+	}
+	pubKey, err := masterKey.ECPubKey()
+	if err != nil {
+		return fingerprint, fmt.Errorf("erro ao extrair chave pública mestre: %w", err)
+	}
+	copy(fingerprint[:], btcutil.Hash160(pubKey.SerializeCompressed()))
+	return fingerprint, nil
+}
+
+// childKeyPair extrai a chave privada e a pública comprimida de uma chave
+// derivada; a privada é nil se a chave for só pública (watch-only).
+func childKeyPair(key *hdkeychain.ExtendedKey) ([]byte, []byte, error) {
+	if !key.IsPrivate() {
+		pubKey, err := key.ECPubKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("erro ao extrair chave pública: %w", err)
+		}
+		return nil, pubKey.SerializeCompressed(), nil
+	}
+	privKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao extrair chave privada: %w", err)
+	}
+	return privKey.Serialize(), privKey.PubKey().SerializeCompressed(), nil
+}
+
+// DerivePath deriva a partir do xprv mestre a chave do caminho, como os das
+// origens BIP32 de um PSBT, e retorna a chave privada e a pública comprimida.
+func DerivePath(xprv string, path []uint32) ([]byte, []byte, error) {
+	key, err := hdkeychain.NewKeyFromString(xprv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao parsear xprv: %w", err)
+	}
+	if !key.IsPrivate() {
+		return nil, nil, fmt.Errorf("assinar exige o xprv, não uma chave pública")
+	}
+	for _, index := range path {
+		if key, err = key.Child(index); err != nil {
+			return nil, nil, fmt.Errorf("erro na derivação do índice %d: %w", index, err)
+		}
+	}
+	return childKeyPair(key)
+}
+
+// ChangeLookahead é quantas chaves de troco ficam derivadas além da próxima a
+// ser usada, para que o scan reconheça trocos de transações feitas por outra
+// cópia da carteira.
+const ChangeLookahead = 100
+
+// DeriveChangeKeys deriva as chaves do branch interno /1/* até cobrir
+// state.ChangeIndex mais ChangeLookahead, acrescenta-as a state.ChangeKeys e
+// retorna as novas.
+func DeriveChangeKeys(xprv string, state *models.WalletState) ([]models.DerivedKey, error) {
+	want := state.ChangeIndex + ChangeLookahead
+	if len(state.ChangeKeys) >= want {
+		return nil, nil
+	}
+	accountKey, err := DeriveAccountKey(xprv)
+	if err != nil {
+		return nil, err
+	}
+	changeKey, err := accountKey.Child(models.BranchChange)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao derivar branch (1): %w", err)
+	}
+
+	var added []models.DerivedKey
+	for i := len(state.ChangeKeys); i < want; i++ {
+		childKey, err := changeKey.Child(uint32(i))
+		if err != nil {
+			return nil, fmt.Errorf("erro na derivação do troco %d: %w", i, err)
+		}
+		privKey, pubKey, err := childKeyPair(childKey)
+		if err != nil {
+			return nil, err
+		}
+		address, err := GenerateSegWitAddress(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao gerar endereço de troco: %w", err)
+		}
+		key := models.DerivedKey{
+			Branch:         models.BranchChange,
+			Index:          i,
+			PrivateKey:     privKey,
+			PublicKey:      pubKey,
+			Address:        address,
+			WitnessProgram: append([]byte{0x00, 0x14}, btcutil.Hash160(pubKey)...),
+		}
+		state.ChangeKeys = append(state.ChangeKeys, key)
+		added = append(added, key)
+	}
+	return added, nil
+}
+
+// NextChangeKey retorna a próxima chave de troco não usada, sem reservá-la.
+// As chaves precisam ter sido derivadas com DeriveChangeKeys.
+func NextChangeKey(state *models.WalletState) (models.DerivedKey, error) {
+	if state.ChangeIndex >= len(state.ChangeKeys) {
+		return models.DerivedKey{}, fmt.Errorf("chave de troco %d não derivada", state.ChangeIndex)
+	}
+	return state.ChangeKeys[state.ChangeIndex], nil
+}
+
+func DeriveKeyPairs(xprv string, count int, state *models.WalletState) error {
+	accountKey, err := DeriveAccountKey(xprv)
+	if err != nil {
+		return err
 	}
 
 	// Derivar chaves /0/* (recebimento)
@@ -78,19 +216,16 @@ func DeriveKeyPairs(xprv string, count int, state *models.WalletState) error {
 			return fmt.Errorf("erro na derivação do índice %d: %w", i, err)
 		}
 
-		// Chave privada
-		privKey, err := childKey.ECPrivKey()
+		// Chave privada (nil no modo watch-only) e chave pública
+		privKey, pubKey, err := childKeyPair(childKey)
 		if err != nil {
-			return fmt.Errorf("erro ao extrair chave privada: %w", err)
+			return err
 		}
-		state.PrivateKeys = append(state.PrivateKeys, privKey.Serialize())
-
-		// Chave pública
-		pubKey := privKey.PubKey()
-		state.PublicKeys = append(state.PublicKeys, pubKey.SerializeCompressed())
+		state.PrivateKeys = append(state.PrivateKeys, privKey)
+		state.PublicKeys = append(state.PublicKeys, pubKey)
 
 		// Gerar o endereço bech32
-		address, err := GenerateSegWitAddress(pubKey.SerializeCompressed())
+		address, err := GenerateSegWitAddress(pubKey)
 		if err != nil {
 			return fmt.Errorf("erro ao gerar endereço: %w", err)
 		}
@@ -0,0 +1,79 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// DoubleSHA256 é o hash usado em txids, blocos e na árvore de merkle.
+func DoubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// reverseBytes converte entre a ordem interna dos bytes de um hash e a ordem
+// exibida pelo bitcoin-cli (invertida).
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+// MerkleRoot calcula a raiz de merkle a partir dos txids de um bloco, em hex
+// na ordem do bitcoin-cli, como o campo "merkleroot" do getblock.
+func MerkleRoot(txids []string) (string, error) {
+	if len(txids) == 0 {
+		return "", fmt.Errorf("bloco sem transações")
+	}
+
+	level := make([][]byte, len(txids))
+	for i, txid := range txids {
+		b, err := hex.DecodeString(txid)
+		if err != nil || len(b) != 32 {
+			return "", fmt.Errorf("txid inválido %q", txid)
+		}
+		level[i] = reverseBytes(b)
+	}
+
+	for len(level) > 1 {
+		// Nível ímpar: o último hash é pareado com ele mesmo
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([][]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, DoubleSHA256(append(append([]byte{}, level[i]...), level[i+1]...)))
+		}
+		level = next
+	}
+	return hex.EncodeToString(reverseBytes(level[0])), nil
+}
+
+// BlockTxIDs extrai os txids de um bloco do getblock, com verbosity 1 (lista de
+// txids) ou 2 (lista de transações decodificadas).
+func BlockTxIDs(block map[string]interface{}) ([]string, error) {
+	txList, ok := block["tx"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bloco sem lista de transações")
+	}
+	txids := make([]string, 0, len(txList))
+	for i, tx := range txList {
+		switch tx := tx.(type) {
+		case string:
+			txids = append(txids, tx)
+		case map[string]interface{}:
+			txid, ok := tx["txid"].(string)
+			if !ok {
+				return nil, fmt.Errorf("transação %d sem txid", i)
+			}
+			txids = append(txids, txid)
+		default:
+			return nil, fmt.Errorf("transação %d em formato inesperado", i)
+		}
+	}
+	return txids, nil
+}
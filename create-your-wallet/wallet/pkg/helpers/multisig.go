@@ -0,0 +1,165 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil/bech32"
+)
+
+// MaxMultisigKeys é o maior n de um multisig m-de-n: OP_1 a OP_16 codificam m e n.
+const MaxMultisigKeys = 16
+
+// MultisigScript monta o witness script OP_m <chaves> OP_n OP_CHECKMULTISIG.
+// Com sorted, as chaves são ordenadas como no BIP67, e o script independe da
+// ordem em que os participantes foram informados.
+func MultisigScript(m int, pubKeys [][]byte, sorted bool) ([]byte, error) {
+	n := len(pubKeys)
+	if n < 1 || n > MaxMultisigKeys {
+		return nil, fmt.Errorf("multisig precisa de 1 a %d chaves, recebidas %d", MaxMultisigKeys, n)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("número de assinaturas %d inválido para %d chaves", m, n)
+	}
+
+	keys := make([][]byte, n)
+	seen := make(map[string]bool, n)
+	for i, key := range pubKeys {
+		// P2WSH só aceita chaves comprimidas como padrão
+		if len(key) != 33 {
+			return nil, fmt.Errorf("chave %d não é comprimida (%d bytes)", i, len(key))
+		}
+		if _, err := btcec.ParsePubKey(key, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("chave %d inválida: %w", i, err)
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("chave %x repetida", key)
+		}
+		seen[string(key)] = true
+		keys[i] = key
+	}
+	if sorted {
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	}
+
+	script := []byte{txscript.OP_1 - 1 + byte(m)}
+	for _, key := range keys {
+		script = append(script, txscript.OP_DATA_33)
+		script = append(script, key...)
+	}
+	script = append(script, txscript.OP_1-1+byte(n), txscript.OP_CHECKMULTISIG)
+	return script, nil
+}
+
+// ParseMultisigScript extrai m e as chaves de um witness script gerado por MultisigScript.
+func ParseMultisigScript(script []byte) (int, [][]byte, error) {
+	if len(script) < 3 || script[len(script)-1] != txscript.OP_CHECKMULTISIG {
+		return 0, nil, fmt.Errorf("script não é multisig")
+	}
+	m := int(script[0]) - (txscript.OP_1 - 1)
+	n := int(script[len(script)-2]) - (txscript.OP_1 - 1)
+	if n < 1 || n > MaxMultisigKeys || m < 1 || m > n || len(script) != 3+n*34 {
+		return 0, nil, fmt.Errorf("script multisig malformado")
+	}
+	keys := make([][]byte, n)
+	for i := range keys {
+		push := script[1+i*34:]
+		if push[0] != txscript.OP_DATA_33 {
+			return 0, nil, fmt.Errorf("script multisig malformado")
+		}
+		keys[i] = push[1:34]
+	}
+	return m, keys, nil
+}
+
+// P2WSHProgram retorna o scriptPubKey P2WSH (OP_0 <sha256(script)>). O hash é
+// um SHA-256 simples do script, sem byte de tamanho.
+func P2WSHProgram(script []byte) []byte {
+	hash := sha256.Sum256(script)
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_32}, hash[:]...)
+}
+
+// P2WSHAddress retorna o endereço bech32 do P2WSH do script.
+func P2WSHAddress(script []byte) (string, error) {
+	hash := sha256.Sum256(script)
+	data, err := bech32.ConvertBits(hash[:], 8, 5, true)
+	if err != nil {
+		return "", fmt.Errorf("erro ao converter para bits base 32: %w", err)
+	}
+	address, err := bech32.Encode("tb", append([]byte{0}, data...))
+	if err != nil {
+		return "", fmt.Errorf("erro ao codificar endereço bech32: %w", err)
+	}
+	return address, nil
+}
+
+// NewMultisig monta o multisig m-de-n das chaves com o seu P2WSH.
+func NewMultisig(m int, pubKeys [][]byte, sorted bool) (models.Multisig, error) {
+	script, err := MultisigScript(m, pubKeys, sorted)
+	if err != nil {
+		return models.Multisig{}, err
+	}
+	address, err := P2WSHAddress(script)
+	if err != nil {
+		return models.Multisig{}, err
+	}
+	_, keys, err := ParseMultisigScript(script)
+	if err != nil {
+		return models.Multisig{}, err
+	}
+	return models.Multisig{
+		Address:        address,
+		M:              m,
+		PubKeys:        keys,
+		Sorted:         sorted,
+		WitnessScript:  script,
+		WitnessProgram: P2WSHProgram(script),
+	}, nil
+}
+
+// MultisigDescriptor retorna o descritor público wsh(multi(...)) ou
+// wsh(sortedmulti(...)) do multisig, para RPCs como o scantxoutset.
+func MultisigDescriptor(ms models.Multisig) string {
+	function := "multi"
+	if ms.Sorted {
+		function = "sortedmulti"
+	}
+	keys := make([]string, len(ms.PubKeys))
+	for i, key := range ms.PubKeys {
+		keys[i] = hex.EncodeToString(key)
+	}
+	return fmt.Sprintf("wsh(%s(%d,%s))", function, ms.M, strings.Join(keys, ","))
+}
+
+// MultisigDescriptors retorna os descritores dos multisigs registrados no estado.
+func MultisigDescriptors(state *models.WalletState) []string {
+	descriptors := make([]string, 0, len(state.Multisigs))
+	for _, ms := range state.Multisigs {
+		descriptors = append(descriptors, MultisigDescriptor(ms))
+	}
+	return descriptors
+}
+
+// MultisigKeyIndexes retorna, para cada chave do multisig, o índice da chave
+// de recebimento da carteira correspondente, ou -1 se for de outro participante.
+func MultisigKeyIndexes(state *models.WalletState, ms models.Multisig) []int {
+	indexes := make([]int, len(ms.PubKeys))
+	for i, key := range ms.PubKeys {
+		indexes[i] = -1
+		for j, own := range state.PublicKeys {
+			if bytes.Equal(key, own) {
+				indexes[i] = j
+				break
+			}
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,139 @@
+package helpers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// testPubKeys deriva n chaves públicas de recebimento de testXprv.
+func testPubKeys(t *testing.T, n int) [][]byte {
+	t.Helper()
+	state := &models.WalletState{}
+	if err := DeriveKeyPairs(testXprv, n, state); err != nil {
+		t.Fatal(err)
+	}
+	return state.PublicKeys
+}
+
+func TestMultisigScriptRoundTrip(t *testing.T) {
+	keys := testPubKeys(t, MaxMultisigKeys)
+	for _, tc := range []struct {
+		m, n int
+	}{{1, 1}, {2, 3}, {3, 5}, {16, 16}} {
+		script, err := MultisigScript(tc.m, keys[:tc.n], false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, parsed, err := ParseMultisigScript(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != tc.m || !reflect.DeepEqual(parsed, keys[:tc.n]) {
+			t.Fatalf("%d-de-%d lido como %d-de-%d", tc.m, tc.n, m, len(parsed))
+		}
+
+		// O btcd reconhece o mesmo script
+		class, _, required, err := txscript.ExtractPkScriptAddrs(script, &chaincfg.TestNet3Params)
+		if err != nil || class != txscript.MultiSigTy || required != tc.m {
+			t.Fatalf("btcd classifica como %v com %d assinaturas (%v)", class, required, err)
+		}
+	}
+}
+
+func TestMultisigScriptSorted(t *testing.T) {
+	keys := testPubKeys(t, 3)
+	reversed := [][]byte{keys[2], keys[1], keys[0]}
+	a, err := MultisigScript(2, keys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MultisigScript(2, reversed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatal("sortedmulti depende da ordem das chaves")
+	}
+	_, parsed, _ := ParseMultisigScript(a)
+	for i := 1; i < len(parsed); i++ {
+		if bytes.Compare(parsed[i-1], parsed[i]) >= 0 {
+			t.Fatalf("chaves fora da ordem do BIP67: %x", parsed)
+		}
+	}
+	unsorted, err := MultisigScript(2, reversed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, parsed, _ := ParseMultisigScript(unsorted); !reflect.DeepEqual(parsed, reversed) {
+		t.Fatal("multi sem ordenação reordenou as chaves")
+	}
+}
+
+func TestMultisigScriptInvalid(t *testing.T) {
+	keys := testPubKeys(t, MaxMultisigKeys+1)
+	uncompressed := make([]byte, 65)
+	uncompressed[0] = 0x04
+	tests := []struct {
+		name string
+		m    int
+		keys [][]byte
+	}{
+		{"sem chaves", 1, nil},
+		{"chaves demais", 1, keys},
+		{"m zero", 0, keys[:2]},
+		{"m maior que n", 3, keys[:2]},
+		{"chave não comprimida", 1, [][]byte{keys[0], uncompressed}},
+		{"chave fora da curva", 1, [][]byte{keys[0], append(append([]byte{0x02}, make([]byte, 31)...), 5)}},
+		{"chave repetida", 1, [][]byte{keys[0], keys[0]}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := MultisigScript(tc.m, tc.keys, false); err == nil {
+				t.Fatal("multisig inválido aceito")
+			}
+		})
+	}
+
+	script, _ := MultisigScript(2, keys[:3], false)
+	for name, bad := range map[string][]byte{
+		"vazio":             nil,
+		"sem CHECKMULTISIG": script[:len(script)-1],
+		"n diferente":       append(append([]byte{}, script[:len(script)-2]...), txscript.OP_4, txscript.OP_CHECKMULTISIG),
+		"m maior que n":     append([]byte{txscript.OP_4}, script[1:]...),
+		"push que não é 33": append(append([]byte{script[0], txscript.OP_DATA_32}, script[2:]...), 0),
+		"chave truncada":    append([]byte{script[0]}, script[2:]...),
+		"programa P2WSH":    P2WSHProgram(script),
+	} {
+		if _, _, err := ParseMultisigScript(bad); err == nil {
+			t.Errorf("%s: script malformado aceito", name)
+		}
+	}
+}
+
+func TestNewMultisigAddress(t *testing.T) {
+	ms, err := NewMultisig(2, testPubKeys(t, 3), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := btcutil.DecodeAddress(ms.Address, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(program, ms.WitnessProgram) || !bytes.Equal(program, P2WSHProgram(ms.WitnessScript)) {
+		t.Fatalf("endereço %s paga %x, esperava %x", ms.Address, program, ms.WitnessProgram)
+	}
+	if want := "wsh(sortedmulti(2,"; MultisigDescriptor(ms)[:len(want)] != want {
+		t.Fatalf("descritor %s", MultisigDescriptor(ms))
+	}
+}
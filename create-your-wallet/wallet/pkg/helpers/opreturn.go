@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Limites da política padrão de relay para saídas OP_RETURN
+const (
+	MaxDataCarrierBytes = 83 // scriptPubKey inteiro: OP_RETURN + push de até 80 bytes
+	MaxDataOutputs      = 1  // Uma transação com mais de uma saída OP_RETURN não é padrão
+)
+
+// ParseDataOutput interpreta o conteúdo de uma saída OP_RETURN informado na
+// linha de comando: "hex:<bytes em hex>" ou texto, gravado em UTF-8.
+func ParseDataOutput(value string) ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(value, "hex:"); ok {
+		data, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("dados OP_RETURN em hex inválidos: %w", err)
+		}
+		return data, nil
+	}
+	return []byte(value), nil
+}
+
+// NullDataScript monta o scriptPubKey OP_RETURN <data>, recusando conteúdo
+// acima do limite padrão.
+func NullDataScript(data []byte) ([]byte, error) {
+	script, err := txscript.NullDataScript(data)
+	if err != nil || len(script) > MaxDataCarrierBytes {
+		// OP_RETURN e OP_PUSHDATA1 <tamanho> ocupam 3 dos bytes do script
+		return nil, fmt.Errorf("OP_RETURN de %d bytes acima do limite padrão de %d bytes de dados", len(data), MaxDataCarrierBytes-3)
+	}
+	return script, nil
+}
+
+// DataPayload extrai os dados de um scriptPubKey OP_RETURN, concatenando os
+// pushes. Retorna false se o script não for OP_RETURN ou tiver pushes
+// malformados.
+func DataPayload(script []byte) ([]byte, bool) {
+	if len(script) == 0 || script[0] != txscript.OP_RETURN {
+		return nil, false
+	}
+	pushes, err := txscript.PushedData(script[1:])
+	if err != nil {
+		return nil, false
+	}
+	payload := []byte{}
+	for _, push := range pushes {
+		payload = append(payload, push...)
+	}
+	return payload, true
+}
+
+// FormatDataPayload mostra o conteúdo de um OP_RETURN como texto se for UTF-8
+// imprimível, ou em hex.
+func FormatDataPayload(payload []byte) string {
+	if len(payload) > 0 && utf8.Valid(payload) && strings.IndexFunc(string(payload), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return fmt.Sprintf("%q", payload)
+	}
+	return "hex:" + hex.EncodeToString(payload)
+}
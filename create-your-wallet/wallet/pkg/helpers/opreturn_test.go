@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"wallet/pkg/coinselect"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestNullDataScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{"vazio", 0, false},
+		{"curto", 20, false},
+		{"push direto máximo", 75, false},
+		{"OP_PUSHDATA1", 76, false},
+		{"limite padrão", MaxDataCarrierBytes - 3, false},
+		{"acima do limite", MaxDataCarrierBytes - 2, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{0x42}, tc.size)
+			script, err := NullDataScript(data)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("OP_RETURN de %d bytes aceito", tc.size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if txscript.GetScriptClass(script) != txscript.NullDataTy || len(script) > MaxDataCarrierBytes {
+				t.Fatalf("script %x não é um OP_RETURN padrão", script)
+			}
+			payload, ok := DataPayload(script)
+			if !ok || !bytes.Equal(payload, data) {
+				t.Fatalf("DataPayload devolveu %x (%t), esperava %x", payload, ok, data)
+			}
+		})
+	}
+}
+
+func TestDataPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+		want   []byte
+		ok     bool
+	}{
+		{"só OP_RETURN", []byte{txscript.OP_RETURN}, []byte{}, true},
+		{"vários pushes", []byte{txscript.OP_RETURN, 0x02, 'o', 'i', 0x01, '!'}, []byte("oi!"), true},
+		{"push truncado", []byte{txscript.OP_RETURN, 0x05, 'o'}, nil, false},
+		{"não é OP_RETURN", testPayment, nil, false},
+		{"vazio", nil, nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := DataPayload(tc.script)
+			if ok != tc.ok || !bytes.Equal(got, tc.want) {
+				t.Fatalf("DataPayload = %x, %t; esperava %x, %t", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestParseAndFormatDataOutput(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      []byte
+		formatted string
+	}{
+		{"olá mundo", []byte("olá mundo"), `"olá mundo"`},
+		{"hex:00ff", []byte{0x00, 0xff}, "hex:00ff"},
+		{"hex:", []byte{}, "hex:"},
+	}
+	for _, tc := range tests {
+		got, err := ParseDataOutput(tc.value)
+		if err != nil || !bytes.Equal(got, tc.want) {
+			t.Fatalf("ParseDataOutput(%q) = %x (%v), esperava %x", tc.value, got, err, tc.want)
+		}
+		if formatted := FormatDataPayload(got); formatted != tc.formatted {
+			t.Fatalf("FormatDataPayload(%x) = %s, esperava %s", got, formatted, tc.formatted)
+		}
+	}
+	if _, err := ParseDataOutput("hex:zz"); err == nil {
+		t.Fatal("hex inválido aceito")
+	}
+}
+
+func TestBuildTransactionDataOutputs(t *testing.T) {
+	state, utxos := testWallet(t, 100000)
+	options := SendOptions{
+		Strategy:      coinselect.StrategyLargest,
+		FeeRate:       2,
+		ChangeAddress: state.ChangeKeys[0].Address,
+		Data:          [][]byte{[]byte("registro")},
+	}
+	tx, selection, err := BuildTransaction(utxos, state.Addresses[1][0], 0.0005, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pagamento, OP_RETURN de valor zero e troco; a taxa cobre o OP_RETURN
+	if len(tx.TxOut) != 3 {
+		t.Fatalf("%d saídas, esperava 3", len(tx.TxOut))
+	}
+	found := false
+	for _, out := range tx.TxOut {
+		if payload, ok := DataPayload(out.PkScript); ok {
+			found = out.Value == 0 && string(payload) == "registro"
+		}
+	}
+	if !found {
+		t.Fatal("saída OP_RETURN ausente ou com valor")
+	}
+	if selection.Fee < FeeForWeight(selection.Weight, options.FeeRate) {
+		t.Fatalf("taxa %d não cobre o peso %d", selection.Fee, selection.Weight)
+	}
+
+	options.Data = append(options.Data, []byte("outro"))
+	if _, _, err := BuildTransaction(utxos, state.Addresses[1][0], 0.0005, options); err == nil || !strings.Contains(err.Error(), "OP_RETURN") {
+		t.Fatalf("duas saídas OP_RETURN: %v, esperava recusa", err)
+	}
+}
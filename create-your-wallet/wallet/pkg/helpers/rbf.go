@@ -0,0 +1,303 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"wallet/pkg/coinselect"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// RBFSequence é o nSequence que sinaliza substituição opcional (BIP125):
+// qualquer valor abaixo de 0xfffffffe serve; este não ativa o timelock
+// relativo do BIP68 nem desativa o locktime.
+const RBFSequence = wire.MaxTxInSequenceNum - 2
+
+// SignalsRBF indica se alguma entrada de tx sinaliza substituição (BIP125).
+func SignalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// MempoolFees são as taxas, em BTC, de uma entrada do getmempoolentry.
+type MempoolFees struct {
+	Base       float64 `json:"base"`
+	Modified   float64 `json:"modified"`
+	Ancestor   float64 `json:"ancestor"`
+	Descendant float64 `json:"descendant"`
+}
+
+// MempoolEntry é o resultado do getmempoolentry.
+type MempoolEntry struct {
+	VSize           int         `json:"vsize"`
+	Weight          int         `json:"weight"`
+	Fees            MempoolFees `json:"fees"`
+	DescendantCount int         `json:"descendantcount"`
+	DescendantSize  int         `json:"descendantsize"`
+	AncestorCount   int         `json:"ancestorcount"`
+	AncestorSize    int         `json:"ancestorsize"`
+	Replaceable     bool        `json:"bip125-replaceable"`
+	Depends         []string    `json:"depends"`
+}
+
+// GetMempoolEntry consulta a transação txid no mempool do nó.
+func GetMempoolEntry(txid string) (*MempoolEntry, error) {
+	raw, err := RunBitcoinCLI("getmempoolentry", txid)
+	if err != nil {
+		return nil, fmt.Errorf("transação %s fora do mempool: %w", txid, err)
+	}
+
+	// Reserializa a resposta genérica para o formato tipado
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar resultado do getmempoolentry: %w", err)
+	}
+	var entry MempoolEntry
+	if err := json.Unmarshal(rawJSON, &entry); err != nil {
+		return nil, fmt.Errorf("resultado inesperado do getmempoolentry: %w", err)
+	}
+	return &entry, nil
+}
+
+// GetRawTransaction busca no nó a transação txid em hex; sem -txindex, só
+// as do mempool são encontradas.
+func GetRawTransaction(txid string) (string, error) {
+	result, err := RunBitcoinCLI("getrawtransaction", txid)
+	if err != nil {
+		return "", err
+	}
+	rawTx, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("resultado inesperado do getrawtransaction: %v", result)
+	}
+	return rawTx, nil
+}
+
+// NewPendingTx é o registro de uma transação assinada que pagou fee satoshis.
+func NewPendingTx(tx *wire.MsgTx, fee int64) models.PendingTx {
+	inputs := make([]string, 0, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		inputs = append(inputs, txIn.PreviousOutPoint.String())
+	}
+	return models.PendingTx{
+		TxID:   TxID(tx),
+		RawTx:  EncodeTransaction(tx),
+		Inputs: inputs,
+		Fee:    fee,
+		VSize:  VSize(TxWeight(tx)),
+	}
+}
+
+// BumpResult descreve a substituição montada por BumpFee.
+type BumpResult struct {
+	OldFee     int64   // Taxa da transação original em satoshis
+	OldFeeRate float64 // Taxa da original em sat/vB
+	Fee        int64   // Taxa da substituição em satoshis
+	FeeRate    float64 // Taxa da substituição em sat/vB
+	Weight     int     // Peso estimado da substituição
+	Change     int64   // Troco da substituição, 0 se foi para a taxa
+	Added      int     // Entradas acrescentadas às da original
+
+	// Chave de troco nova, quando a original não tinha troco e a
+	// substituição precisou de um; nil nos demais casos
+	ChangeKey *models.DerivedKey
+}
+
+// BumpFee monta e assina uma substituição (BIP125) de original, uma
+// transação da carteira ainda não confirmada, a uma taxa maior. As entradas
+// da original são mantidas, para que as duas versões sempre conflitem, e as
+// saídas de pagamento não mudam; a taxa extra sai do troco, que some se ficar
+// abaixo do limite de poeira, e entradas de spendable (as maiores primeiro) são
+// acrescentadas se o troco não bastar. A taxa paga cobre replacedFees (a
+// original e suas descendentes no mempool) mais a banda da substituição à taxa
+// mínima de relay. Sem options.FeeRate, usa a estimativa do nó, mas sempre
+// acima da taxa da original.
+func BumpFee(state *models.WalletState, original *wire.MsgTx, replacedFees int64, options SendOptions, spendable map[string]models.UTXO) (*wire.MsgTx, *BumpResult, error) {
+	var prevouts []models.UTXO
+	var inputTotal int64
+	inOriginal := make(map[string]bool)
+	for _, txIn := range original.TxIn {
+		outpoint := txIn.PreviousOutPoint.String()
+		inOriginal[outpoint] = true
+		utxo, ok := state.UTXOs[outpoint]
+		if !ok {
+			return nil, nil, fmt.Errorf("entrada %s não é um UTXO da carteira", outpoint)
+		}
+		coin, err := coinselect.NewCoin(outpoint, utxo)
+		if err != nil {
+			return nil, nil, err
+		}
+		prevouts = append(prevouts, utxo)
+		inputTotal += coin.Value
+	}
+
+	// Pagamentos ficam como estão; o troco da carteira é recalculado
+	var payments []*wire.TxOut
+	var paymentTotal int64
+	var changeScript []byte
+	changePos := -1
+	for i, txOut := range original.TxOut {
+		if _, ok := changeKeyForScript(state, txOut.PkScript); ok && changePos < 0 {
+			changeScript = txOut.PkScript
+			changePos = i
+			continue
+		}
+		payments = append(payments, txOut)
+		paymentTotal += txOut.Value
+	}
+	outputTotal := paymentTotal
+	if changePos >= 0 {
+		outputTotal += original.TxOut[changePos].Value
+	}
+
+	result := &BumpResult{OldFee: inputTotal - outputTotal}
+	if result.OldFee < 0 {
+		return nil, nil, fmt.Errorf("saídas somam mais que as entradas da original")
+	}
+	result.OldFeeRate = float64(result.OldFee) / float64(VSize(TxWeight(original)))
+	if replacedFees < result.OldFee {
+		replacedFees = result.OldFee
+	}
+
+	feeRate, err := ResolveFeeRate(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if options.FeeRate == 0 && feeRate <= result.OldFeeRate {
+		feeRate = result.OldFeeRate + MinRelayFeeRate
+	}
+	if feeRate <= result.OldFeeRate {
+		return nil, nil, fmt.Errorf("taxa de %.3f sat/vB não supera a da original (%.3f sat/vB)", feeRate, result.OldFeeRate)
+	}
+	if options.MaxFeeRate > 0 && feeRate > options.MaxFeeRate {
+		return nil, nil, fmt.Errorf("taxa de %.3f sat/vB acima do limite de %.3f sat/vB", feeRate, options.MaxFeeRate)
+	}
+
+	if changeScript == nil {
+		key, err := NextChangeKey(state)
+		if err != nil {
+			return nil, nil, err
+		}
+		changeScript = key.WitnessProgram
+		result.ChangeKey = &key
+	}
+
+	// Entradas que podem ser acrescentadas, das maiores para as menores
+	var extra []coinselect.Coin
+	for outpoint, utxo := range spendable {
+		if inOriginal[outpoint] {
+			continue
+		}
+		coin, err := coinselect.NewCoin(outpoint, utxo)
+		if err != nil {
+			return nil, nil, err
+		}
+		extra = append(extra, coin)
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		if extra[i].Value != extra[j].Value {
+			return extra[i].Value > extra[j].Value
+		}
+		return extra[i].Outpoint < extra[j].Outpoint
+	})
+
+	// A substituição paga a taxa pedida e, no mínimo, as taxas que remove do
+	// mempool mais a própria banda à taxa mínima de relay (regras 3 e 4)
+	requiredFee := func(weight int) int64 {
+		fee := FeeForWeight(weight, feeRate)
+		if min := replacedFees + FeeForWeight(weight, MinRelayFeeRate); fee < min {
+			fee = min
+		}
+		return fee
+	}
+
+	var tx *wire.MsgTx
+	for {
+		tx = wire.NewMsgTx(original.Version)
+		tx.LockTime = original.LockTime
+		for _, utxo := range prevouts {
+			txIn, err := spendInput(utxo, RBFSequence)
+			if err != nil {
+				return nil, nil, err
+			}
+			tx.AddTxIn(txIn)
+		}
+		for _, out := range payments {
+			tx.AddTxOut(wire.NewTxOut(out.Value, out.PkScript))
+		}
+
+		excess := inputTotal - paymentTotal
+		weight := TxWeight(tx)
+		changeWeight := weight + coinselect.OutputWeight(changeScript)
+		if change := excess - requiredFee(changeWeight); change >= coinselect.DustLimit {
+			// O troco volta para a posição que tinha na original
+			changeOut := wire.NewTxOut(change, changeScript)
+			if changePos >= 0 && changePos <= len(tx.TxOut) {
+				tx.TxOut = append(tx.TxOut, nil)
+				copy(tx.TxOut[changePos+1:], tx.TxOut[changePos:])
+				tx.TxOut[changePos] = changeOut
+			} else {
+				insertChange(tx, changeOut)
+			}
+			result.Change = change
+			result.Fee = excess - change
+			result.Weight = changeWeight
+			break
+		}
+		if excess >= requiredFee(weight) {
+			// Troco abaixo do limite de poeira vai todo para a taxa
+			result.Fee = excess
+			result.Weight = weight
+			break
+		}
+		if result.Added == len(extra) {
+			return nil, nil, fmt.Errorf("saldo insuficiente para pagar a taxa de %.3f sat/vB", feeRate)
+		}
+		inputTotal += extra[result.Added].Value
+		prevouts = append(prevouts, extra[result.Added].UTXO)
+		result.Added++
+	}
+	if result.Change == 0 {
+		result.ChangeKey = nil
+	}
+	result.FeeRate = float64(result.Fee) / float64(VSize(result.Weight))
+
+	if err := checkFeeCaps(&coinselect.Selection{Fee: result.Fee, Weight: result.Weight}, options); err != nil {
+		return nil, nil, err
+	}
+
+	for _, txIn := range tx.TxIn {
+		txIn.Witness = nil
+	}
+	complete, err := SignTransaction(tx, prevouts, options.Keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !complete {
+		return nil, nil, fmt.Errorf("faltam chaves para assinar todas as entradas da substituição")
+	}
+	return tx, result, nil
+}
+
+// spendInput é a entrada que gasta utxo com o nSequence informado, com um
+// witness de tamanho máximo para medir o peso.
+func spendInput(utxo models.UTXO, sequence uint32) (*wire.TxIn, error) {
+	txHash, err := chainhash.NewHashFromStr(utxo.TxID)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao decodificar txid: %w", err)
+	}
+	txIn := wire.NewTxIn(wire.NewOutPoint(txHash, uint32(utxo.VoutIndex)), nil, nil)
+	txIn.Sequence = sequence
+	if txIn.Witness, err = dummyWitness(utxo); err != nil {
+		return nil, fmt.Errorf("%s:%d: %w", utxo.TxID, utxo.VoutIndex, err)
+	}
+	return txIn, nil
+}
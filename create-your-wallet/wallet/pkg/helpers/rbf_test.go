@@ -0,0 +1,141 @@
+package helpers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"wallet/pkg/coinselect"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testOriginal assina um envio sinalizando RBF que gasta inputs, paga payment
+// ao destino de teste e devolve change (se houver) à chave de troco 0.
+func testOriginal(t *testing.T, state *models.WalletState, payment, change int64, inputs ...models.UTXO) *wire.MsgTx {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	for _, utxo := range inputs {
+		txIn, err := spendInput(utxo, RBFSequence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txIn.Witness = nil
+		tx.AddTxIn(txIn)
+	}
+	tx.AddTxOut(wire.NewTxOut(payment, testPayment))
+	if change > 0 {
+		tx.AddTxOut(wire.NewTxOut(change, state.ChangeKeys[0].WitnessProgram))
+	}
+	if _, err := SignTransaction(tx, inputs, nil); err != nil {
+		t.Fatal(err)
+	}
+	state.ChangeIndex = 1
+	return tx
+}
+
+func TestBumpFee(t *testing.T) {
+	tests := []struct {
+		name         string
+		payment      int64
+		change       int64 // Troco da original; a entrada é de 100000 sat
+		extra        int64 // UTXO confirmado disponível para acrescentar; 0 = nenhum
+		replacedFees int64
+		options      SendOptions
+		wantErr      string
+		wantAdded    int
+		wantChange   bool
+	}{
+		{name: "taxa maior sai do troco", payment: 50000, change: 48590,
+			options: SendOptions{FeeRate: 20}, wantChange: true},
+		{name: "descendentes elevam a taxa mínima (regras 3 e 4)", payment: 50000, change: 48590, replacedFees: 5000,
+			options: SendOptions{FeeRate: 12}, wantChange: true},
+		{name: "troco abaixo da poeira vai para a taxa", payment: 100000 - 1410 - coinselect.DustLimit - 200, change: coinselect.DustLimit + 200,
+			options: SendOptions{FeeRate: 12}},
+		{name: "sem troco na original, cria troco com a entrada extra", payment: 98590, extra: 50000,
+			options: SendOptions{FeeRate: 20}, wantAdded: 1, wantChange: true},
+		{name: "troco insuficiente acrescenta entrada", payment: 97000, change: 1590, extra: 50000,
+			options: SendOptions{FeeRate: 50}, wantAdded: 1, wantChange: true},
+		{name: "troco insuficiente sem entradas", payment: 97000, change: 1590,
+			options: SendOptions{FeeRate: 50}, wantErr: "saldo insuficiente"},
+		{name: "taxa que não supera a original", payment: 50000, change: 48590,
+			options: SendOptions{FeeRate: 9}, wantErr: "não supera"},
+		{name: "acima da taxa absoluta máxima", payment: 50000, change: 48590,
+			options: SendOptions{FeeRate: 20, MaxFee: 0.00002}, wantErr: "acima do limite"},
+		{name: "descendentes caros acima da taxa máxima", payment: 50000, change: 48590, replacedFees: 40000,
+			options: SendOptions{FeeRate: 20, MaxFeeRate: 100}, wantErr: "acima do limite"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			values := []int64{100000}
+			if tc.extra > 0 {
+				values = append(values, tc.extra)
+			}
+			state, utxos := testWallet(t, values...)
+			first := testUTXO(state, 0, strings.Repeat("0", 63)+"1", 100000)
+			original := testOriginal(t, state, tc.payment, tc.change, first)
+			spendable := make(map[string]models.UTXO)
+			for outpoint, utxo := range utxos {
+				if utxo.TxID != first.TxID {
+					spendable[outpoint] = utxo
+				}
+			}
+
+			tx, result, err := BumpFee(state, original, tc.replacedFees, tc.options, spendable)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("erro %v, esperava %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Conflita com a original e mantém o pagamento
+			if tx.TxIn[0].PreviousOutPoint != original.TxIn[0].PreviousOutPoint {
+				t.Fatalf("substituição não gasta a entrada da original")
+			}
+			if !SignalsRBF(tx) {
+				t.Fatal("substituição não sinaliza RBF")
+			}
+			paid := false
+			var inTotal, outTotal int64 = 100000 + int64(result.Added)*tc.extra, 0
+			for _, out := range tx.TxOut {
+				outTotal += out.Value
+				paid = paid || (bytes.Equal(out.PkScript, testPayment) && out.Value == tc.payment)
+			}
+			if !paid {
+				t.Fatal("pagamento da original mudou")
+			}
+			if result.Added != tc.wantAdded || (result.Change > 0) != tc.wantChange {
+				t.Fatalf("%d entradas acrescentadas e troco %d, esperava %d e troco %t", result.Added, result.Change, tc.wantAdded, tc.wantChange)
+			}
+			if tc.change == 0 && result.Change > 0 && (result.ChangeKey == nil || result.ChangeKey.Index != 1) {
+				t.Fatalf("troco novo com a chave %+v, esperava a de troco 1", result.ChangeKey)
+			}
+			if !tc.wantChange && len(tx.TxOut) != 1 {
+				t.Fatalf("%d saídas, esperava só o pagamento", len(tx.TxOut))
+			}
+
+			// Regras do BIP125 e taxa pedida
+			if fee := inTotal - outTotal; fee != result.Fee {
+				t.Fatalf("taxa paga %d, relatada %d", fee, result.Fee)
+			}
+			replaced := tc.replacedFees
+			if replaced < result.OldFee {
+				replaced = result.OldFee
+			}
+			if min := replaced + FeeForWeight(result.Weight, MinRelayFeeRate); result.Fee < min {
+				t.Fatalf("taxa %d abaixo do mínimo de substituição %d", result.Fee, min)
+			}
+			if want := FeeForWeight(result.Weight, tc.options.FeeRate); result.Fee < want || result.FeeRate <= result.OldFeeRate {
+				t.Fatalf("taxa %d sat (%.3f sat/vB), esperava ao menos %d sat e acima da original (%.3f sat/vB)", result.Fee, result.FeeRate, want, result.OldFeeRate)
+			}
+			if weight := TxWeight(tx); weight > result.Weight {
+				t.Fatalf("peso assinado %d maior que o estimado %d", weight, result.Weight)
+			}
+		})
+	}
+}
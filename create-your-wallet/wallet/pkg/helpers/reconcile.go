@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"wallet/pkg/models"
+)
+
+// Tipos de divergência entre o estado da carteira e o conjunto de UTXOs do nó
+const (
+	DiffMissing = "missing" // Está no estado mas não no nó (gasto ou inexistente)
+	DiffExtra   = "extra"   // Está no nó mas não no estado
+	DiffValue   = "value"   // Está nos dois com valores diferentes
+)
+
+// Origem da informação do nó em cada divergência
+const (
+	SourceGetTxOut     = "gettxout"
+	SourceScanTxOutSet = "scantxoutset"
+)
+
+// ReconcileDiff é uma divergência de um outpoint.
+type ReconcileDiff struct {
+	Outpoint string
+	Kind     string
+	Source   string
+	Wallet   float64 // Valor no estado (0 se ausente)
+	Node     float64 // Valor no nó (0 se ausente)
+}
+
+// ReconcileReport compara o estado da carteira com o nó.
+type ReconcileReport struct {
+	WalletHeight int     // Último bloco aplicado ao estado
+	NodeHeight   int     // Altura do scantxoutset
+	WalletTotal  float64 // Soma dos UTXOs do estado
+	NodeTotal    float64 // Soma dos UTXOs encontrados pelo scantxoutset
+	Checked      int     // UTXOs do estado conferidos com gettxout
+	Diffs        []ReconcileDiff
+}
+
+// Behind indica que o nó está à frente do estado, e parte das divergências
+// pode ser só atividade dos blocos ainda não escaneados.
+func (r *ReconcileReport) Behind() bool {
+	return r.NodeHeight > r.WalletHeight
+}
+
+func toSats(value float64) int64 {
+	return int64(math.Round(value * 1e8))
+}
+
+// Reconcile confere cada UTXO do estado com gettxout (sem mempool) e compara o
+// conjunto inteiro com o scantxoutset dos descritores da carteira, derivando
+// tantos índices quanto chaves existirem no estado.
+func Reconcile(state *models.WalletState, walletHeight int, descriptors []string) (*ReconcileReport, error) {
+	report := &ReconcileReport{WalletHeight: walletHeight}
+
+	outpoints := make([]string, 0, len(state.UTXOs))
+	for outpoint, utxo := range state.UTXOs {
+		outpoints = append(outpoints, outpoint)
+		report.WalletTotal += utxo.Value
+	}
+	sort.Strings(outpoints)
+
+	// 1. Cada UTXO do estado ainda existe no nó com o mesmo valor?
+	for _, outpoint := range outpoints {
+		utxo := state.UTXOs[outpoint]
+		result, err := RunBitcoinCLI("gettxout", utxo.TxID, fmt.Sprint(utxo.VoutIndex), "false")
+		if err != nil {
+			return nil, fmt.Errorf("erro no gettxout de %s: %w", outpoint, err)
+		}
+		report.Checked++
+
+		// Saída gasta ou inexistente: o bitcoin-cli não imprime nada
+		txout, ok := result.(map[string]interface{})
+		if !ok {
+			report.Diffs = append(report.Diffs, ReconcileDiff{Outpoint: outpoint, Kind: DiffMissing, Source: SourceGetTxOut, Wallet: utxo.Value})
+			continue
+		}
+		value, _ := txout["value"].(float64)
+		if toSats(value) != toSats(utxo.Value) {
+			report.Diffs = append(report.Diffs, ReconcileDiff{Outpoint: outpoint, Kind: DiffValue, Source: SourceGetTxOut, Wallet: utxo.Value, Node: value})
+		}
+	}
+
+	// 2. O conjunto do nó para os descritores (e os multisigs registrados) bate com o estado?
+	scan, err := ScanTxOutSet(append(append([]string(nil), descriptors...), MultisigDescriptors(state)...), len(state.PublicKeys))
+	if err != nil {
+		return nil, err
+	}
+	report.NodeHeight = scan.Height
+
+	onNode := make(map[string]bool, len(scan.Unspents))
+	for _, unspent := range scan.Unspents {
+		outpoint := fmt.Sprintf("%s:%d", unspent.TxID, unspent.Vout)
+		onNode[outpoint] = true
+		report.NodeTotal += unspent.Amount
+
+		utxo, ok := state.UTXOs[outpoint]
+		switch {
+		case !ok:
+			report.Diffs = append(report.Diffs, ReconcileDiff{Outpoint: outpoint, Kind: DiffExtra, Source: SourceScanTxOutSet, Node: unspent.Amount})
+		case toSats(utxo.Value) != toSats(unspent.Amount):
+			report.Diffs = append(report.Diffs, ReconcileDiff{Outpoint: outpoint, Kind: DiffValue, Source: SourceScanTxOutSet, Wallet: utxo.Value, Node: unspent.Amount})
+		}
+	}
+	for _, outpoint := range outpoints {
+		if !onNode[outpoint] {
+			report.Diffs = append(report.Diffs, ReconcileDiff{Outpoint: outpoint, Kind: DiffMissing, Source: SourceScanTxOutSet, Wallet: state.UTXOs[outpoint].Value})
+		}
+	}
+
+	sort.SliceStable(report.Diffs, func(i, j int) bool {
+		return report.Diffs[i].Outpoint < report.Diffs[j].Outpoint
+	})
+	return report, nil
+}
+
+// PrintReconcileReport imprime o relatório de divergências.
+func PrintReconcileReport(report *ReconcileReport) {
+	fmt.Printf("Estado no bloco %d: %.8f em %d UTXOs conferidos com gettxout\n", report.WalletHeight, report.WalletTotal, report.Checked)
+	fmt.Printf("Nó no bloco %d (scantxoutset): %.8f\n", report.NodeHeight, report.NodeTotal)
+	if report.Behind() {
+		fmt.Printf("Aviso: o estado está %d blocos atrás do nó; divergências podem ser blocos não escaneados\n", report.NodeHeight-report.WalletHeight)
+	}
+	if len(report.Diffs) == 0 {
+		fmt.Println("Nenhuma divergência")
+		return
+	}
+	fmt.Printf("%-70s %-8s %-13s %14s %14s\n", "Outpoint", "Tipo", "Origem", "Carteira", "Nó")
+	for _, diff := range report.Diffs {
+		fmt.Printf("%-70s %-8s %-13s %14.8f %14.8f\n", diff.Outpoint, diff.Kind, diff.Source, diff.Wallet, diff.Node)
+	}
+}
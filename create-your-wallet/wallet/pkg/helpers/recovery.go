@@ -0,0 +1,162 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"wallet/pkg/models"
+)
+
+// Modos de recuperação da carteira
+const (
+	RecoveryFullScan     = "fullscan"     // Percorre todos os blocos e preserva o histórico
+	RecoveryScanTxOutSet = "scantxoutset" // Carrega apenas o conjunto de UTXOs atual
+)
+
+// ScanUnspent é um item do campo "unspents" retornado pelo scantxoutset.
+type ScanUnspent struct {
+	TxID         string  `json:"txid"`
+	Vout         int     `json:"vout"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	Desc         string  `json:"desc"`
+	Amount       float64 `json:"amount"`
+	Coinbase     bool    `json:"coinbase"`
+	Height       int     `json:"height"`
+}
+
+// ScanResult é o resultado do scantxoutset.
+type ScanResult struct {
+	Success     bool          `json:"success"`
+	Height      int           `json:"height"`
+	BestBlock   string        `json:"bestblock"`
+	Unspents    []ScanUnspent `json:"unspents"`
+	TotalAmount float64       `json:"total_amount"`
+}
+
+// WalletDescriptors retorna os descritores públicos (tpub) da carteira para
+// uso em RPCs que não devem receber a chave privada.
+func WalletDescriptors(xprv string) ([]string, error) {
+	accountKey, err := DeriveAccountKey(xprv)
+	if err != nil {
+		return nil, err
+	}
+	accountPub, err := accountKey.Neuter()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter tpub da conta: %w", err)
+	}
+	return []string{
+		fmt.Sprintf("wpkh(%s/0/*)", accountPub.String()),
+		fmt.Sprintf("wpkh(%s/1/*)", accountPub.String()),
+	}, nil
+}
+
+// ScanTxOutSet executa o scantxoutset com os descritores informados,
+// derivando os índices de 0 até count-1.
+func ScanTxOutSet(descriptors []string, count int) (*ScanResult, error) {
+	type scanObject struct {
+		Desc  string `json:"desc"`
+		Range *int   `json:"range,omitempty"`
+	}
+	end := count - 1
+	objects := make([]scanObject, 0, len(descriptors))
+	for _, desc := range descriptors {
+		// Descritores sem /* (multisig de chaves fixas) não aceitam range
+		object := scanObject{Desc: desc}
+		if strings.Contains(desc, "*") {
+			object.Range = &end
+		}
+		objects = append(objects, object)
+	}
+	objectsJSON, err := json.Marshal(objects)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar descritores: %w", err)
+	}
+
+	raw, err := RunBitcoinCLI("scantxoutset", "start", string(objectsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao executar scantxoutset: %w", err)
+	}
+
+	// Reserializa a resposta genérica para o formato tipado
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar resultado do scantxoutset: %w", err)
+	}
+	var result ScanResult
+	if err := json.Unmarshal(rawJSON, &result); err != nil {
+		return nil, fmt.Errorf("resultado inesperado do scantxoutset: %w", err)
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("scantxoutset não foi concluído")
+	}
+	return &result, nil
+}
+
+// SeedStateFromScan popula state.UTXOs com o resultado do scantxoutset.
+// As chaves precisam estar derivadas e os witness programs calculados.
+// Retorna o número de UTXOs que não puderam ser associados a uma chave.
+func SeedStateFromScan(state *models.WalletState, result *ScanResult) int {
+	unmatched := 0
+	for _, unspent := range result.Unspents {
+		script, err := hex.DecodeString(unspent.ScriptPubKey)
+		if err != nil {
+			fmt.Printf("Erro ao decodificar scriptPubKey de %s:%d: %v\n", unspent.TxID, unspent.Vout, err)
+			unmatched++
+			continue
+		}
+
+		utxo, ok := walletUTXO(state, script)
+		if !ok {
+			fmt.Printf("UTXO %s:%d não pertence a nenhuma chave derivada\n", unspent.TxID, unspent.Vout)
+			unmatched++
+			continue
+		}
+		state.MarkChangeUsed(utxo.Address)
+		utxo.TxID = unspent.TxID
+		utxo.VoutIndex = unspent.Vout
+		utxo.Value = unspent.Amount
+		utxo.Height = unspent.Height
+		utxo.Coinbase = unspent.Coinbase
+		UpdateUTXO(state, utxo)
+	}
+	return unmatched
+}
+
+// walletUTXO associa script a uma chave de recebimento, a um multisig
+// registrado ou a uma chave de troco e retorna o UTXO só com endereço, chave
+// privada e scripts preenchidos.
+func walletUTXO(state *models.WalletState, script []byte) (models.UTXO, bool) {
+	for i, program := range state.WitnessPrograms {
+		if bytes.Equal(program, script) && i < len(state.Addresses) {
+			key := state.Key(i)
+			return models.UTXO{Address: key.Address, PrivateKey: key.PrivateKey, ScriptPubKey: script}, true
+		}
+	}
+	if ms, ok := multisigForScript(state, script); ok {
+		return models.UTXO{Address: ms.Address, ScriptPubKey: script, WitnessScript: ms.WitnessScript}, true
+	}
+	if key, ok := changeKeyForScript(state, script); ok {
+		return models.UTXO{Address: key.Address, PrivateKey: key.PrivateKey, ScriptPubKey: script}, true
+	}
+	return models.UTXO{}, false
+}
+
+func changeKeyForScript(state *models.WalletState, script []byte) (models.DerivedKey, bool) {
+	for _, key := range state.ChangeKeys {
+		if bytes.Equal(key.WitnessProgram, script) {
+			return key, true
+		}
+	}
+	return models.DerivedKey{}, false
+}
+
+func multisigForScript(state *models.WalletState, script []byte) (models.Multisig, bool) {
+	for _, ms := range state.Multisigs {
+		if bytes.Equal(ms.WitnessProgram, script) {
+			return ms, true
+		}
+	}
+	return models.Multisig{}, false
+}
@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"wallet/pkg/models"
+)
+
+// UnspentEntry é uma linha do relatório no estilo do `listunspent`.
+type UnspentEntry struct {
+	TxID          string  `json:"txid"`
+	Vout          int     `json:"vout"`
+	Address       string  `json:"address"`
+	ScriptPubKey  string  `json:"scriptPubKey"`
+	Amount        float64 `json:"amount"`
+	Height        int     `json:"height"`
+	Confirmations int     `json:"confirmations"`
+	Coinbase      bool    `json:"coinbase"`
+	Spendable     bool    `json:"spendable"`
+}
+
+// AddressBalance resume os UTXOs de um único endereço.
+type AddressBalance struct {
+	Address   string
+	Spendable float64
+	Immature  float64
+	UTXOs     int
+}
+
+// ListUnspent retorna os UTXOs da carteira ordenados por altura e outpoint.
+func ListUnspent(state *models.WalletState, tipHeight int) []UnspentEntry {
+	entries := make([]UnspentEntry, 0, len(state.UTXOs))
+	for _, utxo := range state.UTXOs {
+		entries = append(entries, UnspentEntry{
+			TxID:          utxo.TxID,
+			Vout:          utxo.VoutIndex,
+			Address:       utxo.Address,
+			ScriptPubKey:  hex.EncodeToString(utxo.ScriptPubKey),
+			Amount:        utxo.Value,
+			Height:        utxo.Height,
+			Confirmations: utxo.Confirmations(tipHeight),
+			Coinbase:      utxo.Coinbase,
+			Spendable:     utxo.IsMature(tipHeight),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Height != entries[j].Height {
+			return entries[i].Height < entries[j].Height
+		}
+		if entries[i].TxID != entries[j].TxID {
+			return entries[i].TxID < entries[j].TxID
+		}
+		return entries[i].Vout < entries[j].Vout
+	})
+	return entries
+}
+
+// AddressBalances agrupa os UTXOs por endereço.
+func AddressBalances(state *models.WalletState, tipHeight int) []AddressBalance {
+	byAddress := make(map[string]*AddressBalance)
+	for _, utxo := range state.UTXOs {
+		summary, ok := byAddress[utxo.Address]
+		if !ok {
+			summary = &AddressBalance{Address: utxo.Address}
+			byAddress[utxo.Address] = summary
+		}
+		summary.UTXOs++
+		if utxo.IsMature(tipHeight) {
+			summary.Spendable += utxo.Value
+		} else {
+			summary.Immature += utxo.Value
+		}
+	}
+
+	balances := make([]AddressBalance, 0, len(byAddress))
+	for _, summary := range byAddress {
+		balances = append(balances, *summary)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Address < balances[j].Address
+	})
+	return balances
+}
+
+// PrintListUnspent imprime o relatório de UTXOs em JSON, como o bitcoin-cli.
+func PrintListUnspent(state *models.WalletState, tipHeight int) error {
+	out, err := json.MarshalIndent(ListUnspent(state, tipHeight), "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar UTXOs: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// PrintAddressBalances imprime o saldo de cada endereço com UTXOs.
+func PrintAddressBalances(state *models.WalletState, tipHeight int) {
+	fmt.Printf("%-64s %16s %16s %6s\n", "Endereço", "Gastável", "Imaturo", "UTXOs")
+	for _, b := range AddressBalances(state, tipHeight) {
+		fmt.Printf("%-64s %16.8f %16.8f %6d\n", b.Address, b.Spendable, b.Immature, b.UTXOs)
+	}
+}
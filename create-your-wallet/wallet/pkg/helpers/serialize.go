@@ -0,0 +1,347 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Formato de transação (BIP144), todos os inteiros em little-endian:
+//
+//	version (4) [marker 0x00, flag 0x01]
+//	n_vin (compact size) { txid (32) vout (4) scriptSig (var) sequence (4) }...
+//	n_vout (compact size) { valor em sat (8) scriptPubKey (var) }...
+//	[por entrada: n_itens (compact size) { item (var) }...]
+//	locktime (4)
+//
+// Marker, flag e witnesses só aparecem na serialização com witness de uma
+// transação que tenha algum witness; o txid é o hash da serialização sem eles.
+
+// WriteCompactSize escreve n como compact size: 1 byte até 0xfc; senão um
+// prefixo 0xfd, 0xfe ou 0xff seguido de 2, 4 ou 8 bytes.
+func WriteCompactSize(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(0xfd)
+		binary.LittleEndian.PutUint16(b[:], uint16(n))
+		buf.Write(b[:2])
+	case n <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		binary.LittleEndian.PutUint32(b[:], uint32(n))
+		buf.Write(b[:4])
+	default:
+		buf.WriteByte(0xff)
+		binary.LittleEndian.PutUint64(b[:], n)
+		buf.Write(b[:])
+	}
+}
+
+// writeVarBytes escreve data precedido do seu tamanho em compact size.
+func writeVarBytes(buf *bytes.Buffer, data []byte) {
+	WriteCompactSize(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], n)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	buf.Write(b[:])
+}
+
+// writeOutPoint escreve o outpoint: txid na ordem interna (inversa da exibida) e vout.
+func writeOutPoint(buf *bytes.Buffer, op wire.OutPoint) {
+	buf.Write(op.Hash[:])
+	writeUint32(buf, op.Index)
+}
+
+// writeTxOut escreve o valor e o scriptPubKey de uma saída.
+func writeTxOut(buf *bytes.Buffer, out *wire.TxOut) {
+	writeUint64(buf, uint64(out.Value))
+	writeVarBytes(buf, out.PkScript)
+}
+
+// hasWitness indica se alguma entrada de tx tem witness.
+func hasWitness(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if len(txIn.Witness) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SerializeTx serializa tx no formato da rede. Com witness, inclui marker,
+// flag e os witnesses se alguma entrada tiver witness.
+func SerializeTx(tx *wire.MsgTx, witness bool) []byte {
+	witness = witness && hasWitness(tx)
+
+	var buf bytes.Buffer
+	writeUint32(&buf, uint32(tx.Version))
+	if witness {
+		buf.Write([]byte{0x00, 0x01})
+	}
+
+	WriteCompactSize(&buf, uint64(len(tx.TxIn)))
+	for _, txIn := range tx.TxIn {
+		writeOutPoint(&buf, txIn.PreviousOutPoint)
+		writeVarBytes(&buf, txIn.SignatureScript)
+		writeUint32(&buf, txIn.Sequence)
+	}
+
+	WriteCompactSize(&buf, uint64(len(tx.TxOut)))
+	for _, txOut := range tx.TxOut {
+		writeTxOut(&buf, txOut)
+	}
+
+	if witness {
+		for _, txIn := range tx.TxIn {
+			WriteCompactSize(&buf, uint64(len(txIn.Witness)))
+			for _, item := range txIn.Witness {
+				writeVarBytes(&buf, item)
+			}
+		}
+	}
+
+	writeUint32(&buf, tx.LockTime)
+	return buf.Bytes()
+}
+
+// txDecoder lê os campos de uma transação serializada, conferindo os limites.
+type txDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *txDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("transação truncada no byte %d", d.pos)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *txDecoder) uint32() (uint32, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (d *txDecoder) uint64() (uint64, error) {
+	b, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+// ReadCompactSize lê o compact size no início de data e retorna o valor e
+// quantos bytes ele ocupa. Codificações não mínimas são recusadas, como no
+// Bitcoin Core.
+func ReadCompactSize(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("compact size truncado")
+	}
+	var size int
+	var minimum uint64
+	switch data[0] {
+	case 0xfd:
+		size, minimum = 3, 0xfd
+	case 0xfe:
+		size, minimum = 5, 0x10000
+	case 0xff:
+		size, minimum = 9, 0x100000000
+	default:
+		return uint64(data[0]), 1, nil
+	}
+	if len(data) < size {
+		return 0, 0, fmt.Errorf("compact size truncado")
+	}
+	var b [8]byte
+	copy(b[:], data[1:size])
+	n := binary.LittleEndian.Uint64(b[:])
+	if n < minimum {
+		return 0, 0, fmt.Errorf("compact size não canônico")
+	}
+	return n, size, nil
+}
+
+func (d *txDecoder) compactSize() (uint64, error) {
+	n, size, err := ReadCompactSize(d.data[d.pos:])
+	if err != nil {
+		return 0, fmt.Errorf("byte %d: %w", d.pos, err)
+	}
+	d.pos += size
+	return n, nil
+}
+
+// count lê a quantidade de elementos que vêm a seguir, cada um com pelo
+// menos minSize bytes, e recusa quantidades maiores que o restante dos dados.
+func (d *txDecoder) count(minSize int) (int, error) {
+	n, err := d.compactSize()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64((len(d.data)-d.pos)/minSize) {
+		return 0, fmt.Errorf("contagem %d maior que os dados restantes", n)
+	}
+	return int(n), nil
+}
+
+func (d *txDecoder) varBytes() ([]byte, error) {
+	n, err := d.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// DeserializeTx decodifica uma transação serializada, com ou sem witness.
+// Bytes sobrando no fim e witnesses declarados mas todos vazios são recusados.
+func DeserializeTx(data []byte) (*wire.MsgTx, error) {
+	d := &txDecoder{data: data}
+	version, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	tx := &wire.MsgTx{Version: int32(version)}
+
+	// Um 0x00 no lugar da contagem de entradas seguido de um byte não nulo é o
+	// marker do segwit, e esse byte é a flag
+	witness := false
+	if len(data) > d.pos+1 && data[d.pos] == 0x00 && data[d.pos+1] != 0x00 {
+		if data[d.pos+1] != 0x01 {
+			return nil, fmt.Errorf("flag segwit desconhecida: %#x", data[d.pos+1])
+		}
+		witness = true
+		d.pos += 2
+	}
+
+	nIn, err := d.count(41)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nIn; i++ {
+		txIn := &wire.TxIn{}
+		b, err := d.read(chainhash.HashSize)
+		if err != nil {
+			return nil, err
+		}
+		copy(txIn.PreviousOutPoint.Hash[:], b)
+		if txIn.PreviousOutPoint.Index, err = d.uint32(); err != nil {
+			return nil, err
+		}
+		if txIn.SignatureScript, err = d.varBytes(); err != nil {
+			return nil, err
+		}
+		if txIn.Sequence, err = d.uint32(); err != nil {
+			return nil, err
+		}
+		tx.TxIn = append(tx.TxIn, txIn)
+	}
+
+	nOut, err := d.count(9)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nOut; i++ {
+		value, err := d.uint64()
+		if err != nil {
+			return nil, err
+		}
+		pkScript, err := d.varBytes()
+		if err != nil {
+			return nil, err
+		}
+		tx.TxOut = append(tx.TxOut, &wire.TxOut{Value: int64(value), PkScript: pkScript})
+	}
+
+	if witness {
+		for _, txIn := range tx.TxIn {
+			items, err := d.count(1)
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j < items; j++ {
+				item, err := d.varBytes()
+				if err != nil {
+					return nil, err
+				}
+				txIn.Witness = append(txIn.Witness, item)
+			}
+		}
+		if !hasWitness(tx) {
+			return nil, fmt.Errorf("transação marcada como segwit sem nenhum witness")
+		}
+	}
+
+	if tx.LockTime, err = d.uint32(); err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes sobrando depois da transação", len(data)-d.pos)
+	}
+	return tx, nil
+}
+
+// DecodeTransaction decodifica uma transação em hex.
+func DecodeTransaction(rawTx string) (*wire.MsgTx, error) {
+	data, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, fmt.Errorf("transação em hex inválida: %w", err)
+	}
+	tx, err := DeserializeTx(data)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao decodificar transação: %w", err)
+	}
+	return tx, nil
+}
+
+// EncodeTransaction serializa tx com witness, em hex.
+func EncodeTransaction(tx *wire.MsgTx) string {
+	return hex.EncodeToString(SerializeTx(tx, true))
+}
+
+// doubleSHA256 é o SHA-256 aplicado duas vezes, usado em txids e sighashes.
+func doubleSHA256(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+// reverseHex mostra um hash na ordem de exibição (bytes invertidos), como txids.
+func reverseHex(hash [32]byte) string {
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:])
+}
+
+// TxID é o hash da serialização sem witness, na ordem de exibição.
+func TxID(tx *wire.MsgTx) string {
+	return reverseHex(doubleSHA256(SerializeTx(tx, false)))
+}
+
+// WTxID é o hash da serialização com witness (BIP141); igual ao txid sem witness.
+func WTxID(tx *wire.MsgTx) string {
+	return reverseHex(doubleSHA256(SerializeTx(tx, true)))
+}
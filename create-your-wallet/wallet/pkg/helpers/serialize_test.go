@@ -0,0 +1,113 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestCompactSize confere os limites de cada tamanho de compact size e a
+// recusa de codificações não mínimas.
+func TestCompactSize(t *testing.T) {
+	for _, n := range []uint64{0, 0xfc, 0xfd, 0xffff, 0x10000, 0xffffffff, 0x100000000} {
+		var buf bytes.Buffer
+		WriteCompactSize(&buf, n)
+		var ref bytes.Buffer
+		if err := wire.WriteVarInt(&ref, 0, n); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), ref.Bytes()) {
+			t.Fatalf("%d codificado como %x, btcd %x", n, buf.Bytes(), ref.Bytes())
+		}
+		d := &txDecoder{data: buf.Bytes()}
+		if got, err := d.compactSize(); err != nil || got != n {
+			t.Fatalf("%d decodificado como %d (%v)", n, got, err)
+		}
+	}
+	d := &txDecoder{data: []byte{0xfd, 0xfc, 0x00}}
+	if _, err := d.compactSize(); err == nil {
+		t.Fatalf("compact size não canônico aceito")
+	}
+}
+
+// TestSerializeAgainstBtcd assina uma transação P2WPKH com uma chave fixa e
+// compara assinatura, serialização, txid e tamanhos com o btcd.
+func TestSerializeAgainstBtcd(t *testing.T) {
+	seed := sha256.Sum256([]byte("wallet selftest"))
+	privateKey, publicKey := btcec.PrivKeyFromBytes(btcec.S256(), seed[:])
+	program, err := GetP2WPKHProgram(publicKey.SerializeCompressed(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := 0; i < 2; i++ {
+		hash := chainhash.DoubleHashH([]byte{byte(i)})
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(i)), nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(150000, program))
+	nullData, err := NullDataScript([]byte("selftest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.AddTxOut(wire.NewTxOut(0, nullData))
+
+	const value = 100000
+	cache := NewSigHashCache(tx)
+	btcdHashes := txscript.NewTxSigHashes(tx)
+	scriptCode, err := P2WPKHScriptCode(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, txIn := range tx.TxIn {
+		hash, err := WitnessSigHash(tx, cache, i, scriptCode, value, txscript.SigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := SignHash(hash, privateKey, txscript.SigHashAll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := txscript.RawTxInWitnessSignature(tx, btcdHashes, i, value, program, txscript.SigHashAll, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, ref) {
+			t.Fatalf("assinatura da entrada %d difere do btcd", i)
+		}
+		txIn.Witness = wire.TxWitness{sig, publicKey.SerializeCompressed()}
+	}
+
+	var withWitness, stripped bytes.Buffer
+	if err := tx.Serialize(&withWitness); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.SerializeNoWitness(&stripped); err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case !bytes.Equal(SerializeTx(tx, true), withWitness.Bytes()):
+		t.Fatalf("serialização com witness difere do btcd")
+	case !bytes.Equal(SerializeTx(tx, false), stripped.Bytes()):
+		t.Fatalf("serialização sem witness difere do btcd")
+	case TxID(tx) != tx.TxHash().String():
+		t.Fatalf("txid %s, btcd %s", TxID(tx), tx.TxHash())
+	case WTxID(tx) != tx.WitnessHash().String():
+		t.Fatalf("wtxid %s, btcd %s", WTxID(tx), tx.WitnessHash())
+	case TxWeight(tx) != tx.SerializeSizeStripped()*3+tx.SerializeSize():
+		t.Fatalf("peso %d difere do btcd", TxWeight(tx))
+	}
+
+	decoded, err := DeserializeTx(withWitness.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(SerializeTx(decoded, true), withWitness.Bytes()) {
+		t.Fatalf("decodificar e reserializar não reproduz a transação")
+	}
+}
@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SigHashCache guarda os hashes do BIP143 que não dependem da entrada
+// assinada, calculados uma vez por transação.
+type SigHashCache struct {
+	hashPrevouts [32]byte
+	hashSequence [32]byte
+	hashOutputs  [32]byte
+}
+
+// NewSigHashCache calcula os hashes das entradas, sequências e saídas de tx.
+func NewSigHashCache(tx *wire.MsgTx) *SigHashCache {
+	var prevouts, sequences, outputs bytes.Buffer
+	for _, txIn := range tx.TxIn {
+		writeOutPoint(&prevouts, txIn.PreviousOutPoint)
+		writeUint32(&sequences, txIn.Sequence)
+	}
+	for _, txOut := range tx.TxOut {
+		writeTxOut(&outputs, txOut)
+	}
+	return &SigHashCache{
+		hashPrevouts: doubleSHA256(prevouts.Bytes()),
+		hashSequence: doubleSHA256(sequences.Bytes()),
+		hashOutputs:  doubleSHA256(outputs.Bytes()),
+	}
+}
+
+// WitnessSigHash é o digest do BIP143 que a entrada idx de tx assina:
+//
+//	version, hashPrevouts, hashSequence, outpoint, scriptCode, valor,
+//	nSequence, hashOutputs, locktime e o tipo de sighash (4 bytes)
+//
+// scriptCode vai sem o byte de tamanho: o witness script no P2WSH, ou
+// P2WPKHScriptCode no P2WPKH. Com ANYONECANPAY, as demais entradas não entram
+// no digest; com NONE ou SINGLE, as sequências também não, e as saídas se
+// reduzem a nenhuma ou à de mesmo índice. cache pode ser nil.
+func WitnessSigHash(tx *wire.MsgTx, cache *SigHashCache, idx int, scriptCode []byte, value int64, hashType txscript.SigHashType) ([32]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return [32]byte{}, fmt.Errorf("entrada %d fora da transação com %d entradas", idx, len(tx.TxIn))
+	}
+	if cache == nil {
+		cache = NewSigHashCache(tx)
+	}
+	anyoneCanPay := hashType&txscript.SigHashAnyOneCanPay != 0
+	base := hashType & sigHashMask
+
+	var hashPrevouts, hashSequence, hashOutputs [32]byte
+	if !anyoneCanPay {
+		hashPrevouts = cache.hashPrevouts
+	}
+	if !anyoneCanPay && base != txscript.SigHashSingle && base != txscript.SigHashNone {
+		hashSequence = cache.hashSequence
+	}
+	switch {
+	case base != txscript.SigHashSingle && base != txscript.SigHashNone:
+		hashOutputs = cache.hashOutputs
+	case base == txscript.SigHashSingle && idx < len(tx.TxOut):
+		var output bytes.Buffer
+		writeTxOut(&output, tx.TxOut[idx])
+		hashOutputs = doubleSHA256(output.Bytes())
+	}
+
+	txIn := tx.TxIn[idx]
+	var preimage bytes.Buffer
+	writeUint32(&preimage, uint32(tx.Version))
+	preimage.Write(hashPrevouts[:])
+	preimage.Write(hashSequence[:])
+	writeOutPoint(&preimage, txIn.PreviousOutPoint)
+	writeVarBytes(&preimage, scriptCode)
+	writeUint64(&preimage, uint64(value))
+	writeUint32(&preimage, txIn.Sequence)
+	preimage.Write(hashOutputs[:])
+	writeUint32(&preimage, tx.LockTime)
+	writeUint32(&preimage, uint32(hashType))
+	return doubleSHA256(preimage.Bytes()), nil
+}
+
+// sigHashMask separa o tipo base (ALL, NONE, SINGLE) da flag ANYONECANPAY.
+const sigHashMask = 0x1f
+
+// P2WPKHScriptCode é o scriptCode do BIP143 para gastar um P2WPKH: o script
+// P2PKH do mesmo hash, OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG.
+func P2WPKHScriptCode(witnessProgram []byte) ([]byte, error) {
+	if len(witnessProgram) != 22 || witnessProgram[0] != txscript.OP_0 || witnessProgram[1] != txscript.OP_DATA_20 {
+		return nil, fmt.Errorf("scriptPubKey não é P2WPKH: %x", witnessProgram)
+	}
+	script := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	script = append(script, witnessProgram[2:]...)
+	return append(script, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG), nil
+}
+
+// SignHash assina o digest com a chave (ECDSA com nonce do RFC6979 e S baixo)
+// e retorna a assinatura DER seguida do byte do tipo de sighash.
+func SignHash(hash [32]byte, privateKey *btcec.PrivateKey, hashType txscript.SigHashType) ([]byte, error) {
+	signature, err := privateKey.Sign(hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("falha ao assinar: %w", err)
+	}
+	return append(signature.Serialize(), byte(hashType)), nil
+}
@@ -0,0 +1,222 @@
+package helpers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// SigningKeys indexa as chaves privadas da carteira (recebimento e troco) pela
+// chave pública em hex, para assinar entradas multisig. No modo watch-only
+// não há chaves privadas e o mapa fica vazio.
+func SigningKeys(state *models.WalletState) map[string][]byte {
+	keys := make(map[string][]byte, len(state.PublicKeys)+len(state.ChangeKeys))
+	for i, pubKey := range state.PublicKeys {
+		if state.PrivateKeys[i] != nil {
+			keys[hex.EncodeToString(pubKey)] = state.PrivateKeys[i]
+		}
+	}
+	for _, key := range state.ChangeKeys {
+		if key.PrivateKey != nil {
+			keys[hex.EncodeToString(key.PublicKey)] = key.PrivateKey
+		}
+	}
+	return keys
+}
+
+// SignTransaction assina as entradas de tx que gastam prevouts, na ordem das
+// entradas. P2WPKH usa a chave privada do UTXO; multisig P2WSH usa as chaves
+// de keys que fazem parte do script, preservando as assinaturas de outros
+// participantes já presentes no witness. Um prevout sem ScriptPubKey não é da
+// carteira e a entrada fica com o witness que tiver. Retorna se todas as
+// entradas estão completas; cada entrada completa é conferida pelo
+// interpretador de script.
+func SignTransaction(tx *wire.MsgTx, prevouts []models.UTXO, keys map[string][]byte) (bool, error) {
+	if len(prevouts) != len(tx.TxIn) {
+		return false, fmt.Errorf("%d UTXOs para %d entradas", len(prevouts), len(tx.TxIn))
+	}
+
+	// Calcular os hashes de assinatura
+	sigHashes := NewSigHashCache(tx)
+
+	complete := true
+	for i, txIn := range tx.TxIn {
+		utxo := prevouts[i]
+		if len(utxo.ScriptPubKey) == 0 {
+			complete = complete && len(txIn.Witness) > 0
+			continue
+		}
+		value := int64(math.Round(utxo.Value * 1e8))
+
+		signed := true
+		var err error
+		if len(utxo.WitnessScript) > 0 {
+			signed, err = signMultisigInput(tx, sigHashes, i, value, utxo.WitnessScript, keys)
+		} else {
+			err = signP2WPKHInput(tx, sigHashes, i, value, utxo)
+		}
+		if err != nil {
+			return false, fmt.Errorf("entrada %d (%s:%d): %w", i, utxo.TxID, utxo.VoutIndex, err)
+		}
+		if !signed {
+			complete = false
+			continue
+		}
+
+		// Verificar a assinatura; o interpretador do btcd calcula o sighash por
+		// conta própria, conferindo também o nosso
+		vm, err := txscript.NewEngine(utxo.ScriptPubKey, tx, i, txscript.StandardVerifyFlags, nil, nil, value)
+		if err != nil {
+			return false, fmt.Errorf("falha ao verificar: %w", err)
+		}
+		if err := vm.Execute(); err != nil {
+			return false, fmt.Errorf("verificação de assinatura da entrada %d falhou: %w", i, err)
+		}
+	}
+	return complete, nil
+}
+
+// signP2WPKHInput assina a entrada idx com a chave privada do UTXO.
+func signP2WPKHInput(tx *wire.MsgTx, sigHashes *SigHashCache, idx int, value int64, utxo models.UTXO) error {
+	if utxo.PrivateKey == nil {
+		return fmt.Errorf("sem chave privada para o endereço %s", utxo.Address)
+	}
+
+	// Decode private key
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), utxo.PrivateKey)
+
+	decodedAddress, err := btcutil.DecodeAddress(utxo.Address, &chaincfg.MainNetParams)
+	if err != nil {
+		return fmt.Errorf("falha ao decodificar endereço %s: %w", utxo.Address, err)
+	}
+
+	pkScript, err := txscript.PayToAddrScript(decodedAddress)
+	if err != nil {
+		return fmt.Errorf("falha ao criar Pay-to-Addr Script para o endereço %s: %w", utxo.Address, err)
+	}
+
+	// Criar a assinatura Witness sobre o digest do BIP143
+	scriptCode, err := P2WPKHScriptCode(pkScript)
+	if err != nil {
+		return err
+	}
+	hash, err := WitnessSigHash(tx, sigHashes, idx, scriptCode, value, txscript.SigHashAll)
+	if err != nil {
+		return err
+	}
+	sig, err := SignHash(hash, privateKey, txscript.SigHashAll)
+	if err != nil {
+		return fmt.Errorf("falha ao criar assinatura Witness: %w", err)
+	}
+
+	// Adiciona a assinatura e a chave pública a Witness
+	tx.TxIn[idx].Witness = wire.TxWitness{sig, privateKey.PubKey().SerializeCompressed()}
+	return nil
+}
+
+// signMultisigInput assina a entrada idx, que gasta o P2WSH de witnessScript,
+// com as chaves de keys e retorna se ela já tem as m assinaturas.
+//
+// O sighash é o do BIP143 com o witness script como scriptCode. Completa, a
+// entrada fica com o witness <vazio> <sig...> <witnessScript>, com m
+// assinaturas na ordem das chaves do script, como o OP_CHECKMULTISIG exige; o
+// item vazio é o dummy que ele consome a mais (BIP147). Parcial, fica com uma
+// posição por chave, vazia onde falta assinatura, para o próximo participante
+// completar.
+func signMultisigInput(tx *wire.MsgTx, sigHashes *SigHashCache, idx int, value int64, witnessScript []byte, keys map[string][]byte) (bool, error) {
+	m, pubKeys, err := ParseMultisigScript(witnessScript)
+	if err != nil {
+		return false, err
+	}
+	hash, err := WitnessSigHash(tx, sigHashes, idx, witnessScript, value, txscript.SigHashAll)
+	if err != nil {
+		return false, err
+	}
+
+	// Assinaturas válidas já presentes vão para a posição da sua chave
+	sigs := make([][]byte, len(pubKeys))
+	for _, item := range tx.TxIn[idx].Witness {
+		for j, pubKey := range pubKeys {
+			if sigs[j] == nil && verifySignature(item, hash, pubKey) {
+				sigs[j] = item
+				break
+			}
+		}
+	}
+
+	count := 0
+	for j, pubKey := range pubKeys {
+		if sigs[j] == nil {
+			privKey, ok := keys[hex.EncodeToString(pubKey)]
+			if !ok {
+				continue
+			}
+			key, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKey)
+			sigs[j], err = SignHash(hash, key, txscript.SigHashAll)
+			if err != nil {
+				return false, fmt.Errorf("falha ao criar assinatura Witness: %w", err)
+			}
+		}
+		count++
+	}
+
+	witness := wire.TxWitness{nil}
+	for _, sig := range sigs {
+		switch {
+		case count < m:
+			witness = append(witness, sig)
+		case sig != nil && len(witness) <= m:
+			witness = append(witness, sig)
+		}
+	}
+	tx.TxIn[idx].Witness = append(witness, witnessScript)
+	return count >= m, nil
+}
+
+// verifySignature indica se item é uma assinatura SIGHASH_ALL válida de
+// pubKey sobre hash.
+func verifySignature(item []byte, hash [32]byte, pubKey []byte) bool {
+	if len(item) < 9 || txscript.SigHashType(item[len(item)-1]) != txscript.SigHashAll {
+		return false
+	}
+	sig, err := btcec.ParseDERSignature(item[:len(item)-1], btcec.S256())
+	if err != nil {
+		return false
+	}
+	key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return false
+	}
+	return sig.Verify(hash[:], key)
+}
+
+// SignRawTransaction acrescenta as assinaturas da carteira a uma transação em
+// hex, tipicamente um gasto multisig parcialmente assinado por outro
+// participante. As entradas são procuradas nos UTXOs do estado; as que não
+// são da carteira mantêm o witness recebido. Retorna a transação em hex e se
+// ela está completa.
+func SignRawTransaction(rawTx string, state *models.WalletState) (string, bool, error) {
+	tx, err := DecodeTransaction(strings.TrimSpace(rawTx))
+	if err != nil {
+		return "", false, err
+	}
+
+	prevouts := make([]models.UTXO, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		prevouts[i] = state.UTXOs[txIn.PreviousOutPoint.String()]
+	}
+	complete, err := SignTransaction(tx, prevouts, SigningKeys(state))
+	if err != nil {
+		return "", false, err
+	}
+	return EncodeTransaction(tx), complete, nil
+}
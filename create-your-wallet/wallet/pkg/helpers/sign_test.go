@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"wallet/pkg/coinselect"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testMultisigSpend monta uma transação sem assinaturas que gasta um UTXO
+// do multisig 2-de-3 das chaves de recebimento 0 a 2 de testXprv.
+func testMultisigSpend(t *testing.T) (*models.WalletState, *wire.MsgTx, models.UTXO) {
+	t.Helper()
+	state, _ := testWallet(t, 0, 0)
+	ms, err := NewMultisig(2, state.PublicKeys, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxo := models.UTXO{
+		TxID:          strings.Repeat("a", 64),
+		Address:       ms.Address,
+		Value:         0.001,
+		Height:        100,
+		ScriptPubKey:  ms.WitnessProgram,
+		WitnessScript: ms.WitnessScript,
+	}
+	tx := wire.NewMsgTx(2)
+	txIn, err := spendInput(utxo, wire.MaxTxInSequenceNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txIn.Witness = nil
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(99000, testPayment))
+	return state, tx, utxo
+}
+
+// participantKeys são as chaves de assinatura de um participante só.
+func participantKeys(state *models.WalletState, i int) map[string][]byte {
+	return map[string][]byte{hex.EncodeToString(state.PublicKeys[i]): state.PrivateKeys[i]}
+}
+
+func TestSignMultisigPartialThenComplete(t *testing.T) {
+	state, tx, utxo := testMultisigSpend(t)
+
+	// O terceiro participante assina primeiro: uma posição por chave, com o
+	// dummy, a assinatura na posição 2 e o script
+	complete, err := SignTransaction(tx, []models.UTXO{utxo}, participantKeys(state, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness := tx.TxIn[0].Witness
+	if complete || len(witness) != 5 || witness[0] != nil || witness[1] != nil || witness[2] != nil || witness[3] == nil {
+		t.Fatalf("witness parcial %x (completa: %t)", witness, complete)
+	}
+	if !bytes.Equal(witness[4], utxo.WitnessScript) {
+		t.Fatal("witness parcial sem o witness script no fim")
+	}
+
+	// Assinar de novo com a mesma chave não completa a entrada
+	if complete, err := SignTransaction(tx, []models.UTXO{utxo}, participantKeys(state, 2)); err != nil || complete {
+		t.Fatalf("mesma chave completou a entrada (%v)", err)
+	}
+
+	// O primeiro participante completa: dummy, assinaturas na ordem das
+	// chaves do script e o script, conferidos pelo interpretador
+	complete, err = SignTransaction(tx, []models.UTXO{utxo}, participantKeys(state, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness = tx.TxIn[0].Witness
+	if !complete || len(witness) != 4 || len(witness[0]) != 0 {
+		t.Fatalf("witness completo %x (completa: %t)", witness, complete)
+	}
+	hash, err := WitnessSigHash(tx, nil, 0, utxo.WitnessScript, 100000, txscript.SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifySignature(witness[1], hash, state.PublicKeys[0]) || !verifySignature(witness[2], hash, state.PublicKeys[2]) {
+		t.Fatal("assinaturas fora da ordem das chaves do script")
+	}
+}
+
+func TestSignMultisigRejectsForeignSignature(t *testing.T) {
+	state, tx, utxo := testMultisigSpend(t)
+	if _, err := SignTransaction(tx, []models.UTXO{utxo}, participantKeys(state, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uma assinatura de outra transação não conta para a entrada
+	other := tx.Copy()
+	other.TxOut[0].Value--
+	other.TxIn[0].Witness = nil
+	if _, err := SignTransaction(other, []models.UTXO{utxo}, participantKeys(state, 0)); err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].Witness = wire.TxWitness{nil, other.TxIn[0].Witness[1], tx.TxIn[0].Witness[2], nil, utxo.WitnessScript}
+	complete, err := SignTransaction(tx, []models.UTXO{utxo}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if complete || tx.TxIn[0].Witness[1] != nil {
+		t.Fatalf("assinatura de outra transação aceita: %x", tx.TxIn[0].Witness)
+	}
+}
+
+func TestCreateTransactionMultisigWeight(t *testing.T) {
+	state, _, utxo := testMultisigSpend(t)
+	options := SendOptions{
+		Strategy:      coinselect.StrategyLargest,
+		FeeRate:       5,
+		ChangeAddress: state.ChangeKeys[0].Address,
+		Keys:          SigningKeys(state),
+	}
+	rawTx, selection, complete, err := CreateTransaction(map[string]models.UTXO{utxo.TxID + ":0": utxo}, state.Addresses[0][0], 0.0005, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := DecodeTransaction(rawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !complete || TxWeight(tx) > selection.Weight {
+		t.Fatalf("multisig assinado com peso %d, estimado %d (completa: %t)", TxWeight(tx), selection.Weight, complete)
+	}
+}
@@ -1,12 +1,13 @@
 package helpers
 
 import (
-	"bytes"
-	"encoding/hex"
 	"fmt"
+	"math"
+	"math/rand"
+
+	"wallet/pkg/coinselect"
 	"wallet/pkg/models"
 
-	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
@@ -14,106 +15,248 @@ import (
 	"github.com/btcsuite/btcutil"
 )
 
-func CreateTransaction(utxos map[string]models.UTXO, destinationAddress string, amount, fee float64) (string, error) {
-	tx := wire.NewMsgTx(wire.TxVersion)
+// SendOptions são as escolhas de cada envio.
+type SendOptions struct {
+	Strategy        string  // Estratégia de seleção de entradas (coinselect.Strategy*)
+	FeeRate         float64 // Taxa em sat/vB; 0 usa a estimativa para ConfTarget
+	ConfTarget      int     // Alvo de confirmação em blocos para o estimatesmartfee
+	FallbackFeeRate float64 // Taxa usada se o nó não tiver estimativa; 0 recusa o envio
+	MaxFee          float64 // Taxa absoluta máxima em BTC; 0 desativa o limite
+	MaxFeeRate      float64 // Taxa máxima em sat/vB; 0 desativa o limite
+	ChangeAddress   string  // Endereço P2WPKH que recebe o troco
+	RBF             bool    // Sinaliza substituição por taxa (BIP125) nas entradas
 
-	totalInput := 0.0
+	// Conteúdo de saídas OP_RETURN de valor zero, depois do pagamento
+	Data [][]byte
 
-	// Entradas
-	for _, utxo := range utxos {
-		txHash, err := chainhash.NewHashFromStr(utxo.TxID)
-		if err != nil {
-			return "", fmt.Errorf("falha ao decodificar txid: %w", err)
-		}
-		outPoint := wire.NewOutPoint(txHash, uint32(utxo.VoutIndex))
-		txIn := wire.NewTxIn(outPoint, nil, nil)
-		tx.AddTxIn(txIn)
+	// Chaves privadas por chave pública (hex) para assinar entradas multisig;
+	// veja SigningKeys
+	Keys map[string][]byte
+}
+
+// Tentativas de ajustar a seleção ao peso real da transação
+const maxFeeIterations = 10
 
-		totalInput += utxo.Value
+// CreateTransaction escolhe entre utxos as entradas que pagam amount ao
+// destino e retorna a transação assinada junto com a seleção usada; veja
+// BuildTransaction. Entradas multisig sem chaves suficientes em options.Keys
+// ficam parcialmente assinadas; o retorno complete indica se a transação pode
+// ser transmitida.
+func CreateTransaction(utxos map[string]models.UTXO, destinationAddress string, amount float64, options SendOptions) (string, *coinselect.Selection, bool, error) {
+	tx, selection, err := BuildTransaction(utxos, destinationAddress, amount, options)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	complete, err := SignTransaction(tx, selection.UTXOs(), options.Keys)
+	if err != nil {
+		return "", nil, false, err
 	}
 
-	// Verifica se o saldo cobre a transação e a taxa
-	if totalInput < (amount + fee) {
-		return "", fmt.Errorf("saldo insuficiente para cobrir a transação e a taxa")
+	// As assinaturas reais nunca são maiores que as usadas na estimativa
+	if weight := TxWeight(tx); complete && weight > selection.Weight {
+		return "", nil, false, fmt.Errorf("transação assinada com peso %d maior que o estimado (%d)", weight, selection.Weight)
 	}
-	change := totalInput - (amount + fee)
 
+	return EncodeTransaction(tx), selection, complete, nil
+}
+
+// BuildTransaction escolhe entre utxos as entradas que pagam amount ao
+// destino com a estratégia e a taxa de options, e retorna a transação sem
+// assinaturas junto com a seleção usada, cujas entradas estão na ordem das
+// entradas da transação. O troco vai para options.ChangeAddress. A seleção
+// estima o peso das entradas; o peso exato da transação montada (com
+// assinaturas de tamanho máximo) é conferido e a seleção refeita até que a
+// taxa paga cubra esse peso. Taxa acima dos limites de options é recusada.
+// Cada item de options.Data vira uma saída OP_RETURN de valor zero depois do
+// pagamento, dentro dos limites padrão de tamanho e quantidade. Com
+// options.RBF as entradas usam RBFSequence e a transação pode ser substituída
+// com BumpFee enquanto não confirmar.
+func BuildTransaction(utxos map[string]models.UTXO, destinationAddress string, amount float64, options SendOptions) (*wire.MsgTx, *coinselect.Selection, error) {
 	// Destino
 	destinationAddr, err := btcutil.DecodeAddress(destinationAddress, &chaincfg.MainNetParams)
 	if err != nil {
-		return "", fmt.Errorf("endereço de destino inválido: %w", err)
+		return nil, nil, fmt.Errorf("endereço de destino inválido: %w", err)
 	}
 	pkScript, err := txscript.PayToAddrScript(destinationAddr)
 	if err != nil {
-		return "", fmt.Errorf("falha ao criar Pay-to-Addr Script: %w", err)
-	}
-	txOut := wire.NewTxOut(int64(amount*1e8), pkScript)
-	tx.AddTxOut(txOut)
-
-	// Troco
-	if change > 0 {
-		var fromAddress btcutil.Address
-		for _, utxo := range utxos {
-			fromAddress, err = btcutil.DecodeAddress(utxo.Address, &chaincfg.MainNetParams)
-			if err != nil {
-				return "", fmt.Errorf("falha ao decodificar endereço de troco: %w", err)
-			}
-			break // Pega o primeiro UTXO encontrado
-		}
+		return nil, nil, fmt.Errorf("falha ao criar Pay-to-Addr Script: %w", err)
+	}
+	amountSats := int64(math.Round(amount * 1e8))
+	outputs := []*wire.TxOut{wire.NewTxOut(amountSats, pkScript)}
+
+	if len(options.Data) > MaxDataOutputs {
+		return nil, nil, fmt.Errorf("%d saídas OP_RETURN, acima do limite padrão de %d", len(options.Data), MaxDataOutputs)
+	}
+	for _, data := range options.Data {
+		script, err := NullDataScript(data)
 		if err != nil {
-			return "", fmt.Errorf("falha ao decodificar endereço de troco: %w", err)
+			return nil, nil, err
 		}
-		changeAddrScript, err := txscript.PayToAddrScript(fromAddress)
+		outputs = append(outputs, wire.NewTxOut(0, script))
+	}
+
+	feeRate, err := ResolveFeeRate(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coins := make([]coinselect.Coin, 0, len(utxos))
+	for outpoint, utxo := range utxos {
+		coin, err := coinselect.NewCoin(outpoint, utxo)
 		if err != nil {
-			return "", fmt.Errorf("falha ao criar script de troco: %w", err)
+			return nil, nil, err
 		}
-		changeOut := wire.NewTxOut(int64(change*1e8), changeAddrScript)
-		tx.AddTxOut(changeOut)
+		coins = append(coins, coin)
+	}
+	changeAddr, err := btcutil.DecodeAddress(options.ChangeAddress, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, nil, fmt.Errorf("endereço de troco inválido: %w", err)
+	}
+	changeScript, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("falha ao criar script de troco: %w", err)
 	}
 
-	// Assinar entradas
-	for i, txIn := range tx.TxIn {
-		utxo := utxos[fmt.Sprintf("%s:%d", txIn.PreviousOutPoint.Hash.String(), txIn.PreviousOutPoint.Index)]
-
-		// Decode private key
-		privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), utxo.PrivateKey)
+	params := coinselect.Params{
+		FeeRate:      feeRate,
+		BaseWeight:   coinselect.TxOverheadWeight,
+		ChangeWeight: coinselect.OutputWeight(changeScript),
+	}
+	for _, out := range outputs {
+		params.BaseWeight += coinselect.OutputWeight(out.PkScript)
+	}
 
-		decodedAddress, err := btcutil.DecodeAddress(utxo.Address, &chaincfg.MainNetParams)
+	var tx *wire.MsgTx
+	var selection *coinselect.Selection
+	for attempt := 0; ; attempt++ {
+		if attempt == maxFeeIterations {
+			return nil, nil, fmt.Errorf("a taxa não convergiu para o peso da transação em %d tentativas", maxFeeIterations)
+		}
+		selection, err = coinselect.Select(options.Strategy, coins, amountSats, params)
 		if err != nil {
-			return "", fmt.Errorf("falha ao decodificar endereço %s: %w", utxo.Address, err)
+			return nil, nil, fmt.Errorf("falha na seleção de entradas: %w", err)
 		}
-
-		pkScript, err := txscript.PayToAddrScript(decodedAddress)
+		var changePos int
+		tx, changePos, err = buildTransaction(selection, outputs, changeScript, inputSequence(options))
 		if err != nil {
-			return "", fmt.Errorf("falha ao criar Pay-to-Addr Script para o endereço %s: %w", utxo.Address, err)
+			return nil, nil, err
+		}
+
+		weight := TxWeight(tx)
+		required := FeeForWeight(weight, feeRate)
+		if selection.Fee < required {
+			// Estimativa curta (contagens grandes de vin/vout, por exemplo):
+			// a diferença passa a fazer parte do peso base e a seleção é refeita
+			params.BaseWeight += weight - selection.Weight
+			continue
 		}
+		if selection.Change > 0 && selection.Fee > required {
+			// Estimativa longa: o que sobrou da taxa volta para o troco
+			selection.Change += selection.Fee - required
+			selection.Fee = required
+			tx.TxOut[changePos].Value = selection.Change
+		}
+		selection.Weight = weight
+		break
+	}
 
-		// Calcular os hashes de assinatura
-		sigHashes := txscript.NewTxSigHashes(tx)
+	if err := checkFeeCaps(selection, options); err != nil {
+		return nil, nil, err
+	}
 
-		// Criar a assinatura Witness
-		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, i, int64(utxo.Value*1e8), pkScript, txscript.SigHashAll, privateKey)
+	// O witness de tamanho máximo só servia para medir o peso
+	for _, txIn := range tx.TxIn {
+		txIn.Witness = nil
+	}
+	return tx, selection, nil
+}
+
+// buildTransaction monta a transação da seleção e das saídas com witnesses de
+// tamanho máximo no lugar das assinaturas, para que o peso seja o da transação final.
+// O troco, se houver, vai numa posição aleatória entre as saídas, para não
+// ser identificável pela ordem; retorna essa posição ou -1 sem troco.
+func buildTransaction(selection *coinselect.Selection, outputs []*wire.TxOut, changeScript []byte, sequence uint32) (*wire.MsgTx, int, error) {
+	// Versão 2, como o Bitcoin Core; o PSBT v2 não aceita versão menor
+	tx := wire.NewMsgTx(2)
+
+	// Entradas
+	for _, coin := range selection.Coins {
+		txHash, err := chainhash.NewHashFromStr(coin.UTXO.TxID)
+		if err != nil {
+			return nil, -1, fmt.Errorf("falha ao decodificar txid: %w", err)
+		}
+		outPoint := wire.NewOutPoint(txHash, uint32(coin.UTXO.VoutIndex))
+		txIn := wire.NewTxIn(outPoint, nil, nil)
+		txIn.Sequence = sequence
+		witness, err := dummyWitness(coin.UTXO)
 		if err != nil {
-			return "", fmt.Errorf("falha ao criar assinatura Witness: %w", err)
+			return nil, -1, fmt.Errorf("%s: %w", coin.Outpoint, err)
 		}
+		txIn.Witness = witness
+		tx.AddTxIn(txIn)
+	}
+
+	for _, out := range outputs {
+		tx.AddTxOut(wire.NewTxOut(out.Value, out.PkScript))
+	}
 
-		// Adiciona a assinatura e a chave pública a Witness
-		txIn.Witness = wire.TxWitness{sig, privateKey.PubKey().SerializeCompressed()}
+	// Troco abaixo do limite de poeira já foi somado à taxa pela seleção
+	if selection.Change == 0 {
+		return tx, -1, nil
+	}
+	return tx, insertChange(tx, wire.NewTxOut(selection.Change, changeScript)), nil
+}
+
+// insertChange põe o troco numa posição aleatória entre as saídas de tx e
+// retorna essa posição.
+func insertChange(tx *wire.MsgTx, change *wire.TxOut) int {
+	pos := rand.Intn(len(tx.TxOut) + 1)
+	tx.TxOut = append(tx.TxOut, nil)
+	copy(tx.TxOut[pos+1:], tx.TxOut[pos:])
+	tx.TxOut[pos] = change
+	return pos
+}
 
-		// Verificar a assinatura
-		vm, err := txscript.NewEngine(pkScript, tx, i, txscript.StandardVerifyFlags, nil, nil, int64(utxo.Value*1e8))
+// inputSequence é o nSequence das entradas do envio: RBFSequence com
+// options.RBF, senão o máximo, que torna a transação final.
+func inputSequence(options SendOptions) uint32 {
+	if options.RBF {
+		return RBFSequence
+	}
+	return wire.MaxTxInSequenceNum
+}
+
+// dummyWitness é um witness do maior tamanho possível para gastar o UTXO:
+// assinaturas DER low-S de até 71 bytes mais o byte de sighash.
+func dummyWitness(utxo models.UTXO) (wire.TxWitness, error) {
+	if len(utxo.WitnessScript) > 0 {
+		m, _, err := ParseMultisigScript(utxo.WitnessScript)
 		if err != nil {
-			return "", fmt.Errorf("falha ao verificar: %w", err)
+			return nil, err
 		}
-		if err := vm.Execute(); err != nil {
-			return "", fmt.Errorf("verificação de assinatura falhou: %w", err)
+		witness := wire.TxWitness{nil}
+		for i := 0; i < m; i++ {
+			witness = append(witness, make([]byte, 72))
 		}
+		return append(witness, utxo.WitnessScript), nil
+	}
+	script := utxo.ScriptPubKey
+	if len(script) == 22 && script[0] == txscript.OP_0 && script[1] == txscript.OP_DATA_20 {
+		return wire.TxWitness{make([]byte, 72), make([]byte, 33)}, nil
 	}
+	return nil, fmt.Errorf("tipo de script não suportado para gasto: %x", script)
+}
 
-	var buf bytes.Buffer
-	err = tx.Serialize(&buf)
-	if err != nil {
-		return "", fmt.Errorf("falha ao serializar transação: %w", err)
+// checkFeeCaps recusa taxas acima dos limites do envio, incluindo o excesso
+// que vai para a taxa quando não há troco.
+func checkFeeCaps(selection *coinselect.Selection, options SendOptions) error {
+	if options.MaxFee > 0 && selection.Fee > int64(math.Round(options.MaxFee*1e8)) {
+		return fmt.Errorf("taxa de %d sat acima do limite de %.8f BTC", selection.Fee, options.MaxFee)
+	}
+	feeRate := float64(selection.Fee) / float64(VSize(selection.Weight))
+	if options.MaxFeeRate > 0 && feeRate > options.MaxFeeRate {
+		return fmt.Errorf("taxa efetiva de %.3f sat/vB acima do limite de %.3f sat/vB", feeRate, options.MaxFeeRate)
 	}
-	return hex.EncodeToString(buf.Bytes()), nil
+	return nil
 }
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"bytes"
+	"testing"
+
+	"wallet/pkg/coinselect"
+)
+
+func TestBuildTransactionChange(t *testing.T) {
+	// Uma entrada de 100000 sat e saídas P2WPKH a 1 sat/vB: 110 vB sem troco
+	// e 141 vB com troco
+	tests := []struct {
+		name       string
+		amount     int64
+		wantChange bool
+	}{
+		{"troco para a chave interna", 50000, true},
+		{"troco no limite de poeira", 100000 - 141 - coinselect.DustLimit, true},
+		{"troco abaixo da poeira vai para a taxa", 100000 - 110 - coinselect.DustLimit + 1, false},
+		{"sem troco", 100000 - 110, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state, utxos := testWallet(t, 100000)
+			change := state.ChangeKeys[0]
+			options := SendOptions{
+				Strategy:      coinselect.StrategyLargest,
+				FeeRate:       1,
+				ChangeAddress: change.Address,
+			}
+			tx, selection, err := BuildTransaction(utxos, state.Addresses[1][0], float64(tc.amount)/1e8, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changeOutputs := 0
+			var outTotal int64
+			for _, out := range tx.TxOut {
+				outTotal += out.Value
+				if bytes.Equal(out.PkScript, change.WitnessProgram) {
+					changeOutputs++
+					if out.Value != selection.Change {
+						t.Fatalf("saída de troco de %d sat, seleção diz %d", out.Value, selection.Change)
+					}
+				}
+			}
+			if tc.wantChange != (changeOutputs == 1) || changeOutputs > 1 {
+				t.Fatalf("%d saídas de troco, esperava troco: %t", changeOutputs, tc.wantChange)
+			}
+			if tc.wantChange && selection.Change < coinselect.DustLimit {
+				t.Fatalf("troco de %d sat abaixo do limite de poeira", selection.Change)
+			}
+			if !tc.wantChange && (selection.Change != 0 || len(tx.TxOut) != 1) {
+				t.Fatalf("troco %d em %d saídas, esperava só o pagamento", selection.Change, len(tx.TxOut))
+			}
+			if fee := selection.Total - outTotal; fee != selection.Fee {
+				t.Fatalf("taxa paga %d, relatada %d", fee, selection.Fee)
+			}
+		})
+	}
+}
+
+func TestBuildTransactionRejectsBadChangeAddress(t *testing.T) {
+	state, utxos := testWallet(t, 100000)
+	options := SendOptions{FeeRate: 1, ChangeAddress: "não é endereço"}
+	if _, _, err := BuildTransaction(utxos, state.Addresses[1][0], 0.0005, options); err == nil {
+		t.Fatal("endereço de troco inválido aceito")
+	}
+}
+
+func TestNextChangeKey(t *testing.T) {
+	state, _ := testWallet(t)
+	key, err := NextChangeKey(state)
+	if err != nil || key.Index != 0 {
+		t.Fatalf("chave %d (%v), esperava a de troco 0", key.Index, err)
+	}
+
+	// Troco visto num envio ou na cadeia marca a chave e as anteriores como usadas
+	if !state.MarkChangeUsed(state.ChangeKeys[3].Address) || state.ChangeIndex != 4 {
+		t.Fatalf("índice de troco %d depois de usar a chave 3, esperava 4", state.ChangeIndex)
+	}
+	if state.MarkChangeUsed(state.ChangeKeys[1].Address) || state.MarkChangeUsed(state.Addresses[0][0]) {
+		t.Fatal("chave já usada ou de recebimento mudou o índice de troco")
+	}
+	if key, err := NextChangeKey(state); err != nil || key.Index != 4 {
+		t.Fatalf("chave %d (%v), esperava a de troco 4", key.Index, err)
+	}
+
+	state.ChangeIndex = len(state.ChangeKeys)
+	if _, err := NextChangeKey(state); err == nil {
+		t.Fatal("chave de troco não derivada aceita")
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"wallet/pkg/models"
 )
 
-func UpdateUTXO(state *models.WalletState, txid string, voutIndex int, value float64, address string, privateKey []byte) {
-	utxoKey := fmt.Sprintf("%s:%d", txid, voutIndex)
+// UpdateUTXO adiciona o UTXO ao estado. Retorna false se ele já existia.
+func UpdateUTXO(state *models.WalletState, utxo models.UTXO) bool {
+	utxoKey := fmt.Sprintf("%s:%d", utxo.TxID, utxo.VoutIndex)
 
 	// Inicializa o mapa se ele for nil
 	if state.UTXOs == nil {
@@ -15,24 +16,40 @@ func UpdateUTXO(state *models.WalletState, txid string, voutIndex int, value flo
 
 	// Verifique se o UTXO já existe
 	if _, exists := state.UTXOs[utxoKey]; exists {
-		return // Já processado
+		return false // Já processado
 	}
 
 	// Adicione o UTXO completo
-	state.UTXOs[utxoKey] = models.UTXO{
-		TxID:       txid,
-		VoutIndex:  voutIndex,
-		Address:    address,
-		PrivateKey: privateKey,
-		Value:      value,
-	}
+	state.UTXOs[utxoKey] = utxo
 
-	fmt.Printf("Atualizando UTXO: %s com valor %.8f e endereço %s\n", utxoKey, value, address)
+	fmt.Printf("Atualizando UTXO: %s com valor %.8f e endereço %s (bloco %d)\n", utxoKey, utxo.Value, utxo.Address, utxo.Height)
+	return true
 }
 
-func CalculateBalance(state *models.WalletState) {
+// CalculateBalance soma os UTXOs da carteira na altura tipHeight.
+// Saídas coinbase imaturas ficam fora do saldo gastável.
+func CalculateBalance(state *models.WalletState, tipHeight int) {
 	state.Balance = 0
+	state.ImmatureBalance = 0
 	for _, utxo := range state.UTXOs {
+		if !utxo.IsMature(tipHeight) {
+			state.ImmatureBalance += utxo.Value
+			continue
+		}
 		state.Balance += utxo.Value // Soma o valor de cada UTXO
 	}
 }
+
+// IsCoinbase indica se a transação (formato do getblock verbosity 2) é uma coinbase.
+func IsCoinbase(txMap map[string]interface{}) bool {
+	vinList, ok := txMap["vin"].([]interface{})
+	if !ok || len(vinList) == 0 {
+		return false
+	}
+	vinMap, ok := vinList[0].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, coinbase := vinMap["coinbase"]
+	return coinbase
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	"wallet/pkg/models"
+)
+
+const testXprv = "tprv8ZgxMBicQKsPdt2JSGYoFa3bag1DMeGF8zdJC3ECLwCbUWdoZMq2wkqrN3zMaY9ep1RpD6yqLLmPohMgptXQ56YHr5NBLoUoXxLv97MjDcz"
+
+// testPayment é o scriptPubKey P2WPKH de um destino fora da carteira.
+var testPayment = append([]byte{0x00, 0x14}, make([]byte, 20)...)
+
+// testWallet deriva uma carteira de testXprv com as chaves de troco e um UTXO
+// confirmado de values[i] satoshis na chave de recebimento i.
+func testWallet(t *testing.T, values ...int64) (*models.WalletState, map[string]models.UTXO) {
+	t.Helper()
+	state := &models.WalletState{UTXOs: make(map[string]models.UTXO)}
+	if err := DeriveKeyPairs(testXprv, len(values)+1, state); err != nil {
+		t.Fatal(err)
+	}
+	for _, pubKey := range state.PublicKeys {
+		program, err := GetP2WPKHProgram(pubKey, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.WitnessPrograms = append(state.WitnessPrograms, program)
+	}
+	if _, err := DeriveChangeKeys(testXprv, state); err != nil {
+		t.Fatal(err)
+	}
+
+	utxos := make(map[string]models.UTXO)
+	for i, value := range values {
+		utxo := testUTXO(state, i, fmt.Sprintf("%064x", i+1), value)
+		state.UTXOs[fmt.Sprintf("%s:0", utxo.TxID)] = utxo
+		utxos[fmt.Sprintf("%s:0", utxo.TxID)] = utxo
+	}
+	return state, utxos
+}
+
+// testUTXO é a saída 0 de txid, de value satoshis, na chave de recebimento i.
+func testUTXO(state *models.WalletState, i int, txid string, value int64) models.UTXO {
+	return models.UTXO{
+		TxID:         txid,
+		Address:      state.Addresses[i][0],
+		PrivateKey:   state.PrivateKeys[i],
+		Value:        float64(value) / 1e8,
+		Height:       100,
+		ScriptPubKey: state.WitnessPrograms[i],
+	}
+}
@@ -0,0 +1,141 @@
+package helpers
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// WatchOnly é o material público que o computador offline exporta para o
+// online: a tpub da conta (84h/1h/0h), de onde saem todos os endereços, e o
+// fingerprint da chave mestre, que o assinante usa para reconhecer as
+// origens BIP32 dos PSBTs.
+type WatchOnly struct {
+	XPub        string `json:"xpub"`
+	Fingerprint string `json:"fingerprint"` // 4 bytes em hex
+}
+
+// ExportWatchOnly gera o material watch-only do xprv.
+func ExportWatchOnly(xprv string) (WatchOnly, error) {
+	accountKey, err := DeriveAccountKey(xprv)
+	if err != nil {
+		return WatchOnly{}, err
+	}
+	accountPub, err := accountKey.Neuter()
+	if err != nil {
+		return WatchOnly{}, fmt.Errorf("erro ao obter tpub da conta: %w", err)
+	}
+	fingerprint, err := MasterFingerprint(xprv)
+	if err != nil {
+		return WatchOnly{}, err
+	}
+	return WatchOnly{XPub: accountPub.String(), Fingerprint: hex.EncodeToString(fingerprint[:])}, nil
+}
+
+// Account é a conta identificada pelo material watch-only.
+func (w WatchOnly) Account() models.Account {
+	return models.Account{XPub: w.XPub, Fingerprint: w.Fingerprint}
+}
+
+// FirstKey deriva a chave pública /0/0 da conta, a primeira de recebimento.
+func FirstKey(key string) ([]byte, error) {
+	state := &models.WalletState{}
+	if err := DeriveKeyPairs(key, 1, state); err != nil {
+		return nil, err
+	}
+	return state.PublicKeys[0], nil
+}
+
+// FingerprintBytes decodifica o fingerprint da chave mestre.
+func (w WatchOnly) FingerprintBytes() ([4]byte, error) {
+	var fingerprint [4]byte
+	decoded, err := hex.DecodeString(w.Fingerprint)
+	if err != nil || len(decoded) != len(fingerprint) {
+		return fingerprint, fmt.Errorf("fingerprint inválido: %q", w.Fingerprint)
+	}
+	copy(fingerprint[:], decoded)
+	return fingerprint, nil
+}
+
+// WriteWatchOnly grava o material watch-only em JSON.
+func WriteWatchOnly(path string, w WatchOnly) error {
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar watch-only: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("erro ao gravar %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadWatchOnly lê o material watch-only e confere que a chave é a tpub de
+// uma conta, sem parte privada.
+func ReadWatchOnly(path string) (WatchOnly, error) {
+	var w WatchOnly
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return w, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return w, fmt.Errorf("arquivo watch-only inválido: %w", err)
+	}
+	if IsPrivateKey(w.XPub) {
+		return w, fmt.Errorf("o arquivo watch-only contém uma chave privada")
+	}
+	if _, err := DeriveAccountKey(w.XPub); err != nil {
+		return w, err
+	}
+	if _, err := w.FingerprintBytes(); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+// XprvEnv permite passar o xprv da carteira sem gravá-lo em arquivo nem
+// expô-lo na linha de comando.
+const XprvEnv = "WALLET_XPRV"
+
+// ReadXprv obtém o xprv da carteira: do arquivo path, se informado, da
+// variável WALLET_XPRV ou, sem nenhum dos dois, pedindo no terminal. O xprv
+// mestre nunca fica no binário nem no banco, mas as chaves privadas filhas
+// derivadas dele são gravadas em "key/" para assinar sem pedi-lo de novo: quem
+// lê o banco consegue gastar os fundos dessas chaves.
+func ReadXprv(path string) (string, error) {
+	var xprv string
+	switch {
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("erro ao ler %s: %w", path, err)
+		}
+		xprv = string(data)
+	case os.Getenv(XprvEnv) != "":
+		xprv = os.Getenv(XprvEnv)
+	default:
+		fmt.Print("xprv da carteira: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("xprv não informado: use -xprv-file, %s ou digite no terminal", XprvEnv)
+		}
+		xprv = line
+	}
+	xprv = strings.TrimSpace(xprv)
+	if !IsPrivateKey(xprv) {
+		return "", fmt.Errorf("a chave informada não é um xprv válido")
+	}
+	return xprv, nil
+}
+
+// IsPrivateKey indica se a chave estendida tem parte privada (xprv/tprv).
+func IsPrivateKey(key string) bool {
+	extended, err := hdkeychain.NewKeyFromString(key)
+	return err == nil && extended.IsPrivate()
+}
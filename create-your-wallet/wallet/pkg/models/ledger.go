@@ -0,0 +1,149 @@
+package models
+
+// Tipos de lançamento no ledger
+const (
+	LedgerReceive = "receive"
+	LedgerSpend   = "spend"
+)
+
+// LedgerEntry registra um recebimento ou um gasto de um outpoint da carteira.
+type LedgerEntry struct {
+	Height   int     // Altura do bloco em que o evento ocorreu
+	Kind     string  // LedgerReceive ou LedgerSpend
+	TxID     string  // Transação que recebeu (vout) ou gastou (vin)
+	Index    int     // Índice do vout recebido ou do vin que gastou
+	Outpoint string  // Outpoint afetado (txid:vout)
+	Address  string  // Endereço dono do outpoint
+	Value    float64 // Valor do outpoint
+}
+
+// DataOutput é o conteúdo de uma saída OP_RETURN de uma transação da carteira.
+type DataOutput struct {
+	Height  int    // Altura do bloco da transação
+	TxID    string // Transação com a saída
+	Index   int    // Índice do vout
+	Payload []byte // Dados empurrados depois do OP_RETURN, concatenados
+}
+
+// PendingTx é uma transação transmitida pela carteira e ainda não confirmada.
+// Uma substituição por taxa (BIP125) fica registrada ao lado da original,
+// com Replaces apontando para ela, até que uma das versões confirme.
+type PendingTx struct {
+	TxID     string
+	RawTx    string   // Transação assinada em hex
+	Inputs   []string // Outpoints gastos (txid:vout)
+	Fee      int64    // Taxa em satoshis
+	VSize    int      // Tamanho virtual em vbytes
+	Replaces string   `json:",omitempty"` // Txid da versão substituída por esta
+}
+
+// TxProof é a prova SPV de que uma transação da carteira está num bloco.
+type TxProof struct {
+	TxID        string // Transação provada
+	Height      int    // Altura do bloco
+	BlockHash   string // Hash do bloco
+	MerkleBlock string // CMerkleBlock em hex, no formato do gettxoutproof
+}
+
+// BlockIndex lista, para um bloco, os scripts da carteira tocados
+// (scriptPubKey em hex) e as transações que os tocaram.
+type BlockIndex map[string][]string
+
+// Touch registra que txid tocou o script. Repetições são ignoradas.
+func (b BlockIndex) Touch(scriptHex, txid string) {
+	for _, existing := range b[scriptHex] {
+		if existing == txid {
+			return
+		}
+	}
+	b[scriptHex] = append(b[scriptHex], txid)
+}
+
+// StateDelta acumula as mudanças no estado da carteira entre dois checkpoints,
+// para que apenas o que mudou seja gravado no banco.
+type StateDelta struct {
+	Added   map[string]UTXO
+	Spent   map[string]bool
+	Ledger  []LedgerEntry
+	Touched map[int]BlockIndex // Índice dos blocos com atividade da carteira
+	Headers map[int][]byte     // Cabeçalhos validados (80 bytes) por altura
+	Proofs  map[string]TxProof // Provas SPV das transações da carteira, por txid
+	Data    []DataOutput       // Saídas OP_RETURN das transações da carteira
+	Settled []string           // Txids pendentes resolvidos: confirmados ou em conflito com um confirmado
+
+	ChangeIndex int // Próximo índice de troco, 0 se não mudou
+}
+
+// NewStateDelta cria um StateDelta vazio.
+func NewStateDelta() *StateDelta {
+	return &StateDelta{
+		Added:   make(map[string]UTXO),
+		Spent:   make(map[string]bool),
+		Touched: make(map[int]BlockIndex),
+		Headers: make(map[int][]byte),
+		Proofs:  make(map[string]TxProof),
+	}
+}
+
+// Touch registra no índice do bloco height que txid tocou o script.
+func (d *StateDelta) Touch(height int, scriptHex, txid string) {
+	index, ok := d.Touched[height]
+	if !ok {
+		index = make(BlockIndex)
+		d.Touched[height] = index
+	}
+	index.Touch(scriptHex, txid)
+}
+
+// AddUTXO registra um UTXO recebido.
+func (d *StateDelta) AddUTXO(key string, utxo UTXO) {
+	d.Added[key] = utxo
+}
+
+// SpendUTXO registra um UTXO gasto.
+func (d *StateDelta) SpendUTXO(key string) {
+	d.Spent[key] = true
+}
+
+// AddLedger registra um lançamento no ledger.
+func (d *StateDelta) AddLedger(entry LedgerEntry) {
+	d.Ledger = append(d.Ledger, entry)
+}
+
+// AddHeader registra o cabeçalho validado do bloco height.
+func (d *StateDelta) AddHeader(height int, header []byte) {
+	d.Headers[height] = header
+}
+
+// AddData registra o conteúdo de uma saída OP_RETURN.
+func (d *StateDelta) AddData(output DataOutput) {
+	d.Data = append(d.Data, output)
+}
+
+// Settle registra que a transação pendente txid deixou de ser pendente.
+func (d *StateDelta) Settle(txid string) {
+	d.Settled = append(d.Settled, txid)
+}
+
+// AddProof registra a prova SPV de uma transação.
+func (d *StateDelta) AddProof(proof TxProof) {
+	d.Proofs[proof.TxID] = proof
+}
+
+// Empty indica se não há mudanças pendentes.
+func (d *StateDelta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Spent) == 0 && len(d.Ledger) == 0 && len(d.Touched) == 0 && len(d.Headers) == 0 && len(d.Proofs) == 0 && len(d.Data) == 0 && len(d.Settled) == 0
+}
+
+// Reset descarta as mudanças já gravadas.
+func (d *StateDelta) Reset() {
+	d.Added = make(map[string]UTXO)
+	d.Spent = make(map[string]bool)
+	d.Ledger = nil
+	d.Touched = make(map[int]BlockIndex)
+	d.Headers = make(map[int][]byte)
+	d.Proofs = make(map[string]TxProof)
+	d.Data = nil
+	d.Settled = nil
+	d.ChangeIndex = 0
+}
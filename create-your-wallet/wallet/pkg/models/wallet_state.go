@@ -1,5 +1,15 @@
 package models
 
+// CoinbaseMaturity é o número de confirmações que uma saída coinbase
+// precisa antes de poder ser gasta.
+const CoinbaseMaturity = 100
+
+// Branches de derivação da conta
+const (
+	BranchReceive = 0 // /0/*: endereços de recebimento
+	BranchChange  = 1 // /1/*: endereços internos de troco
+)
+
 // Estado da carteira
 type WalletState struct {
 	UTXOs           map[string]UTXO
@@ -7,13 +17,137 @@ type WalletState struct {
 	PublicKeys      [][]byte
 	PrivateKeys     [][]byte
 	Addresses       [][]string
-	Balance         float64
+	Balance         float64      // Saldo gastável (sem coinbase imatura)
+	ImmatureBalance float64      // Saldo de coinbase que ainda não atingiu a maturidade
+	ChangeKeys      []DerivedKey // Chaves de troco derivadas, na ordem do índice
+	ChangeIndex     int          // Próximo índice de troco não usado
+	Multisigs       []Multisig   // Scripts multisig P2WSH registrados
+
+	// Transações transmitidas ainda não confirmadas, por txid
+	Pending map[string]PendingTx
+}
+
+// DerivedKey é um par de chaves derivado com o endereço e o witness program.
+type DerivedKey struct {
+	Branch         int // BranchReceive ou BranchChange
+	Index          int
+	PrivateKey     []byte
+	PublicKey      []byte
+	Address        string
+	WitnessProgram []byte
+}
+
+// Account identifica a carteira dona de um banco: a tpub da conta
+// (84h/1h/0h) e o fingerprint da chave mestre em hex.
+type Account struct {
+	XPub        string
+	Fingerprint string
+}
+
+// Key retorna o i-ésimo par de chaves do branch de recebimento.
+func (s *WalletState) Key(i int) DerivedKey {
+	key := DerivedKey{
+		Branch:     BranchReceive,
+		Index:      i,
+		PrivateKey: s.PrivateKeys[i],
+		PublicKey:  s.PublicKeys[i],
+		Address:    s.Addresses[i][0],
+	}
+	if i < len(s.WitnessPrograms) {
+		key.WitnessProgram = s.WitnessPrograms[i]
+	}
+	return key
+}
+
+// AddKey acrescenta um par de chaves às listas paralelas do estado.
+func (s *WalletState) AddKey(key DerivedKey) {
+	s.PrivateKeys = append(s.PrivateKeys, key.PrivateKey)
+	s.PublicKeys = append(s.PublicKeys, key.PublicKey)
+	s.Addresses = append(s.Addresses, []string{key.Address})
+	s.WitnessPrograms = append(s.WitnessPrograms, key.WitnessProgram)
+}
+
+// ChangeKey retorna a chave de troco do endereço, se houver.
+func (s *WalletState) ChangeKey(address string) (DerivedKey, bool) {
+	for _, key := range s.ChangeKeys {
+		if key.Address == address {
+			return key, true
+		}
+	}
+	return DerivedKey{}, false
+}
+
+// MarkChangeUsed avança ChangeIndex para depois da chave de troco do endereço,
+// se ela ainda não estava marcada como usada. Retorna se o índice mudou.
+func (s *WalletState) MarkChangeUsed(address string) bool {
+	key, ok := s.ChangeKey(address)
+	if !ok || key.Index < s.ChangeIndex {
+		return false
+	}
+	s.ChangeIndex = key.Index + 1
+	return true
+}
+
+// Multisig é um script m-de-n P2WSH registrado na carteira. Os fundos
+// enviados ao endereço contam no saldo mesmo que a carteira não tenha todas
+// as chaves.
+type Multisig struct {
+	Address        string
+	M              int
+	PubKeys        [][]byte // Chaves na ordem do script
+	Sorted         bool     // Chaves ordenadas pelo BIP67
+	WitnessScript  []byte
+	WitnessProgram []byte // OP_0 <sha256(WitnessScript)>
+}
+
+// Multisig retorna o multisig registrado no endereço, se houver.
+func (s *WalletState) Multisig(address string) (Multisig, bool) {
+	for _, ms := range s.Multisigs {
+		if ms.Address == address {
+			return ms, true
+		}
+	}
+	return Multisig{}, false
 }
 
 type UTXO struct {
-	TxID       string // ID da transação
-	VoutIndex  int    // Índice do vout
-	Address    string // Endereço associado ao UTXO
-	PrivateKey []byte
-	Value      float64 // Valor do UTXO
+	TxID          string  // ID da transação
+	VoutIndex     int     // Índice do vout
+	Address       string  // Endereço associado ao UTXO
+	PrivateKey    []byte  `json:"-"` // Não é persistida: vem das chaves derivadas ao carregar
+	Value         float64 // Valor do UTXO
+	Height        int     // Altura do bloco que confirmou o UTXO
+	Coinbase      bool    // Saída de uma transação coinbase
+	ScriptPubKey  []byte  // scriptPubKey necessário para gastar o UTXO
+	WitnessScript []byte  `json:",omitempty"` // Script do P2WSH (multisig); vazio em P2WPKH
+}
+
+// PendingSpent retorna os outpoints gastos por transações pendentes, com o
+// txid de quem os gasta. Eles continuam em UTXOs até a confirmação, mas não
+// podem ser escolhidos por um novo envio.
+func (s *WalletState) PendingSpent() map[string]string {
+	spent := make(map[string]string)
+	for txid, pending := range s.Pending {
+		for _, outpoint := range pending.Inputs {
+			spent[outpoint] = txid
+		}
+	}
+	return spent
+}
+
+// Confirmations retorna o número de confirmações do UTXO em relação à altura tipHeight.
+func (u UTXO) Confirmations(tipHeight int) int {
+	if u.Height <= 0 || tipHeight < u.Height {
+		return 0
+	}
+	return tipHeight - u.Height + 1
+}
+
+// IsMature indica se o UTXO pode ser gasto na altura tipHeight.
+// Saídas que não são coinbase estão sempre maduras.
+func (u UTXO) IsMature(tipHeight int) bool {
+	if !u.Coinbase {
+		return true
+	}
+	return u.Confirmations(tipHeight) >= CoinbaseMaturity
 }
@@ -1,80 +1,314 @@
 package progress
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 
+	"wallet/internal/storage"
 	"wallet/pkg/models"
-
-	badger "github.com/dgraph-io/badger/v4"
 )
 
-const (
-	progressKey    = "block_progress_state"
-	walletStateKey = "wallet_state"
-)
+// SaveProgress grava as mudanças acumuladas em delta e a altura do bloco na
+// mesma transação do banco. Apenas os UTXOs e lançamentos alterados são escritos.
+func SaveProgress(db *storage.DB, blockHeight int, delta *models.StateDelta) error {
+	return db.Update(func(txn storage.Txn) error {
+		// Gravar novos UTXOs antes das remoções: um UTXO recebido e gasto
+		// entre dois checkpoints termina removido
+		for _, utxo := range delta.Added {
+			if err := storage.PutUTXO(txn, utxo); err != nil {
+				return err
+			}
+		}
+		for outpoint := range delta.Spent {
+			if err := storage.DeleteUTXO(txn, outpoint); err != nil {
+				return err
+			}
+		}
+		for _, entry := range delta.Ledger {
+			if err := storage.PutLedgerEntry(txn, entry); err != nil {
+				return err
+			}
+		}
+		for height, index := range delta.Touched {
+			if err := storage.PutBlockIndex(txn, height, index); err != nil {
+				return err
+			}
+		}
+		for height, header := range delta.Headers {
+			if err := storage.PutHeader(txn, height, header); err != nil {
+				return err
+			}
+		}
+		for _, proof := range delta.Proofs {
+			if err := storage.PutProof(txn, proof); err != nil {
+				return err
+			}
+		}
+		for _, output := range delta.Data {
+			if err := storage.PutDataOutput(txn, output); err != nil {
+				return err
+			}
+		}
+		for _, txid := range delta.Settled {
+			if err := storage.DeletePending(txn, txid); err != nil {
+				return err
+			}
+		}
+		if delta.ChangeIndex > 0 {
+			if err := storage.PutMeta(txn, storage.MetaChangeIndex, delta.ChangeIndex); err != nil {
+				return err
+			}
+		}
 
-// SaveProgress salva o progresso do bloco atual no BadgerDB
-func SaveProgress(db *badger.DB, blockHeight int, state *models.WalletState) error {
-	return db.Update(func(txn *badger.Txn) error {
 		// Salvar altura do bloco
-		progressData, err := json.Marshal(blockHeight)
-		if err != nil {
-			return fmt.Errorf("erro ao serializar progresso: %w", err)
+		if err := storage.PutMeta(txn, storage.MetaProgress, blockHeight); err != nil {
+			return fmt.Errorf("erro ao salvar progresso: %w", err)
+		}
+		return nil
+	})
+}
+
+// SaveSnapshot substitui todos os UTXOs gravados pelos do estado e grava a altura.
+// Usado quando o estado não vem do scan bloco a bloco (ex.: scantxoutset).
+func SaveSnapshot(db *storage.DB, blockHeight int, state *models.WalletState) error {
+	return db.Update(func(txn storage.Txn) error {
+		if err := storage.DeletePrefix(txn, storage.PrefixUTXO); err != nil {
+			return err
+		}
+		for _, utxo := range state.UTXOs {
+			if err := storage.PutUTXO(txn, utxo); err != nil {
+				return err
+			}
+		}
+		if err := storage.PutMeta(txn, storage.MetaChangeIndex, state.ChangeIndex); err != nil {
+			return err
 		}
-		if err := txn.Set([]byte(progressKey), progressData); err != nil {
+		if err := storage.PutMeta(txn, storage.MetaProgress, blockHeight); err != nil {
 			return fmt.Errorf("erro ao salvar progresso: %w", err)
 		}
+		return nil
+	})
+}
 
-		// Salvar estado da carteira
-		stateData, err := json.Marshal(state)
+// SaveKeys grava as chaves derivadas do estado, uma chave do banco por par.
+func SaveKeys(db *storage.DB, state *models.WalletState) error {
+	return db.Update(func(txn storage.Txn) error {
+		for i := range state.PublicKeys {
+			if err := storage.PutDerivedKey(txn, state.Key(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CheckAccount confere que account é a dona do banco, registrada em
+// meta/account na primeira vez que uma chave é usada com ele. Um banco de outra
+// conta é recusado, para que chaves de carteiras diferentes nunca se misturem.
+// Num banco ainda sem conta registrada, as chaves já derivadas precisam
+// começar por firstKey, a chave pública /0/0 da conta.
+func CheckAccount(db *storage.DB, account models.Account, firstKey []byte) error {
+	return db.Update(func(txn storage.Txn) error {
+		var stored models.Account
+		found, err := storage.GetMeta(txn, storage.MetaAccount, &stored)
 		if err != nil {
-			return fmt.Errorf("erro ao serializar estado da carteira: %w", err)
+			return err
 		}
-		if err := txn.Set([]byte(walletStateKey), stateData); err != nil {
-			return fmt.Errorf("erro ao salvar estado da carteira: %w", err)
+		if found {
+			if stored != account {
+				return fmt.Errorf("o banco é da conta de fingerprint %s, não da chave informada (fingerprint %s)", stored.Fingerprint, account.Fingerprint)
+			}
+			return nil
 		}
 
+		key, found, err := storage.GetDerivedKey(txn, models.BranchReceive, 0)
+		if err != nil {
+			return err
+		}
+		if found && !bytes.Equal(key.PublicKey, firstKey) {
+			return fmt.Errorf("as chaves do banco não são da chave informada (fingerprint %s)", account.Fingerprint)
+		}
+		return storage.PutMeta(txn, storage.MetaAccount, account)
+	})
+}
+
+// LoadAccount lê a conta dona do banco. Retorna false se nenhuma chave foi
+// usada com ele ainda.
+func LoadAccount(db *storage.DB) (models.Account, bool, error) {
+	var account models.Account
+	var found bool
+	err := db.View(func(txn storage.Txn) error {
+		var err error
+		found, err = storage.GetMeta(txn, storage.MetaAccount, &account)
+		return err
+	})
+	return account, found, err
+}
+
+// SaveChangeKeys grava chaves de troco recém-derivadas e o próximo índice de troco.
+func SaveChangeKeys(db *storage.DB, keys []models.DerivedKey, changeIndex int) error {
+	return db.Update(func(txn storage.Txn) error {
+		for _, key := range keys {
+			if err := storage.PutDerivedKey(txn, key); err != nil {
+				return err
+			}
+		}
+		return storage.PutMeta(txn, storage.MetaChangeIndex, changeIndex)
+	})
+}
+
+// SavePending grava as transações transmitidas pela carteira, como uma
+// substituição junto com a original que ela substitui.
+func SavePending(db *storage.DB, pending ...models.PendingTx) error {
+	return db.Update(func(txn storage.Txn) error {
+		for _, tx := range pending {
+			if err := storage.PutPending(txn, tx); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
-// LoadProgress carrega o progresso e o estado da carteira do BadgerDB
-func LoadProgress(db *badger.DB) (int, *models.WalletState, error) {
+// LoadMultisigs lê os multisigs registrados, que independem do progresso salvo.
+func LoadMultisigs(db *storage.DB) ([]models.Multisig, error) {
+	var multisigs []models.Multisig
+	err := db.View(func(txn storage.Txn) error {
+		var err error
+		multisigs, err = storage.ListMultisigs(txn)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar multisigs: %w", err)
+	}
+	return multisigs, nil
+}
+
+// LoadProgress carrega o progresso e o estado da carteira do banco.
+// Sem progresso salvo, retorna altura 0 e estado nil. Como altura e estado são
+// gravados na mesma transação, um nunca é carregado sem o outro.
+func LoadProgress(db *storage.DB) (int, *models.WalletState, error) {
 	var blockHeight int
-	var state models.WalletState
+	var state *models.WalletState
 
-	err := db.View(func(txn *badger.Txn) error {
-		// Carregar altura do bloco
-		item, err := txn.Get([]byte(progressKey))
+	err := db.View(func(txn storage.Txn) error {
+		found, err := storage.GetMeta(txn, storage.MetaProgress, &blockHeight)
+		if err != nil || !found {
+			return err // Nenhum progresso salvo
+		}
+
+		keys, err := storage.ListDerivedKeys(txn, models.BranchReceive)
 		if err != nil {
-			if err == badger.ErrKeyNotFound {
-				return nil // Nenhum progresso salvo
-			}
 			return err
 		}
-		if err := item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &blockHeight)
-		}); err != nil {
-			return fmt.Errorf("erro ao desserializar progresso: %w", err)
+		changeKeys, err := storage.ListDerivedKeys(txn, models.BranchChange)
+		if err != nil {
+			return err
 		}
-
-		// Carregar estado da carteira
-		item, err = txn.Get([]byte(walletStateKey))
+		multisigs, err := storage.ListMultisigs(txn)
 		if err != nil {
-			if err == badger.ErrKeyNotFound {
-				return nil // Nenhum estado salvo
-			}
 			return err
 		}
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &state)
-		})
+		utxos, err := storage.ListUTXOs(txn)
+		if err != nil {
+			return err
+		}
+		pending, err := storage.ListPending(txn)
+		if err != nil {
+			return err
+		}
+
+		state = &models.WalletState{UTXOs: utxos, ChangeKeys: changeKeys, Multisigs: multisigs, Pending: pending}
+		for _, key := range keys {
+			state.AddKey(key)
+		}
+		if _, err := storage.GetMeta(txn, storage.MetaChangeIndex, &state.ChangeIndex); err != nil {
+			return err
+		}
+		attachPrivateKeys(state)
+		return nil
 	})
 
 	if err != nil {
 		return 0, nil, fmt.Errorf("erro ao carregar progresso e estado: %w", err)
 	}
+	if state == nil {
+		return 0, nil, nil
+	}
 
-	return blockHeight, &state, nil
+	return blockHeight, state, nil
+}
+
+// attachPrivateKeys associa a cada UTXO a chave privada do seu endereço.
+func attachPrivateKeys(state *models.WalletState) {
+	byAddress := make(map[string][]byte, len(state.Addresses))
+	for i, addr := range state.Addresses {
+		byAddress[addr[0]] = state.PrivateKeys[i]
+	}
+	for _, key := range state.ChangeKeys {
+		byAddress[key.Address] = key.PrivateKey
+	}
+	for key, utxo := range state.UTXOs {
+		utxo.PrivateKey = byAddress[utxo.Address]
+		state.UTXOs[key] = utxo
+	}
+}
+
+// SaveRescan substitui UTXOs, ledger e saídas OP_RETURN pelo resultado de um rescan e regrava o
+// índice das alturas reprocessadas, tudo numa transação. A altura do progresso
+// não muda.
+func SaveRescan(db *storage.DB, heights []int, delta *models.StateDelta) error {
+	return db.Update(func(txn storage.Txn) error {
+		if err := storage.DeletePrefix(txn, storage.PrefixUTXO); err != nil {
+			return err
+		}
+		if err := storage.DeletePrefix(txn, storage.PrefixLedger); err != nil {
+			return err
+		}
+		if err := storage.DeletePrefix(txn, storage.PrefixData); err != nil {
+			return err
+		}
+		for _, height := range heights {
+			if err := storage.DeleteBlockIndex(txn, height); err != nil {
+				return err
+			}
+		}
+		for outpoint, utxo := range delta.Added {
+			if delta.Spent[outpoint] {
+				continue
+			}
+			if err := storage.PutUTXO(txn, utxo); err != nil {
+				return err
+			}
+		}
+		for _, entry := range delta.Ledger {
+			if err := storage.PutLedgerEntry(txn, entry); err != nil {
+				return err
+			}
+		}
+		for height, index := range delta.Touched {
+			if err := storage.PutBlockIndex(txn, height, index); err != nil {
+				return err
+			}
+		}
+		for _, proof := range delta.Proofs {
+			if err := storage.PutProof(txn, proof); err != nil {
+				return err
+			}
+		}
+		for _, output := range delta.Data {
+			if err := storage.PutDataOutput(txn, output); err != nil {
+				return err
+			}
+		}
+		for _, txid := range delta.Settled {
+			if err := storage.DeletePending(txn, txid); err != nil {
+				return err
+			}
+		}
+		if delta.ChangeIndex > 0 {
+			return storage.PutMeta(txn, storage.MetaChangeIndex, delta.ChangeIndex)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+
+	"wallet/internal/storage"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const testXprv = "tprv8ZgxMBicQKsPdt2JSGYoFa3bag1DMeGF8zdJC3ECLwCbUWdoZMq2wkqrN3zMaY9ep1RpD6yqLLmPohMgptXQ56YHr5NBLoUoXxLv97MjDcz"
+
+// testAccount retorna a conta e a primeira chave de recebimento do xprv.
+func testAccount(t *testing.T, xprv string) (models.Account, []byte) {
+	t.Helper()
+	w, err := helpers.ExportWatchOnly(xprv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstKey, err := helpers.FirstKey(xprv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Account(), firstKey
+}
+
+func TestCheckAccount(t *testing.T) {
+	master, err := hdkeychain.NewMaster(bytes.Repeat([]byte{1}, 32), &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, firstKey := testAccount(t, testXprv)
+	other, otherKey := testAccount(t, master.String())
+
+	// Banco novo: a conta é registrada no primeiro uso
+	db := storage.NewMemoryDB()
+	if err := CheckAccount(db, account, firstKey); err != nil {
+		t.Fatal(err)
+	}
+	if stored, found, err := LoadAccount(db); err != nil || !found || stored != account {
+		t.Fatalf("conta %+v (%v, %v), esperava %+v", stored, found, err, account)
+	}
+	if err := CheckAccount(db, account, firstKey); err != nil {
+		t.Fatalf("mesma conta recusada: %v", err)
+	}
+	if err := CheckAccount(db, other, otherKey); err == nil {
+		t.Fatal("conta de outra carteira aceita")
+	}
+
+	// Banco anterior ao registro da conta: as chaves derivadas decidem
+	legacy := storage.NewMemoryDB()
+	state := &models.WalletState{}
+	if err := helpers.DeriveKeyPairs(testXprv, 1, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.Update(func(txn storage.Txn) error {
+		return storage.PutDerivedKey(txn, state.Key(0))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckAccount(legacy, other, otherKey); err == nil {
+		t.Fatal("chaves de outra carteira aceitas num banco sem conta registrada")
+	}
+	if _, found, _ := LoadAccount(legacy); found {
+		t.Fatal("conta registrada depois de uma recusa")
+	}
+	if err := CheckAccount(legacy, account, firstKey); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,520 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"wallet/pkg/helpers"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Formato (BIP174): o magic "psbt" 0xff seguido de um mapa global, um mapa por
+// entrada e um mapa por saída. Cada mapa é uma sequência de pares
+// <tamanho da chave> <chave> <tamanho do valor> <valor>, com tamanhos em
+// compact size, terminada por um byte 0x00. O primeiro byte da chave é o tipo.
+//
+// Na versão 0 a transação sem assinaturas vai inteira no mapa global; na
+// versão 2 (BIP370) ela é descrita campo a campo nos mapas de entradas e saídas.
+var magic = []byte("psbt\xff")
+
+// Versões suportadas
+const (
+	Version0 = 0
+	Version2 = 2
+)
+
+// Tipos de chave do mapa global
+const (
+	GlobalUnsignedTx       = 0x00
+	GlobalXPub             = 0x01
+	GlobalTxVersion        = 0x02 // v2
+	GlobalFallbackLocktime = 0x03 // v2
+	GlobalInputCount       = 0x04 // v2
+	GlobalOutputCount      = 0x05 // v2
+	GlobalTxModifiable     = 0x06 // v2
+	GlobalVersion          = 0xfb
+)
+
+// Tipos de chave dos mapas de entrada
+const (
+	InNonWitnessUTXO         = 0x00
+	InWitnessUTXO            = 0x01
+	InPartialSig             = 0x02
+	InSighashType            = 0x03
+	InRedeemScript           = 0x04
+	InWitnessScript          = 0x05
+	InBIP32Derivation        = 0x06
+	InFinalScriptSig         = 0x07
+	InFinalScriptWitness     = 0x08
+	InPreviousTxID           = 0x0e // v2
+	InOutputIndex            = 0x0f // v2
+	InSequence               = 0x10 // v2
+	InRequiredTimeLocktime   = 0x11 // v2
+	InRequiredHeightLocktime = 0x12 // v2
+)
+
+// Tipos de chave dos mapas de saída
+const (
+	OutRedeemScript    = 0x00
+	OutWitnessScript   = 0x01
+	OutBIP32Derivation = 0x02
+	OutAmount          = 0x03 // v2
+	OutScript          = 0x04 // v2
+)
+
+// Pair é um par chave-valor de um mapa. Key inclui o byte do tipo.
+type Pair struct {
+	Key   []byte
+	Value []byte
+}
+
+// Map é um mapa do PSBT. Os pares ficam na ordem lida ou, os inseridos
+// por Set, em ordem de chave; tipos desconhecidos são preservados.
+type Map []Pair
+
+// Get retorna o valor da chave.
+func (m Map) Get(key []byte) ([]byte, bool) {
+	for _, pair := range m {
+		if bytes.Equal(pair.Key, key) {
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
+
+// GetType retorna o valor da chave formada só pelo tipo.
+func (m Map) GetType(keyType byte) ([]byte, bool) {
+	return m.Get([]byte{keyType})
+}
+
+// ByType retorna os pares do tipo, como as assinaturas parciais por chave pública.
+func (m Map) ByType(keyType byte) []Pair {
+	var pairs []Pair
+	for _, pair := range m {
+		if pair.Key[0] == keyType {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// Set grava o valor da chave, substituindo o anterior.
+func (m *Map) Set(key, value []byte) {
+	for i, pair := range *m {
+		if bytes.Equal(pair.Key, key) {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, Pair{Key: key, Value: value})
+	sort.SliceStable(*m, func(i, j int) bool { return bytes.Compare((*m)[i].Key, (*m)[j].Key) < 0 })
+}
+
+// SetType grava o valor da chave formada só pelo tipo.
+func (m *Map) SetType(keyType byte, value []byte) {
+	m.Set([]byte{keyType}, value)
+}
+
+// DeleteType remove todos os pares do tipo.
+func (m *Map) DeleteType(keyType byte) {
+	kept := (*m)[:0]
+	for _, pair := range *m {
+		if pair.Key[0] != keyType {
+			kept = append(kept, pair)
+		}
+	}
+	*m = kept
+}
+
+// clone copia o mapa, para que alterações na cópia não afetem o original.
+func (m Map) clone() Map {
+	c := make(Map, len(m))
+	for i, pair := range m {
+		c[i] = Pair{Key: append([]byte(nil), pair.Key...), Value: append([]byte(nil), pair.Value...)}
+	}
+	return c
+}
+
+// Packet é um PSBT decodificado.
+type Packet struct {
+	Global  Map
+	Inputs  []Map
+	Outputs []Map
+}
+
+// Version retorna a versão do PSBT (0 se o campo não estiver presente).
+func (p *Packet) Version() uint32 {
+	if value, ok := p.Global.GetType(GlobalVersion); ok && len(value) == 4 {
+		return binary.LittleEndian.Uint32(value)
+	}
+	return Version0
+}
+
+// Decode decodifica um PSBT binário e confere os campos obrigatórios da versão.
+func Decode(data []byte) (*Packet, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, fmt.Errorf("não é um PSBT: magic ausente")
+	}
+	r := &reader{data: data, pos: len(magic)}
+
+	p := &Packet{}
+	var err error
+	if p.Global, err = r.readMap(); err != nil {
+		return nil, fmt.Errorf("mapa global: %w", err)
+	}
+
+	nIn, nOut, err := p.counts()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nIn; i++ {
+		m, err := r.readMap()
+		if err != nil {
+			return nil, fmt.Errorf("entrada %d: %w", i, err)
+		}
+		p.Inputs = append(p.Inputs, m)
+	}
+	for i := 0; i < nOut; i++ {
+		m, err := r.readMap()
+		if err != nil {
+			return nil, fmt.Errorf("saída %d: %w", i, err)
+		}
+		p.Outputs = append(p.Outputs, m)
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes sobrando depois do PSBT", len(data)-r.pos)
+	}
+
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DecodeBase64 decodifica um PSBT em base64, o formato dos RPCs do Bitcoin Core.
+func DecodeBase64(encoded string) (*Packet, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("PSBT em base64 inválido: %w", err)
+	}
+	return Decode(data)
+}
+
+// ReadFile lê um PSBT de um arquivo, binário ou em base64.
+func ReadFile(path string) (*Packet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	if bytes.HasPrefix(data, magic) {
+		return Decode(data)
+	}
+	return DecodeBase64(strings.TrimSpace(string(data)))
+}
+
+// WriteFile grava o PSBT em base64, o formato aceito pelo walletprocesspsbt.
+func (p *Packet) WriteFile(path string) error {
+	if err := os.WriteFile(path, []byte(p.Base64()+"\n"), 0o644); err != nil {
+		return fmt.Errorf("erro ao gravar %s: %w", path, err)
+	}
+	return nil
+}
+
+// counts retorna quantos mapas de entrada e de saída seguem o mapa global.
+func (p *Packet) counts() (int, int, error) {
+	switch p.Version() {
+	case Version0:
+		tx, err := p.globalTx()
+		if err != nil {
+			return 0, 0, err
+		}
+		return len(tx.TxIn), len(tx.TxOut), nil
+	case Version2:
+		nIn, err := compactField(p.Global, GlobalInputCount)
+		if err != nil {
+			return 0, 0, err
+		}
+		nOut, err := compactField(p.Global, GlobalOutputCount)
+		if err != nil {
+			return 0, 0, err
+		}
+		return nIn, nOut, nil
+	}
+	return 0, 0, fmt.Errorf("versão de PSBT %d não suportada", p.Version())
+}
+
+// globalTx decodifica a transação sem assinaturas do mapa global (versão 0).
+func (p *Packet) globalTx() (*wire.MsgTx, error) {
+	raw, ok := p.Global.GetType(GlobalUnsignedTx)
+	if !ok {
+		return nil, fmt.Errorf("PSBT v0 sem a transação sem assinaturas")
+	}
+	tx, err := helpers.DeserializeTx(raw)
+	if err != nil {
+		return nil, fmt.Errorf("transação sem assinaturas inválida: %w", err)
+	}
+	for i, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) > 0 || len(txIn.Witness) > 0 {
+			return nil, fmt.Errorf("entrada %d da transação sem assinaturas tem scriptSig ou witness", i)
+		}
+	}
+	return tx, nil
+}
+
+// check confere que os campos exclusivos de uma versão não aparecem na outra
+// e que os obrigatórios estão presentes.
+func (p *Packet) check() error {
+	v2Global := []byte{GlobalTxVersion, GlobalFallbackLocktime, GlobalInputCount, GlobalOutputCount, GlobalTxModifiable}
+	v2Input := []byte{InPreviousTxID, InOutputIndex, InSequence, InRequiredTimeLocktime, InRequiredHeightLocktime}
+	v2Output := []byte{OutAmount, OutScript}
+
+	if p.Version() == Version0 {
+		for _, keyType := range v2Global {
+			if _, ok := p.Global.GetType(keyType); ok {
+				return fmt.Errorf("campo global %#x é exclusivo do PSBT v2", keyType)
+			}
+		}
+		for i, m := range p.Inputs {
+			for _, keyType := range v2Input {
+				if _, ok := m.GetType(keyType); ok {
+					return fmt.Errorf("entrada %d: campo %#x é exclusivo do PSBT v2", i, keyType)
+				}
+			}
+		}
+		for i, m := range p.Outputs {
+			for _, keyType := range v2Output {
+				if _, ok := m.GetType(keyType); ok {
+					return fmt.Errorf("saída %d: campo %#x é exclusivo do PSBT v2", i, keyType)
+				}
+			}
+		}
+		return nil
+	}
+
+	if _, ok := p.Global.GetType(GlobalUnsignedTx); ok {
+		return fmt.Errorf("PSBT v2 não pode ter a transação sem assinaturas no mapa global")
+	}
+	version, ok := p.Global.GetType(GlobalTxVersion)
+	if !ok || len(version) != 4 {
+		return fmt.Errorf("PSBT v2 sem a versão da transação")
+	}
+	if int32(binary.LittleEndian.Uint32(version)) < 2 {
+		return fmt.Errorf("PSBT v2 exige transação versão 2 ou maior")
+	}
+	for i, m := range p.Inputs {
+		if txid, ok := m.GetType(InPreviousTxID); !ok || len(txid) != chainhash.HashSize {
+			return fmt.Errorf("entrada %d sem o txid anterior", i)
+		}
+		if index, ok := m.GetType(InOutputIndex); !ok || len(index) != 4 {
+			return fmt.Errorf("entrada %d sem o índice da saída anterior", i)
+		}
+	}
+	for i, m := range p.Outputs {
+		if amount, ok := m.GetType(OutAmount); !ok || len(amount) != 8 {
+			return fmt.Errorf("saída %d sem o valor", i)
+		}
+		if _, ok := m.GetType(OutScript); !ok {
+			return fmt.Errorf("saída %d sem o script", i)
+		}
+	}
+	_, err := p.locktime()
+	return err
+}
+
+// Encode serializa o PSBT.
+func (p *Packet) Encode() []byte {
+	var buf bytes.Buffer
+	buf.Write(magic)
+	for _, m := range append(append([]Map{p.Global}, p.Inputs...), p.Outputs...) {
+		for _, pair := range m {
+			helpers.WriteCompactSize(&buf, uint64(len(pair.Key)))
+			buf.Write(pair.Key)
+			helpers.WriteCompactSize(&buf, uint64(len(pair.Value)))
+			buf.Write(pair.Value)
+		}
+		buf.WriteByte(0x00)
+	}
+	return buf.Bytes()
+}
+
+// Base64 serializa o PSBT em base64.
+func (p *Packet) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Encode())
+}
+
+// UnsignedTx retorna a transação sem assinaturas descrita pelo PSBT.
+func (p *Packet) UnsignedTx() (*wire.MsgTx, error) {
+	if p.Version() == Version0 {
+		return p.globalTx()
+	}
+
+	version, _ := p.Global.GetType(GlobalTxVersion)
+	tx := wire.NewMsgTx(int32(binary.LittleEndian.Uint32(version)))
+	locktime, err := p.locktime()
+	if err != nil {
+		return nil, err
+	}
+	tx.LockTime = locktime
+
+	for _, m := range p.Inputs {
+		var hash chainhash.Hash
+		txid, _ := m.GetType(InPreviousTxID)
+		copy(hash[:], txid)
+		index, _ := m.GetType(InOutputIndex)
+		txIn := wire.NewTxIn(wire.NewOutPoint(&hash, binary.LittleEndian.Uint32(index)), nil, nil)
+		if sequence, ok := m.GetType(InSequence); ok && len(sequence) == 4 {
+			txIn.Sequence = binary.LittleEndian.Uint32(sequence)
+		}
+		tx.AddTxIn(txIn)
+	}
+	for _, m := range p.Outputs {
+		amount, _ := m.GetType(OutAmount)
+		script, _ := m.GetType(OutScript)
+		tx.AddTxOut(wire.NewTxOut(int64(binary.LittleEndian.Uint64(amount)), script))
+	}
+	return tx, nil
+}
+
+// locktime determina o locktime de um PSBT v2 (BIP370): sem exigências das
+// entradas, o fallback (ou 0); com exigências, o maior valor do tipo que
+// todas as entradas com exigência aceitam, preferindo altura a tempo.
+func (p *Packet) locktime() (uint32, error) {
+	var maxTime, maxHeight uint32
+	var withRequirement, acceptTime, acceptHeight int
+	for i, m := range p.Inputs {
+		timeLock, hasTime := m.GetType(InRequiredTimeLocktime)
+		heightLock, hasHeight := m.GetType(InRequiredHeightLocktime)
+		if (hasTime && len(timeLock) != 4) || (hasHeight && len(heightLock) != 4) {
+			return 0, fmt.Errorf("entrada %d com locktime exigido malformado", i)
+		}
+		if !hasTime && !hasHeight {
+			continue
+		}
+		withRequirement++
+		if hasTime {
+			acceptTime++
+			if v := binary.LittleEndian.Uint32(timeLock); v > maxTime {
+				maxTime = v
+			}
+		}
+		if hasHeight {
+			acceptHeight++
+			if v := binary.LittleEndian.Uint32(heightLock); v > maxHeight {
+				maxHeight = v
+			}
+		}
+	}
+
+	switch {
+	case withRequirement == 0:
+		if fallback, ok := p.Global.GetType(GlobalFallbackLocktime); ok && len(fallback) == 4 {
+			return binary.LittleEndian.Uint32(fallback), nil
+		}
+		return 0, nil
+	case acceptHeight == withRequirement:
+		return maxHeight, nil
+	case acceptTime == withRequirement:
+		return maxTime, nil
+	}
+	return 0, fmt.Errorf("entradas exigem locktimes incompatíveis (altura e tempo)")
+}
+
+// ID identifica a transação do PSBT: o txid da transação sem assinaturas.
+// PSBTs só podem ser combinados se tiverem o mesmo ID.
+func (p *Packet) ID() (string, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return "", err
+	}
+	return helpers.TxID(tx), nil
+}
+
+// reader lê os mapas de um PSBT serializado.
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) compactSize() (uint64, error) {
+	n, size, err := helpers.ReadCompactSize(r.data[r.pos:])
+	if err != nil {
+		return 0, fmt.Errorf("byte %d: %w", r.pos, err)
+	}
+	r.pos += size
+	return n, nil
+}
+
+func (r *reader) read(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("PSBT truncado no byte %d", r.pos)
+	}
+	b := append([]byte(nil), r.data[r.pos:r.pos+int(n)]...)
+	r.pos += int(n)
+	return b, nil
+}
+
+// readMap lê pares até o terminador 0x00, recusando chaves repetidas.
+func (r *reader) readMap() (Map, error) {
+	var m Map
+	for {
+		keyLen, err := r.compactSize()
+		if err != nil {
+			return nil, err
+		}
+		if keyLen == 0 {
+			return m, nil
+		}
+		key, err := r.read(keyLen)
+		if err != nil {
+			return nil, err
+		}
+		valueLen, err := r.compactSize()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.read(valueLen)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := m.Get(key); dup {
+			return nil, fmt.Errorf("chave %x repetida", key)
+		}
+		m = append(m, Pair{Key: key, Value: value})
+	}
+}
+
+// compactField lê um campo cujo valor é um compact size, como as contagens do v2.
+func compactField(m Map, keyType byte) (int, error) {
+	value, ok := m.GetType(keyType)
+	if !ok {
+		return 0, fmt.Errorf("campo %#x ausente", keyType)
+	}
+	n, size, err := helpers.ReadCompactSize(value)
+	if err != nil || size != len(value) {
+		return 0, fmt.Errorf("campo %#x malformado", keyType)
+	}
+	// Cada mapa ocupa ao menos o byte terminador; limita alocações absurdas
+	if n > 1<<20 {
+		return 0, fmt.Errorf("campo %#x com contagem %d grande demais", keyType, n)
+	}
+	return int(n), nil
+}
+
+func uint32Bytes(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, n)
+	return b
+}
+
+func compactBytes(n uint64) []byte {
+	var buf bytes.Buffer
+	helpers.WriteCompactSize(&buf, n)
+	return buf.Bytes()
+}
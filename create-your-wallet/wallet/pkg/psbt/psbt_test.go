@@ -0,0 +1,327 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PSBT do criador nos vetores de teste do BIP174: duas entradas sem UTXO e
+// duas saídas P2WPKH
+const bip174Creator = "cHNidP8BAJoCAAAAAljoeiG1ba8MI76OcHBFbDNvfLqlyHV5JPVFiHuyq911AAAAAAD/////g40EJ9DsZQpoqka7CwmK6kQiwHGyyng1Kgd5WdB86h0BAAAAAP////8CcKrwCAAAAAAWABTYXCtx0AYLCcmIauuBXlCZHdoSTQDh9QUAAAAAFgAUAK6pouXw+HaliN9VRuh0LR2HAI8AAAAAAAAAAAA="
+
+// bip174CreatorTx é a transação sem assinaturas do vetor do criador.
+func bip174CreatorTx(t *testing.T) *wire.MsgTx {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	for _, in := range []struct {
+		txid  string
+		index uint32
+	}{
+		{"75ddabb27b8845f5247975c8a5ba7c6f336c4570708ebe230caf6db5217ae858", 0},
+		{"1dea7cd05979072a3578cab271c02244ea8a090bbb46aa680a65ecd027048d83", 1},
+	} {
+		hash, err := chainhash.NewHashFromStr(in.txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, in.index), nil, nil))
+	}
+	for _, out := range []struct {
+		value  int64
+		script string
+	}{
+		{149990000, "0014d85c2b71d0060b09c9886aeb815e50991dda124d"},
+		{100000000, "001400aea9a2e5f0f876a588df5546e8742d1d87008f"},
+	} {
+		script, _ := hex.DecodeString(out.script)
+		tx.AddTxOut(wire.NewTxOut(out.value, script))
+	}
+	return tx
+}
+
+func TestBIP174Creator(t *testing.T) {
+	tx := bip174CreatorTx(t)
+	p, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Base64(); got != bip174Creator {
+		t.Fatalf("PSBT do criador difere do vetor:\n%s\n%s", got, bip174Creator)
+	}
+
+	decoded, err := DecodeBase64(bip174Creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version() != Version0 || decoded.Base64() != bip174Creator {
+		t.Fatalf("vetor não se reproduz ao reserializar: %s", decoded.Base64())
+	}
+	id, err := decoded.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != helpers.TxID(tx) {
+		t.Fatalf("ID %s, esperava %s", id, helpers.TxID(tx))
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	valid, err := DecodeBase64(bip174Creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := valid.Encode()
+
+	// withGlobal serializa o vetor com o mapa global alterado por edit
+	withGlobal := func(edit func(m *Map)) []byte {
+		p := &Packet{Global: valid.Global.clone(), Inputs: valid.Inputs, Outputs: valid.Outputs}
+		edit(&p.Global)
+		return p.Encode()
+	}
+	signedTx := bip174CreatorTx(t)
+	signedTx.TxIn[0].SignatureScript = []byte{0x51}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"transação de rede, sem magic", helpers.SerializeTx(bip174CreatorTx(t), false)},
+		{"sem os mapas de saída", data[:len(data)-2]},
+		{"bytes depois do último mapa", append(append([]byte(nil), data...), 0x00)},
+		{"chave global repetida", append(append([]byte(nil), magic...), append([]byte{0x01, 0xfc, 0x00, 0x01, 0xfc, 0x00}, data[len(magic):]...)...)},
+		{"transação sem assinaturas com scriptSig", withGlobal(func(m *Map) {
+			m.SetType(GlobalUnsignedTx, helpers.SerializeTx(signedTx, false))
+		})},
+		{"campo do v2 num PSBT v0", withGlobal(func(m *Map) { m.SetType(GlobalTxVersion, uint32Bytes(2)) })},
+		{"v2 com a transação no mapa global", withGlobal(func(m *Map) {
+			m.SetType(GlobalVersion, uint32Bytes(Version2))
+			m.SetType(GlobalTxVersion, uint32Bytes(2))
+			m.SetType(GlobalInputCount, compactBytes(2))
+			m.SetType(GlobalOutputCount, compactBytes(2))
+		})},
+		{"versão desconhecida", withGlobal(func(m *Map) { m.SetType(GlobalVersion, uint32Bytes(1)) })},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Decode(tc.data); err == nil {
+				t.Fatal("Decode de PSBT inválido não falhou")
+			}
+		})
+	}
+}
+
+func TestVersion2RoundTrip(t *testing.T) {
+	tx := bip174CreatorTx(t)
+	tx.LockTime = 1000
+	tx.TxIn[1].Sequence = helpers.RBFSequence
+
+	v0, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(v2.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version() != Version2 || !bytes.Equal(decoded.Encode(), v2.Encode()) {
+		t.Fatal("PSBT v2 não se reproduz ao reserializar")
+	}
+	unsigned, err := decoded.UnsignedTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(helpers.SerializeTx(unsigned, false), helpers.SerializeTx(tx, false)) {
+		t.Fatal("transação do PSBT v2 difere da original")
+	}
+
+	// As duas versões descrevem a mesma transação, mas não se combinam
+	id0, _ := v0.ID()
+	id2, _ := decoded.ID()
+	if id0 != id2 {
+		t.Fatalf("ID v0 %s difere do v2 %s", id0, id2)
+	}
+	if _, err := Combine(v0, decoded); err == nil {
+		t.Fatal("Combine de versões diferentes não falhou")
+	}
+
+	// Uma transação versão 1 não cabe num PSBT v2
+	tx.Version = 1
+	if _, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version2); err == nil {
+		t.Fatal("PSBT v2 de transação versão 1 não falhou")
+	}
+}
+
+// testKey deriva uma chave fixa da semente.
+func testKey(seed string) (pubKey, privKey []byte) {
+	hash := sha256.Sum256([]byte(seed))
+	priv, pub := btcec.PrivKeyFromBytes(btcec.S256(), hash[:])
+	return pub.SerializeCompressed(), priv.Serialize()
+}
+
+func TestMultisigCombineFinalizeExtract(t *testing.T) {
+	var pubKeys [][]byte
+	keys := make([]map[string][]byte, 3)
+	for i := range keys {
+		pubKey, privKey := testKey(string(rune('a' + i)))
+		pubKeys = append(pubKeys, pubKey)
+		keys[i] = map[string][]byte{hex.EncodeToString(pubKey): privKey}
+	}
+	ms, err := helpers.NewMultisig(2, pubKeys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Transação anterior que paga o 2-de-3
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	funding.AddTxOut(wire.NewTxOut(100000, ms.WitnessProgram))
+	fundingHash := funding.TxHash()
+
+	destination, _ := testKey("destino")
+	program, err := helpers.GetP2WPKHProgram(destination, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99000, program))
+
+	for _, version := range []int{Version0, Version2} {
+		created, err := FromTransaction(tx, []models.UTXO{{
+			TxID:          fundingHash.String(),
+			Value:         0.001,
+			ScriptPubKey:  ms.WitnessProgram,
+			WitnessScript: ms.WitnessScript,
+		}}, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := created.SetNonWitnessUTXO(0, helpers.SerializeTx(funding, true)); err != nil {
+			t.Fatal(err)
+		}
+		if fee, err := created.Fee(); err != nil || fee != 1000 {
+			t.Fatalf("v%d: taxa %d (%v), esperava 1000", version, fee, err)
+		}
+
+		// Dois participantes assinam cópias independentes
+		var signed []*Packet
+		for _, i := range []int{0, 2} {
+			p, err := Decode(created.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, err := p.Sign(keys[i], false); err != nil || n != 1 {
+				t.Fatalf("v%d: participante %d acrescentou %d assinaturas (%v)", version, i, n, err)
+			}
+			if complete, err := p.Finalize(); err != nil || complete {
+				t.Fatalf("v%d: uma assinatura finalizou o 2-de-3 (%v)", version, err)
+			}
+			signed = append(signed, p)
+		}
+
+		combined, err := Combine(signed...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(combined.Inputs[0].ByType(InPartialSig)); n != 2 {
+			t.Fatalf("v%d: %d assinaturas parciais depois do Combine", version, n)
+		}
+		if _, err := combined.Extract(); err == nil {
+			t.Fatalf("v%d: Extract antes do Finalize não falhou", version)
+		}
+		complete, err := combined.Finalize()
+		if err != nil || !complete {
+			t.Fatalf("v%d: Finalize completo %v (%v)", version, complete, err)
+		}
+		if n := len(combined.Inputs[0].ByType(InPartialSig)); n != 0 {
+			t.Fatalf("v%d: %d assinaturas parciais ficaram depois do Finalize", version, n)
+		}
+
+		final, err := combined.Extract()
+		if err != nil {
+			t.Fatal(err)
+		}
+		witness := final.TxIn[0].Witness
+		if len(witness) != 4 || len(witness[0]) != 0 || !bytes.Equal(witness[3], ms.WitnessScript) {
+			t.Fatalf("v%d: witness inesperado %x", version, witness)
+		}
+		if final.TxHash() != tx.TxHash() {
+			t.Fatalf("v%d: txid %s, esperava %s", version, final.TxHash(), tx.TxHash())
+		}
+	}
+}
+
+func TestSignRejectsSigHash(t *testing.T) {
+	pubKey, privKey := testKey("sighash")
+	keys := map[string][]byte{hex.EncodeToString(pubKey): privKey}
+	program, err := helpers.GetP2WPKHProgram(pubKey, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := bip174CreatorTx(t)
+	prevouts := []models.UTXO{
+		{Value: 0.001, ScriptPubKey: program},
+		{Value: 0.001, ScriptPubKey: program},
+	}
+
+	tests := []struct {
+		name       string
+		sigHash    uint32
+		anySigHash bool
+		wantErr    bool
+	}{
+		{"SIGHASH_ALL explícito", 0x01, false, false},
+		{"SIGHASH_NONE", 0x02, false, true},
+		{"SIGHASH_SINGLE|ANYONECANPAY", 0x83, false, true},
+		{"SIGHASH_NONE liberado", 0x02, true, false},
+		{"tipo inexistente, mesmo liberado", 0x04, true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := FromTransaction(tx, prevouts, Version0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Inputs[0].SetType(InSighashType, uint32Bytes(tc.sigHash))
+			added, err := p.Sign(keys, tc.anySigHash)
+			if tc.wantErr {
+				if err == nil || len(p.Inputs[0].ByType(InPartialSig)) != 0 {
+					t.Fatalf("sighash %#x assinado (%d assinaturas)", tc.sigHash, added)
+				}
+				return
+			}
+			if err != nil || added != 2 {
+				t.Fatalf("%d assinaturas (%v), esperava 2", added, err)
+			}
+		})
+	}
+}
+
+func TestCombineOtherTransaction(t *testing.T) {
+	tx := bip174CreatorTx(t)
+	a, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxOut[0].Value--
+	b, err := FromTransaction(tx, make([]models.UTXO, len(tx.TxIn)), Version0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine(a, b); err == nil {
+		t.Fatal("Combine de transações diferentes não falhou")
+	}
+}
@@ -0,0 +1,644 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// Os papéis do BIP174: o criador monta o PSBT a partir da transação sem
+// assinaturas, o atualizador acrescenta UTXOs, scripts e derivações, o
+// assinante acrescenta assinaturas parciais, o combinador junta os PSBTs de
+// vários assinantes, o finalizador monta scriptSig e witness e o extrator
+// produz a transação para transmitir.
+
+// FromTransaction cria um PSBT da versão pedida (Version0 ou Version2) com as
+// entradas e saídas de tx, ignorando witnesses. prevouts são os UTXOs gastos,
+// na ordem das entradas: os que têm ScriptPubKey entram como WITNESS_UTXO e
+// os multisig também com o WITNESS_SCRIPT; os demais ficam só com o outpoint.
+func FromTransaction(tx *wire.MsgTx, prevouts []models.UTXO, version int) (*Packet, error) {
+	if len(prevouts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("%d UTXOs para %d entradas", len(prevouts), len(tx.TxIn))
+	}
+	unsigned := tx.Copy()
+	for _, txIn := range unsigned.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+
+	p := &Packet{
+		Inputs:  make([]Map, len(unsigned.TxIn)),
+		Outputs: make([]Map, len(unsigned.TxOut)),
+	}
+	switch version {
+	case Version0:
+		p.Global.SetType(GlobalUnsignedTx, helpers.SerializeTx(unsigned, false))
+	case Version2:
+		if unsigned.Version < 2 {
+			return nil, fmt.Errorf("PSBT v2 exige transação versão 2 ou maior")
+		}
+		p.Global.SetType(GlobalTxVersion, uint32Bytes(uint32(unsigned.Version)))
+		p.Global.SetType(GlobalFallbackLocktime, uint32Bytes(unsigned.LockTime))
+		p.Global.SetType(GlobalInputCount, compactBytes(uint64(len(unsigned.TxIn))))
+		p.Global.SetType(GlobalOutputCount, compactBytes(uint64(len(unsigned.TxOut))))
+		p.Global.SetType(GlobalVersion, uint32Bytes(Version2))
+		for i, txIn := range unsigned.TxIn {
+			p.Inputs[i].SetType(InPreviousTxID, append([]byte(nil), txIn.PreviousOutPoint.Hash[:]...))
+			p.Inputs[i].SetType(InOutputIndex, uint32Bytes(txIn.PreviousOutPoint.Index))
+			p.Inputs[i].SetType(InSequence, uint32Bytes(txIn.Sequence))
+		}
+		for i, txOut := range unsigned.TxOut {
+			amount := make([]byte, 8)
+			binary.LittleEndian.PutUint64(amount, uint64(txOut.Value))
+			p.Outputs[i].SetType(OutAmount, amount)
+			p.Outputs[i].SetType(OutScript, txOut.PkScript)
+		}
+	default:
+		return nil, fmt.Errorf("versão de PSBT %d não suportada", version)
+	}
+
+	for i, utxo := range prevouts {
+		if len(utxo.ScriptPubKey) == 0 {
+			continue
+		}
+		value := int64(math.Round(utxo.Value * 1e8))
+		p.Inputs[i].SetType(InWitnessUTXO, encodeTxOut(wire.NewTxOut(value, utxo.ScriptPubKey)))
+		if len(utxo.WitnessScript) > 0 {
+			p.Inputs[i].SetType(InWitnessScript, utxo.WitnessScript)
+		}
+	}
+	return p, nil
+}
+
+// SetNonWitnessUTXO grava a transação anterior inteira da entrada idx
+// (NON_WITNESS_UTXO), que o Bitcoin Core pede para assinar entradas segwit v0.
+func (p *Packet) SetNonWitnessUTXO(idx int, rawTx []byte) error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return fmt.Errorf("entrada %d fora do PSBT com %d entradas", idx, len(tx.TxIn))
+	}
+	prevTx, err := helpers.DeserializeTx(rawTx)
+	if err != nil {
+		return err
+	}
+	outPoint := tx.TxIn[idx].PreviousOutPoint
+	if prevTx.TxHash() != outPoint.Hash || int(outPoint.Index) >= len(prevTx.TxOut) {
+		return fmt.Errorf("transação %s não é a anterior da entrada %d (%s)", helpers.TxID(prevTx), idx, outPoint)
+	}
+	p.Inputs[idx].SetType(InNonWitnessUTXO, helpers.SerializeTx(prevTx, true))
+	return nil
+}
+
+// AddDerivations acrescenta as origens BIP32 (fingerprint da chave mestre e
+// caminho) das chaves da carteira que aparecem nas entradas, pelo witness
+// program ou pelo witness script, e nas saídas, como o troco. Com elas outro
+// assinante com a mesma semente, como o Bitcoin Core, encontra suas chaves.
+func (p *Packet) AddDerivations(state *models.WalletState, fingerprint [4]byte) error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	byPubKey := make(map[string]models.DerivedKey)
+	byProgram := make(map[string]models.DerivedKey)
+	for i := range state.PublicKeys {
+		key := state.Key(i)
+		byPubKey[string(key.PublicKey)] = key
+		byProgram[string(key.WitnessProgram)] = key
+	}
+	for _, key := range state.ChangeKeys {
+		byPubKey[string(key.PublicKey)] = key
+		byProgram[string(key.WitnessProgram)] = key
+	}
+
+	derivation := func(key models.DerivedKey) []byte {
+		value := append([]byte(nil), fingerprint[:]...)
+		for _, index := range helpers.KeyPath(key) {
+			value = append(value, uint32Bytes(index)...)
+		}
+		return value
+	}
+
+	for i, m := range p.Inputs {
+		prevOut, err := p.prevOut(tx, i)
+		if err != nil || prevOut == nil {
+			continue
+		}
+		if key, ok := byProgram[string(prevOut.PkScript)]; ok {
+			p.Inputs[i].Set(append([]byte{InBIP32Derivation}, key.PublicKey...), derivation(key))
+		}
+		if witnessScript, ok := m.GetType(InWitnessScript); ok {
+			if _, pubKeys, err := helpers.ParseMultisigScript(witnessScript); err == nil {
+				for _, pubKey := range pubKeys {
+					if key, ok := byPubKey[string(pubKey)]; ok {
+						p.Inputs[i].Set(append([]byte{InBIP32Derivation}, key.PublicKey...), derivation(key))
+					}
+				}
+			}
+		}
+	}
+	for i, txOut := range tx.TxOut {
+		if key, ok := byProgram[string(txOut.PkScript)]; ok {
+			p.Outputs[i].Set(append([]byte{OutBIP32Derivation}, key.PublicKey...), derivation(key))
+		}
+	}
+	return nil
+}
+
+// Derivation é a origem BIP32 de uma chave pública do PSBT: o fingerprint
+// da chave mestre e o caminho a partir dela.
+type Derivation struct {
+	PubKey      []byte
+	Fingerprint [4]byte
+	Path        []uint32
+}
+
+// Derivations retorna as origens BIP32 do mapa, com keyType
+// InBIP32Derivation nas entradas ou OutBIP32Derivation nas saídas. Pares
+// malformados são ignorados.
+func (m Map) Derivations(keyType byte) []Derivation {
+	var derivations []Derivation
+	for _, pair := range m.ByType(keyType) {
+		if len(pair.Key) != 34 || len(pair.Value) < 4 || len(pair.Value)%4 != 0 {
+			continue
+		}
+		d := Derivation{PubKey: pair.Key[1:]}
+		copy(d.Fingerprint[:], pair.Value)
+		for i := 4; i < len(pair.Value); i += 4 {
+			d.Path = append(d.Path, binary.LittleEndian.Uint32(pair.Value[i:]))
+		}
+		derivations = append(derivations, d)
+	}
+	return derivations
+}
+
+// spendInfo descreve como gastar uma entrada segwit v0.
+type spendInfo struct {
+	prevOut      *wire.TxOut
+	redeemScript []byte   // scriptSig do P2SH; vazio em segwit nativo
+	scriptCode   []byte   // scriptCode do BIP143
+	program      []byte   // witness program (P2WPKH ou P2WSH)
+	m            int      // assinaturas exigidas (1 no P2WPKH)
+	pubKeys      [][]byte // chaves do multisig, na ordem do script
+}
+
+// spend identifica o tipo da entrada idx pelo UTXO e pelos scripts do PSBT.
+// Retorna nil sem erro se faltar o UTXO ou se o tipo não for suportado
+// (P2WPKH ou multisig P2WSH, nativos ou dentro de P2SH).
+func (p *Packet) spend(tx *wire.MsgTx, idx int) (*spendInfo, error) {
+	prevOut, err := p.prevOut(tx, idx)
+	if err != nil || prevOut == nil {
+		return nil, err
+	}
+	info := &spendInfo{prevOut: prevOut, program: prevOut.PkScript}
+	m := p.Inputs[idx]
+
+	if txscript.IsPayToScriptHash(prevOut.PkScript) {
+		redeemScript, ok := m.GetType(InRedeemScript)
+		if !ok {
+			return nil, nil
+		}
+		if !bytes.Equal(btcutil.Hash160(redeemScript), prevOut.PkScript[2:22]) {
+			return nil, fmt.Errorf("redeem script não corresponde ao P2SH do UTXO")
+		}
+		info.redeemScript = redeemScript
+		info.program = redeemScript
+	}
+
+	switch {
+	case txscript.IsPayToWitnessPubKeyHash(info.program):
+		scriptCode, err := helpers.P2WPKHScriptCode(info.program)
+		if err != nil {
+			return nil, err
+		}
+		info.scriptCode = scriptCode
+		info.m = 1
+		return info, nil
+	case txscript.IsPayToWitnessScriptHash(info.program):
+		witnessScript, ok := m.GetType(InWitnessScript)
+		if !ok {
+			return nil, nil
+		}
+		hash := sha256.Sum256(witnessScript)
+		if !bytes.Equal(hash[:], info.program[2:]) {
+			return nil, fmt.Errorf("witness script não corresponde ao P2WSH do UTXO")
+		}
+		if info.m, info.pubKeys, err = helpers.ParseMultisigScript(witnessScript); err != nil {
+			return nil, nil
+		}
+		info.scriptCode = witnessScript
+		return info, nil
+	}
+	return nil, nil
+}
+
+// prevOut retorna a saída gasta pela entrada idx, do WITNESS_UTXO ou da
+// transação anterior, conferindo que as duas concordam; nil se nenhuma estiver
+// presente.
+func (p *Packet) prevOut(tx *wire.MsgTx, idx int) (*wire.TxOut, error) {
+	m := p.Inputs[idx]
+	var fromTx, fromWitness *wire.TxOut
+	if raw, ok := m.GetType(InNonWitnessUTXO); ok {
+		prevTx, err := helpers.DeserializeTx(raw)
+		if err != nil {
+			return nil, fmt.Errorf("entrada %d: NON_WITNESS_UTXO inválido: %w", idx, err)
+		}
+		outPoint := tx.TxIn[idx].PreviousOutPoint
+		if prevTx.TxHash() != outPoint.Hash || int(outPoint.Index) >= len(prevTx.TxOut) {
+			return nil, fmt.Errorf("entrada %d: NON_WITNESS_UTXO não é a transação de %s", idx, outPoint)
+		}
+		fromTx = prevTx.TxOut[outPoint.Index]
+	}
+	if raw, ok := m.GetType(InWitnessUTXO); ok {
+		txOut, err := decodeTxOut(raw)
+		if err != nil {
+			return nil, fmt.Errorf("entrada %d: WITNESS_UTXO inválido: %w", idx, err)
+		}
+		fromWitness = txOut
+	}
+	if fromTx != nil && fromWitness != nil &&
+		(fromTx.Value != fromWitness.Value || !bytes.Equal(fromTx.PkScript, fromWitness.PkScript)) {
+		return nil, fmt.Errorf("entrada %d: WITNESS_UTXO difere da transação anterior", idx)
+	}
+	if fromWitness != nil {
+		return fromWitness, nil
+	}
+	return fromTx, nil
+}
+
+// sigHashType é o tipo de sighash pedido para a entrada (SIGHASH_ALL por
+// padrão). Só os tipos definidos (ALL, NONE e SINGLE, com ou sem
+// ANYONECANPAY) são aceitos.
+func sigHashType(m Map) (txscript.SigHashType, error) {
+	value, ok := m.GetType(InSighashType)
+	if !ok {
+		return txscript.SigHashAll, nil
+	}
+	if len(value) != 4 {
+		return 0, fmt.Errorf("SIGHASH_TYPE malformado")
+	}
+	hashType := txscript.SigHashType(binary.LittleEndian.Uint32(value))
+	switch hashType &^ txscript.SigHashAnyOneCanPay {
+	case txscript.SigHashAll, txscript.SigHashNone, txscript.SigHashSingle:
+		return hashType, nil
+	}
+	return 0, fmt.Errorf("SIGHASH_TYPE %#x inválido", uint32(hashType))
+}
+
+// finalized indica se a entrada já tem scriptSig ou witness final.
+func finalized(m Map) bool {
+	_, hasSig := m.GetType(InFinalScriptSig)
+	_, hasWitness := m.GetType(InFinalScriptWitness)
+	return hasSig || hasWitness
+}
+
+// Sign acrescenta assinaturas parciais com as chaves de keys (chave privada
+// por chave pública em hex; veja helpers.SigningKeys) nas entradas que elas
+// podem assinar. Entradas já finalizadas ou sem UTXO ficam como estão.
+// Retorna quantas assinaturas foram acrescentadas.
+//
+// Só SIGHASH_ALL cobre todas as entradas e saídas: com outro tipo, quem
+// montou o PSBT pode trocar as saídas depois da assinatura. Um PSBT que pede
+// outro tipo é recusado, como no Bitcoin Core, a menos que anySigHash libere o
+// tipo pedido em cada entrada.
+func (p *Packet) Sign(keys map[string][]byte, anySigHash bool) (int, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return 0, err
+	}
+	cache := helpers.NewSigHashCache(tx)
+
+	added := 0
+	for i := range p.Inputs {
+		if finalized(p.Inputs[i]) {
+			continue
+		}
+		info, err := p.spend(tx, i)
+		if err != nil {
+			return added, err
+		}
+		if info == nil {
+			continue
+		}
+		hashType, err := sigHashType(p.Inputs[i])
+		if err != nil {
+			return added, fmt.Errorf("entrada %d: %w", i, err)
+		}
+
+		candidates := info.pubKeys
+		if info.pubKeys == nil {
+			for pubHex := range keys {
+				pubKey, err := hex.DecodeString(pubHex)
+				if err == nil && bytes.Equal(btcutil.Hash160(pubKey), info.program[2:]) {
+					candidates = [][]byte{pubKey}
+					break
+				}
+			}
+		}
+
+		for _, pubKey := range candidates {
+			privKey, ok := keys[hex.EncodeToString(pubKey)]
+			if !ok {
+				continue
+			}
+			sigKey := append([]byte{InPartialSig}, pubKey...)
+			if _, signed := p.Inputs[i].Get(sigKey); signed {
+				continue
+			}
+			if hashType != txscript.SigHashAll && !anySigHash {
+				return added, fmt.Errorf("entrada %d pede sighash %#x em vez de SIGHASH_ALL: a assinatura não cobriria todas as saídas", i, uint32(hashType))
+			}
+			hash, err := helpers.WitnessSigHash(tx, cache, i, info.scriptCode, info.prevOut.Value, hashType)
+			if err != nil {
+				return added, err
+			}
+			key, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKey)
+			sig, err := helpers.SignHash(hash, key, hashType)
+			if err != nil {
+				return added, fmt.Errorf("entrada %d: %w", i, err)
+			}
+			p.Inputs[i].Set(sigKey, sig)
+			added++
+		}
+	}
+	return added, nil
+}
+
+// Combine junta os PSBTs de vários assinantes da mesma transação: cada mapa
+// do resultado tem a união dos pares; numa chave repetida vale o primeiro.
+func Combine(packets ...*Packet) (*Packet, error) {
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("nenhum PSBT para combinar")
+	}
+	id, err := packets[0].ID()
+	if err != nil {
+		return nil, err
+	}
+	combined := &Packet{Global: packets[0].Global.clone()}
+	for _, m := range packets[0].Inputs {
+		combined.Inputs = append(combined.Inputs, m.clone())
+	}
+	for _, m := range packets[0].Outputs {
+		combined.Outputs = append(combined.Outputs, m.clone())
+	}
+
+	merge := func(dst *Map, src Map) {
+		for _, pair := range src {
+			if _, ok := dst.Get(pair.Key); !ok {
+				dst.Set(append([]byte(nil), pair.Key...), append([]byte(nil), pair.Value...))
+			}
+		}
+	}
+	for n, p := range packets[1:] {
+		other, err := p.ID()
+		if err != nil {
+			return nil, err
+		}
+		if other != id || p.Version() != combined.Version() {
+			return nil, fmt.Errorf("PSBT %d é de outra transação (%s, versão %d)", n+2, other, p.Version())
+		}
+		merge(&combined.Global, p.Global)
+		for i := range combined.Inputs {
+			merge(&combined.Inputs[i], p.Inputs[i])
+		}
+		for i := range combined.Outputs {
+			merge(&combined.Outputs[i], p.Outputs[i])
+		}
+	}
+	return combined, nil
+}
+
+// Finalize monta o scriptSig e o witness finais das entradas que já têm
+// assinaturas válidas suficientes e remove delas os campos que só serviam aos
+// assinantes. Assinaturas parciais inválidas são ignoradas. Retorna se todas
+// as entradas estão finalizadas.
+func (p *Packet) Finalize() (bool, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return false, err
+	}
+	cache := helpers.NewSigHashCache(tx)
+
+	complete := true
+	for i := range p.Inputs {
+		if finalized(p.Inputs[i]) {
+			continue
+		}
+		info, err := p.spend(tx, i)
+		if err != nil {
+			return false, err
+		}
+		if info == nil {
+			complete = false
+			continue
+		}
+
+		valid := func(pubKey []byte) []byte {
+			sig, ok := p.Inputs[i].Get(append([]byte{InPartialSig}, pubKey...))
+			if !ok || len(sig) < 9 {
+				return nil
+			}
+			hash, err := helpers.WitnessSigHash(tx, cache, i, info.scriptCode, info.prevOut.Value, txscript.SigHashType(sig[len(sig)-1]))
+			if err != nil || !verifySignature(sig[:len(sig)-1], hash, pubKey) {
+				return nil
+			}
+			return sig
+		}
+
+		var witness wire.TxWitness
+		if info.pubKeys == nil {
+			for _, pair := range p.Inputs[i].ByType(InPartialSig) {
+				pubKey := pair.Key[1:]
+				if !bytes.Equal(btcutil.Hash160(pubKey), info.program[2:]) {
+					continue
+				}
+				if sig := valid(pubKey); sig != nil {
+					witness = wire.TxWitness{sig, pubKey}
+					break
+				}
+			}
+		} else {
+			// Assinaturas na ordem das chaves do script, depois do dummy que o
+			// OP_CHECKMULTISIG consome
+			witness = wire.TxWitness{nil}
+			for _, pubKey := range info.pubKeys {
+				if sig := valid(pubKey); sig != nil && len(witness) <= info.m {
+					witness = append(witness, sig)
+				}
+			}
+			if len(witness) <= info.m {
+				witness = nil
+			} else {
+				witness = append(witness, info.scriptCode)
+			}
+		}
+		if witness == nil {
+			complete = false
+			continue
+		}
+
+		p.Inputs[i].SetType(InFinalScriptWitness, encodeWitness(witness))
+		if info.redeemScript != nil {
+			scriptSig, err := txscript.NewScriptBuilder().AddData(info.redeemScript).Script()
+			if err != nil {
+				return false, err
+			}
+			p.Inputs[i].SetType(InFinalScriptSig, scriptSig)
+		}
+		for _, keyType := range []byte{InPartialSig, InSighashType, InRedeemScript, InWitnessScript, InBIP32Derivation} {
+			p.Inputs[i].DeleteType(keyType)
+		}
+	}
+	return complete, nil
+}
+
+// Extract monta a transação assinada de um PSBT com todas as entradas
+// finalizadas e confere cada entrada com o interpretador de script.
+func (p *Packet) Extract() (*wire.MsgTx, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range p.Inputs {
+		if !finalized(m) {
+			return nil, fmt.Errorf("entrada %d não finalizada", i)
+		}
+		tx.TxIn[i].SignatureScript, _ = m.GetType(InFinalScriptSig)
+		if raw, ok := m.GetType(InFinalScriptWitness); ok {
+			if tx.TxIn[i].Witness, err = decodeWitness(raw); err != nil {
+				return nil, fmt.Errorf("entrada %d: witness final inválido: %w", i, err)
+			}
+		}
+	}
+
+	for i := range tx.TxIn {
+		prevOut, err := p.prevOut(tx, i)
+		if err != nil {
+			return nil, err
+		}
+		if prevOut == nil {
+			return nil, fmt.Errorf("entrada %d sem UTXO para verificar", i)
+		}
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil, nil, prevOut.Value)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao verificar: %w", err)
+		}
+		if err := vm.Execute(); err != nil {
+			return nil, fmt.Errorf("verificação de assinatura da entrada %d falhou: %w", i, err)
+		}
+	}
+	return tx, nil
+}
+
+// Fee retorna a taxa do PSBT em satoshis; exige o UTXO de todas as entradas.
+func (p *Packet) Fee() (int64, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return 0, err
+	}
+	var fee int64
+	for i := range tx.TxIn {
+		prevOut, err := p.prevOut(tx, i)
+		if err != nil {
+			return 0, err
+		}
+		if prevOut == nil {
+			return 0, fmt.Errorf("entrada %d sem UTXO: taxa desconhecida", i)
+		}
+		fee += prevOut.Value
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= txOut.Value
+	}
+	return fee, nil
+}
+
+// verifySignature confere a assinatura DER de pubKey sobre hash.
+func verifySignature(der []byte, hash [32]byte, pubKey []byte) bool {
+	sig, err := btcec.ParseDERSignature(der, btcec.S256())
+	if err != nil {
+		return false
+	}
+	key, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	if err != nil {
+		return false
+	}
+	return sig.Verify(hash[:], key)
+}
+
+// encodeTxOut serializa uma saída como no WITNESS_UTXO: valor e scriptPubKey.
+func encodeTxOut(txOut *wire.TxOut) []byte {
+	var buf bytes.Buffer
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, uint64(txOut.Value))
+	buf.Write(value)
+	helpers.WriteCompactSize(&buf, uint64(len(txOut.PkScript)))
+	buf.Write(txOut.PkScript)
+	return buf.Bytes()
+}
+
+func decodeTxOut(data []byte) (*wire.TxOut, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("saída truncada")
+	}
+	n, size, err := helpers.ReadCompactSize(data[8:])
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)-8-size) != n {
+		return nil, fmt.Errorf("tamanho do script não confere")
+	}
+	return wire.NewTxOut(int64(binary.LittleEndian.Uint64(data)), append([]byte(nil), data[8+size:]...)), nil
+}
+
+// encodeWitness serializa um witness como no FINAL_SCRIPTWITNESS: a contagem
+// de itens e cada item com seu tamanho.
+func encodeWitness(witness wire.TxWitness) []byte {
+	var buf bytes.Buffer
+	helpers.WriteCompactSize(&buf, uint64(len(witness)))
+	for _, item := range witness {
+		helpers.WriteCompactSize(&buf, uint64(len(item)))
+		buf.Write(item)
+	}
+	return buf.Bytes()
+}
+
+func decodeWitness(data []byte) (wire.TxWitness, error) {
+	r := &reader{data: data}
+	count, err := r.compactSize()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(data)) {
+		return nil, fmt.Errorf("witness com %d itens maior que os dados", count)
+	}
+	witness := make(wire.TxWitness, 0, count)
+	for i := uint64(0); i < count; i++ {
+		n, err := r.compactSize()
+		if err != nil {
+			return nil, err
+		}
+		item, err := r.read(n)
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes sobrando depois do witness", len(data)-r.pos)
+	}
+	return witness, nil
+}
@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"wallet/internal/storage"
+	"wallet/pkg/models"
+)
+
+// Tipos de anomalia encontrados por Explain
+const (
+	AnomalyScriptMismatch = "endereço sem script" // Casado pelo endereço, mas o script não é o da chave
+	AnomalyAddressMissing = "script sem endereço" // Script da carteira que o scan por endereço não reconhece
+	AnomalyUnknownSpend   = "gasto desconhecido"  // Entrada assinada por chave da carteira gastando outpoint que ela não conhece
+	AnomalySkippedBlock   = "bloco pulado"        // Bloco que não pôde ser buscado
+	AnomalyStateMismatch  = "estado divergente"   // O replay não reproduz os UTXOs salvos
+)
+
+// OutpointTrail é o histórico de um outpoint da carteira.
+type OutpointTrail struct {
+	Outpoint       string
+	Address        string
+	Value          float64
+	ReceivedHeight int
+	SpentHeight    int    // 0 se não gasto
+	SpentBy        string // txid:vin que gastou
+}
+
+// Anomaly é algo no histórico que explica uma diferença de saldo.
+type Anomaly struct {
+	Height int
+	Kind   string
+	Detail string
+}
+
+// Explanation é o resultado do replay do histórico da carteira.
+type Explanation struct {
+	Height    int
+	Outpoints []*OutpointTrail // Em ordem de recebimento
+	Anomalies []Anomaly
+	Balance   float64 // Soma dos outpoints não gastos no replay
+}
+
+// Explain refaz o scan dos blocos 1 a lastProcessed (do cache ou do nó) sem
+// alterar o estado nem o banco de UTXOs, registrando onde cada outpoint foi
+// recebido e gasto. As regras de casamento são as de ProcessBlock, e os casos
+// em que elas podem errar o saldo são reportados como anomalias.
+func Explain(db *storage.DB, state *models.WalletState, lastProcessed int) (*Explanation, error) {
+	explanation := &Explanation{Height: lastProcessed}
+	report := func(height int, kind, format string, args ...interface{}) {
+		explanation.Anomalies = append(explanation.Anomalies, Anomaly{Height: height, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	scriptByAddress := make(map[string]string, len(state.Addresses))
+	addressByScript := make(map[string]string, len(state.WitnessPrograms))
+	walletPubKeys := make(map[string]bool, len(state.PublicKeys))
+	for i := range state.Addresses {
+		script := hex.EncodeToString(state.WitnessPrograms[i])
+		scriptByAddress[state.Addresses[i][0]] = script
+		addressByScript[script] = state.Addresses[i][0]
+		walletPubKeys[hex.EncodeToString(state.PublicKeys[i])] = true
+	}
+	for _, key := range state.ChangeKeys {
+		script := hex.EncodeToString(key.WitnessProgram)
+		scriptByAddress[key.Address] = script
+		addressByScript[script] = key.Address
+		walletPubKeys[hex.EncodeToString(key.PublicKey)] = true
+	}
+	for _, ms := range state.Multisigs {
+		script := hex.EncodeToString(ms.WitnessProgram)
+		scriptByAddress[ms.Address] = script
+		addressByScript[script] = ms.Address
+	}
+
+	// Falhas registradas pelo scan, mesmo que o bloco tenha sido obtido depois
+	fetchErrors, err := db.FetchErrors()
+	if err != nil {
+		return nil, err
+	}
+	failed := make([]int, 0, len(fetchErrors))
+	for height := range fetchErrors {
+		failed = append(failed, height)
+	}
+	sort.Ints(failed)
+	for _, height := range failed {
+		report(height, AnomalySkippedBlock, "falha registrada pelo scan: %s", fetchErrors[height])
+	}
+
+	trails := make(map[string]*OutpointTrail)
+	for height := 1; height <= lastProcessed; height++ {
+		block, err := storage.FetchAndStoreBlock(db, height)
+		if err != nil {
+			report(height, AnomalySkippedBlock, "não foi possível buscar o bloco no replay: %v", err)
+			continue
+		}
+		txList, _ := block["tx"].([]interface{})
+		for _, tx := range txList {
+			txMap, ok := tx.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			txid, _ := txMap["txid"].(string)
+
+			voutList, _ := txMap["vout"].([]interface{})
+			for voutIndex, vout := range voutList {
+				voutMap, ok := vout.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				scriptPubKey, _ := voutMap["scriptPubKey"].(map[string]interface{})
+				address, _ := scriptPubKey["address"].(string)
+				script, _ := scriptPubKey["hex"].(string)
+				value, _ := voutMap["value"].(float64)
+				outpoint := fmt.Sprintf("%s:%d", txid, voutIndex)
+
+				walletScript, byAddress := scriptByAddress[address]
+				if !byAddress {
+					if owner, byScript := addressByScript[script]; byScript {
+						report(height, AnomalyAddressMissing, "%s paga %.8f ao script de %s, mas o endereço do nó é %q", outpoint, value, owner, address)
+					}
+					continue
+				}
+				if script != walletScript {
+					report(height, AnomalyScriptMismatch, "%s casado pelo endereço %s, mas o script %s não é o da chave (%s)", outpoint, address, script, walletScript)
+				}
+				if _, seen := trails[outpoint]; seen {
+					continue
+				}
+				trail := &OutpointTrail{Outpoint: outpoint, Address: address, Value: value, ReceivedHeight: height}
+				trails[outpoint] = trail
+				explanation.Outpoints = append(explanation.Outpoints, trail)
+			}
+
+			vinList, _ := txMap["vin"].([]interface{})
+			for vinIndex, vin := range vinList {
+				vinMap, ok := vin.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				prevTxID, ok := vinMap["txid"].(string)
+				if !ok {
+					continue // Coinbase
+				}
+				prevVout, _ := vinMap["vout"].(float64)
+				outpoint := fmt.Sprintf("%s:%d", prevTxID, int(prevVout))
+
+				if trail, ok := trails[outpoint]; ok && trail.SpentHeight == 0 {
+					trail.SpentHeight = height
+					trail.SpentBy = fmt.Sprintf("%s:%d", txid, vinIndex)
+					continue
+				}
+				// P2WPKH: a chave pública é o segundo item da witness
+				witness, _ := vinMap["txinwitness"].([]interface{})
+				if len(witness) == 2 && walletPubKeys[fmt.Sprint(witness[1])] {
+					report(height, AnomalyUnknownSpend, "%s:%d gasta %s com chave da carteira, mas o outpoint não é conhecido", txid, vinIndex, outpoint)
+				}
+			}
+		}
+	}
+
+	// O replay precisa chegar aos mesmos UTXOs do estado salvo
+	for _, trail := range explanation.Outpoints {
+		if trail.SpentHeight != 0 {
+			continue
+		}
+		explanation.Balance += trail.Value
+		if _, ok := state.UTXOs[trail.Outpoint]; !ok {
+			report(lastProcessed, AnomalyStateMismatch, "%s não gasto no replay, mas ausente do estado", trail.Outpoint)
+		}
+	}
+	stored := make([]string, 0, len(state.UTXOs))
+	for outpoint := range state.UTXOs {
+		stored = append(stored, outpoint)
+	}
+	sort.Strings(stored)
+	for _, outpoint := range stored {
+		if trail, ok := trails[outpoint]; !ok || trail.SpentHeight != 0 {
+			report(lastProcessed, AnomalyStateMismatch, "%s está no estado, mas o replay não o tem como não gasto", outpoint)
+		}
+	}
+
+	sort.SliceStable(explanation.Anomalies, func(i, j int) bool {
+		return explanation.Anomalies[i].Height < explanation.Anomalies[j].Height
+	})
+	return explanation, nil
+}
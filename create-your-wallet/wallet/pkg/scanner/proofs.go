@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"wallet/internal/storage"
+	"wallet/pkg/chain"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// recordProofs gera a prova SPV de cada transação da carteira no bloco height
+// (as registradas no índice do delta), confere a prova contra a merkleroot do
+// cabeçalho e a guarda no delta para ser gravada com o ledger. Uma prova que
+// não pode ser gerada não impede o scan; ela pode ser obtida depois do nó.
+func recordProofs(delta *models.StateDelta, block map[string]interface{}, height int, header *wire.BlockHeader) {
+	index := delta.Touched[height]
+	if len(index) == 0 {
+		return
+	}
+	txids, err := helpers.BlockTxIDs(block)
+	if err != nil {
+		fmt.Printf("Erro ao gerar provas do bloco %d: %v\n", height, err)
+		return
+	}
+
+	wallet := make(map[string]bool)
+	for _, touched := range index {
+		for _, txid := range touched {
+			wallet[txid] = true
+		}
+	}
+	for txid := range wallet {
+		raw, err := chain.BuildMerkleBlock(header, txids, map[string]bool{txid: true})
+		if err == nil {
+			err = checkProof(raw, txid, header)
+		}
+		if err != nil {
+			fmt.Printf("Erro ao gerar prova de %s: %v\n", txid, err)
+			continue
+		}
+		delta.AddProof(models.TxProof{
+			TxID:        txid,
+			Height:      height,
+			BlockHash:   header.BlockHash().String(),
+			MerkleBlock: hex.EncodeToString(raw),
+		})
+	}
+}
+
+// checkProof confere que a prova reconstrói a merkleroot do cabeçalho
+// informado e prova exatamente txid.
+func checkProof(raw []byte, txid string, header *wire.BlockHeader) error {
+	proven, txids, err := chain.VerifyMerkleBlock(raw)
+	if err != nil {
+		return err
+	}
+	if proven.BlockHash() != header.BlockHash() {
+		return fmt.Errorf("prova do bloco %s, esperado %s", proven.BlockHash(), header.BlockHash())
+	}
+	if len(txids) != 1 || txids[0] != txid {
+		return fmt.Errorf("prova não inclui %s", txid)
+	}
+	return nil
+}
+
+// VerifyProof confere uma prova gravada contra a cadeia de cabeçalhos aceita:
+// o cabeçalho da prova precisa ser o aceito na altura e a raiz precisa conferir.
+// Sem cabeçalho aceito na altura, a prova só é conferida internamente.
+func VerifyProof(db *storage.DB, proof models.TxProof) error {
+	raw, err := hex.DecodeString(proof.MerkleBlock)
+	if err != nil {
+		return fmt.Errorf("prova em hex inválido: %w", err)
+	}
+	header, _, err := chain.VerifyMerkleBlock(raw)
+	if err != nil {
+		return err
+	}
+	if header.BlockHash().String() != proof.BlockHash {
+		return fmt.Errorf("prova do bloco %s, registrada para %s", header.BlockHash(), proof.BlockHash)
+	}
+	stored, err := StoredHeader(db, proof.Height)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		header = stored
+	}
+	return checkProof(raw, proof.TxID, header)
+}
+
+// FetchProof obtém do nó (gettxoutproof) a prova de uma transação do ledger
+// que ainda não tem prova, por exemplo de blocos escaneados antes das provas
+// existirem, e a confere antes de retornar.
+func FetchProof(db *storage.DB, txid string, height int) (models.TxProof, error) {
+	var proof models.TxProof
+	stored, err := StoredHeader(db, height)
+	if err != nil {
+		return proof, err
+	}
+	blockHash := ""
+	if stored != nil {
+		blockHash = stored.BlockHash().String()
+	} else {
+		result, err := helpers.RunBitcoinCLI("getblockhash", fmt.Sprint(height))
+		if err != nil {
+			return proof, err
+		}
+		blockHash = fmt.Sprint(result)
+	}
+
+	result, err := helpers.RunBitcoinCLI("gettxoutproof", fmt.Sprintf(`["%s"]`, txid), blockHash)
+	if err != nil {
+		return proof, err
+	}
+	raw, err := hex.DecodeString(fmt.Sprint(result))
+	if err != nil {
+		return proof, fmt.Errorf("gettxoutproof retornou hex inválido: %w", err)
+	}
+	proof = models.TxProof{TxID: txid, Height: height, BlockHash: blockHash, MerkleBlock: hex.EncodeToString(raw)}
+	if err := VerifyProof(db, proof); err != nil {
+		return proof, fmt.Errorf("prova do nó para %s inválida: %w", txid, err)
+	}
+	return proof, nil
+}
+
+// MissingProofs retorna as transações do ledger sem prova gravada, com a
+// altura de cada uma.
+func MissingProofs(db *storage.DB) (map[string]int, error) {
+	missing := make(map[string]int)
+	err := db.View(func(txn storage.Txn) error {
+		entries, err := storage.ListLedger(txn, 0, int(^uint(0)>>1))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if _, err := storage.GetProof(txn, entry.TxID); err == storage.ErrNotFound {
+				missing[entry.TxID] = entry.Height
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return missing, err
+}
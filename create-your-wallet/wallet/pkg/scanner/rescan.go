@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"fmt"
+
+	"wallet/internal/storage"
+	"wallet/pkg/chain"
+	"wallet/pkg/models"
+	"wallet/pkg/progress"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// IndexedHeights retorna as alturas que o índice de blocos marca como tendo
+// atividade da carteira.
+func IndexedHeights(db *storage.DB) ([]int, error) {
+	var heights []int
+	err := db.View(func(txn storage.Txn) error {
+		var err error
+		heights, err = storage.ListIndexedHeights(txn, nil)
+		return err
+	})
+	return heights, err
+}
+
+// Rescan reconstrói UTXOs, ledger e índice reaplicando ao estado apenas os
+// blocos em heights (em ordem crescente), lidos do cache quando possível.
+// Com o índice completo isso reproduz o histórico sem percorrer a cadeia
+// inteira; depois de adicionar chaves novas, passe todas as alturas já
+// processadas para que o índice passe a incluí-las.
+func Rescan(db *storage.DB, state *models.WalletState, heights []int, lastProcessed int) error {
+	state.UTXOs = make(map[string]models.UTXO)
+	delta := models.NewStateDelta()
+
+	for _, height := range heights {
+		if height > lastProcessed {
+			break
+		}
+		block, err := storage.FetchAndStoreBlock(db, height)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar o bloco %d: %w", height, err)
+		}
+		header, err := checkStoredHeader(db, block, height)
+		if err != nil {
+			return fmt.Errorf("bloco %d rejeitado: %w", height, err)
+		}
+		fmt.Printf("Reprocessando bloco: %d\n", height)
+		ProcessBlock(state, delta, block, height)
+		recordProofs(delta, block, height, header)
+	}
+
+	return progress.SaveRescan(db, heights, delta)
+}
+
+// checkStoredHeader confere que o bloco tem o mesmo cabeçalho aceito pelo scan
+// e o retorna. Blocos escaneados antes da cadeia de cabeçalhos existir não têm
+// com o que ser comparados.
+func checkStoredHeader(db *storage.DB, block map[string]interface{}, height int) (*wire.BlockHeader, error) {
+	header, err := chain.HeaderFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := StoredHeader(db, height)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil && header.BlockHash() != stored.BlockHash() {
+		return nil, fmt.Errorf("hash %s difere do cabeçalho aceito %s", header.BlockHash(), stored.BlockHash())
+	}
+	return header, nil
+}
@@ -0,0 +1,349 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"wallet/internal/storage"
+	"wallet/pkg/chain"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+	"wallet/pkg/progress"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Scanner percorre os blocos em ordem e aplica as transações ao WalletState,
+// salvando checkpoints periódicos do estado junto com a altura processada.
+type Scanner struct {
+	db              *storage.DB
+	state           *models.WalletState
+	delta           *models.StateDelta // Mudanças desde o último checkpoint
+	checkpointEvery int
+	retention       storage.RetentionPolicy
+	chain           *chain.Chain // Cadeia de cabeçalhos; nil desativa a validação
+}
+
+// New cria um Scanner que salva um checkpoint a cada checkpointEvery blocos.
+// Valores menores que 1 salvam a cada bloco.
+func New(db *storage.DB, state *models.WalletState, checkpointEvery int) *Scanner {
+	if checkpointEvery < 1 {
+		checkpointEvery = 1
+	}
+	return &Scanner{
+		db:              db,
+		state:           state,
+		delta:           models.NewStateDelta(),
+		checkpointEvery: checkpointEvery,
+		retention:       storage.RetentionPolicy{Mode: storage.RetainAll},
+	}
+}
+
+// SetRetention define quais blocos ficam no cache depois de cada checkpoint.
+func (s *Scanner) SetRetention(policy storage.RetentionPolicy) {
+	s.retention = policy
+}
+
+// SetChainParams ativa a validação dos cabeçalhos com as regras da rede. A
+// cadeia continua dos cabeçalhos aceitos em execuções anteriores.
+func (s *Scanner) SetChainParams(params *chain.Params) {
+	s.chain = chain.New(params, func(height int) (*wire.BlockHeader, error) {
+		return StoredHeader(s.db, height)
+	})
+}
+
+// Run processa os blocos de lastProcessed+1 até target e retorna a última altura
+// efetivamente aplicada ao estado. O scan para no primeiro bloco que não puder
+// ser obtido ou quando ctx for cancelado; em ambos os casos o progresso até o
+// último bloco aplicado é salvo, para que a próxima execução retome exatamente dali.
+func (s *Scanner) Run(ctx context.Context, lastProcessed, target int) (int, error) {
+	height := lastProcessed
+	lastSaved := lastProcessed
+
+	checkpoint := func() error {
+		if height == lastSaved {
+			return nil
+		}
+		// Mudanças e altura são gravadas na mesma transação do banco
+		if err := progress.SaveProgress(s.db, height, s.delta); err != nil {
+			return fmt.Errorf("erro ao salvar checkpoint no bloco %d: %w", height, err)
+		}
+		s.delta.Reset()
+		lastSaved = height
+
+		// A poda só roda depois do checkpoint, quando o índice já está gravado
+		if _, err := s.db.PruneBlocks(s.retention, height); err != nil {
+			return fmt.Errorf("erro ao podar cache de blocos: %w", err)
+		}
+		return nil
+	}
+
+	for next := lastProcessed + 1; next <= target; next++ {
+		if err := ctx.Err(); err != nil {
+			fmt.Printf("Scan interrompido antes do bloco %d\n", next)
+			break
+		}
+
+		block, err := storage.FetchAndStoreBlock(s.db, next)
+		if err != nil {
+			if recErr := s.db.RecordFetchError(next, err); recErr != nil {
+				fmt.Printf("Erro ao registrar falha do bloco %d: %v\n", next, recErr)
+			}
+			if cpErr := checkpoint(); cpErr != nil {
+				return height, cpErr
+			}
+			return height, fmt.Errorf("erro ao buscar o bloco %d: %w", next, err)
+		}
+		// Bloco inválido para a cadeia não chega ao estado
+		header, err := s.validate(block, next)
+		if err != nil {
+			if cpErr := checkpoint(); cpErr != nil {
+				return height, cpErr
+			}
+			return height, fmt.Errorf("bloco %d rejeitado: %w", next, err)
+		}
+		fmt.Printf("Processando bloco: %d\n", next)
+
+		ProcessBlock(s.state, s.delta, block, next)
+		recordProofs(s.delta, block, next, header)
+		height = next
+
+		if height-lastSaved >= s.checkpointEvery {
+			if err := checkpoint(); err != nil {
+				return height, err
+			}
+		}
+	}
+
+	return height, checkpoint()
+}
+
+// validate confere a altura e a raiz de merkle do bloco contra os txids, e o
+// bloco contra a cadeia de cabeçalhos, registrando o cabeçalho aceito no
+// delta. Sem cadeia, do cabeçalho só confere o hash.
+func (s *Scanner) validate(block map[string]interface{}, height int) (*wire.BlockHeader, error) {
+	// Sem isso, um bloco com transações trocadas creditaria a carteira antes
+	// de as provas SPV falharem
+	if issue := storage.CheckBlock(block, height); issue != nil {
+		return nil, fmt.Errorf("%s: %s", issue.Kind, issue.Detail)
+	}
+	if s.chain == nil {
+		return chain.HeaderFromBlock(block)
+	}
+	header, err := s.chain.Validate(block, height)
+	if err != nil {
+		return nil, err
+	}
+	var raw bytes.Buffer
+	if err := header.Serialize(&raw); err != nil {
+		return nil, err
+	}
+	s.delta.AddHeader(height, raw.Bytes())
+	return header, nil
+}
+
+// ProcessBlock aplica as saídas recebidas e as entradas gastas de um bloco
+// (formato do getblock verbosity 2) ao estado da carteira, registrando as
+// mudanças em delta quando ele não for nil, junto com as saídas OP_RETURN das
+// transações que tocaram a carteira.
+func ProcessBlock(state *models.WalletState, delta *models.StateDelta, block map[string]interface{}, blockHeight int) {
+	txList, ok := block["tx"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, tx := range txList {
+		txMap, ok := tx.(map[string]interface{})
+		if !ok {
+			fmt.Println("Erro ao converter transação")
+			continue
+		}
+		coinbase := helpers.IsCoinbase(txMap)
+		touched := false
+
+		// Processar saídas (vout) para adicionar UTXOs
+		if voutList, ok := txMap["vout"].([]interface{}); ok {
+			for voutIndex, vout := range voutList {
+				voutMap, ok := vout.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				scriptPubKey, ok := voutMap["scriptPubKey"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				address, ok := scriptPubKey["address"].(string)
+				if !ok {
+					continue
+				}
+
+				// P2WPKH da carteira ou multisig registrado, sem chave privada única
+				privateKey, found := helpers.GetPrivateKeyForAddress(state, address)
+				var witnessScript []byte
+				if !found {
+					ms, ok := state.Multisig(address)
+					if !ok {
+						continue
+					}
+					witnessScript = ms.WitnessScript
+				}
+				value, ok := voutMap["value"].(float64)
+				if !ok {
+					continue
+				}
+				txid, ok := txMap["txid"].(string)
+				if !ok {
+					continue
+				}
+				script, err := hex.DecodeString(fmt.Sprint(scriptPubKey["hex"]))
+				if err != nil {
+					fmt.Printf("Erro ao decodificar scriptPubKey de %s:%d: %v\n", txid, voutIndex, err)
+					continue
+				}
+				utxo := models.UTXO{
+					TxID:          txid,
+					VoutIndex:     voutIndex,
+					Address:       address,
+					PrivateKey:    privateKey,
+					Value:         value,
+					Height:        blockHeight,
+					Coinbase:      coinbase,
+					ScriptPubKey:  script,
+					WitnessScript: witnessScript,
+				}
+				// Troco visto na cadeia: a chave não pode ser reaproveitada
+				if state.MarkChangeUsed(address) && delta != nil {
+					delta.ChangeIndex = state.ChangeIndex
+				}
+				if helpers.UpdateUTXO(state, utxo) && delta != nil {
+					outpoint := fmt.Sprintf("%s:%d", txid, voutIndex)
+					delta.AddUTXO(outpoint, utxo)
+					touched = true
+					delta.Touch(blockHeight, hex.EncodeToString(script), txid)
+					delta.AddLedger(models.LedgerEntry{
+						Height:   blockHeight,
+						Kind:     models.LedgerReceive,
+						TxID:     txid,
+						Index:    voutIndex,
+						Outpoint: outpoint,
+						Address:  address,
+						Value:    value,
+					})
+				}
+			}
+		}
+
+		// Processar entradas (vin) para remover UTXOs gastos
+		spendingTxID, _ := txMap["txid"].(string)
+		if vinList, ok := txMap["vin"].([]interface{}); ok {
+			for vinIndex, vin := range vinList {
+				vinMap, ok := vin.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				txid, ok := vinMap["txid"].(string)
+				if !ok {
+					continue
+				}
+
+				voutIndex, ok := vinMap["vout"].(float64) // Índice do vout
+				if !ok {
+					continue
+				}
+
+				utxoKey := fmt.Sprintf("%s:%d", txid, int(voutIndex))
+				if spent, exists := state.UTXOs[utxoKey]; exists {
+					delete(state.UTXOs, utxoKey)
+					fmt.Printf("Removendo UTXO gasto: %s\n", utxoKey)
+					settlePending(state, delta, utxoKey, spendingTxID)
+					if delta != nil {
+						delta.SpendUTXO(utxoKey)
+						touched = true
+						delta.Touch(blockHeight, hex.EncodeToString(spent.ScriptPubKey), spendingTxID)
+						delta.AddLedger(models.LedgerEntry{
+							Height:   blockHeight,
+							Kind:     models.LedgerSpend,
+							TxID:     spendingTxID,
+							Index:    vinIndex,
+							Outpoint: utxoKey,
+							Address:  spent.Address,
+							Value:    spent.Value,
+						})
+					}
+				}
+			}
+		}
+
+		if touched {
+			recordDataOutputs(delta, txMap, blockHeight)
+		}
+	}
+}
+
+// settlePending resolve as transações pendentes que gastam o outpoint: a que
+// confirmou e as versões em conflito com ela (a original ou as substituições
+// por taxa) deixam de ser pendentes.
+func settlePending(state *models.WalletState, delta *models.StateDelta, outpoint, spendingTxID string) {
+	for txid, pending := range state.Pending {
+		for _, input := range pending.Inputs {
+			if input != outpoint {
+				continue
+			}
+			if txid == spendingTxID {
+				fmt.Printf("Transação pendente %s confirmada\n", txid)
+			} else {
+				fmt.Printf("Transação pendente %s descartada: %s confirmou no lugar dela\n", txid, spendingTxID)
+			}
+			delete(state.Pending, txid)
+			if delta != nil {
+				delta.Settle(txid)
+			}
+			break
+		}
+	}
+}
+
+// recordDataOutputs registra em delta o conteúdo das saídas OP_RETURN de uma
+// transação da carteira.
+func recordDataOutputs(delta *models.StateDelta, txMap map[string]interface{}, blockHeight int) {
+	txid, _ := txMap["txid"].(string)
+	voutList, _ := txMap["vout"].([]interface{})
+	for voutIndex, vout := range voutList {
+		voutMap, ok := vout.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		scriptPubKey, ok := voutMap["scriptPubKey"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		script, err := hex.DecodeString(fmt.Sprint(scriptPubKey["hex"]))
+		if err != nil {
+			continue
+		}
+		if payload, ok := helpers.DataPayload(script); ok {
+			delta.AddData(models.DataOutput{Height: blockHeight, TxID: txid, Index: voutIndex, Payload: payload})
+		}
+	}
+}
+
+// StoredHeader lê o cabeçalho aceito na altura height, ou nil se não houver.
+func StoredHeader(db *storage.DB, height int) (*wire.BlockHeader, error) {
+	var header *wire.BlockHeader
+	err := db.View(func(txn storage.Txn) error {
+		raw, err := storage.GetHeader(txn, height)
+		if err == storage.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header = &wire.BlockHeader{}
+		return header.Deserialize(bytes.NewReader(raw))
+	})
+	return header, err
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"wallet/internal/storage"
+	"wallet/pkg/helpers"
+	"wallet/pkg/models"
+	"wallet/pkg/progress"
+)
+
+func TestValidateRejectsMerkleMismatch(t *testing.T) {
+	txids := []string{strings.Repeat("11", 32), strings.Repeat("22", 32)}
+	root, err := helpers.MerkleRoot(txids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(storage.NewMemoryDB(), &models.WalletState{UTXOs: make(map[string]models.UTXO)}, 1)
+
+	tests := []struct {
+		name  string
+		block map[string]interface{}
+	}{
+		{"txid trocado", map[string]interface{}{
+			"height": float64(5), "merkleroot": root,
+			"tx": []interface{}{txids[0], strings.Repeat("33", 32)},
+		}},
+		{"transação removida", map[string]interface{}{
+			"height": float64(5), "merkleroot": root,
+			"tx": []interface{}{txids[0]},
+		}},
+		{"altura trocada", map[string]interface{}{
+			"height": float64(6), "merkleroot": root,
+			"tx": []interface{}{txids[0], txids[1]},
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.validate(tc.block, 5); err == nil {
+				t.Fatal("bloco inválido aceito")
+			}
+		})
+	}
+}
+
+const testXprv = "tprv8ZgxMBicQKsPdt2JSGYoFa3bag1DMeGF8zdJC3ECLwCbUWdoZMq2wkqrN3zMaY9ep1RpD6yqLLmPohMgptXQ56YHr5NBLoUoXxLv97MjDcz"
+
+// testOutput é uma saída de getblock verbosity 2 pagando ao endereço.
+func testOutput(address string, script []byte, value float64) interface{} {
+	return map[string]interface{}{
+		"value":        value,
+		"scriptPubKey": map[string]interface{}{"address": address, "hex": hex.EncodeToString(script)},
+	}
+}
+
+// O scan roda inteiro sobre o backend em memória: blocos aplicados com
+// ProcessBlock e gravados com SaveProgress voltam iguais no LoadProgress.
+func TestProcessBlockSaveAndLoad(t *testing.T) {
+	db := storage.NewMemoryDB()
+	state := &models.WalletState{UTXOs: make(map[string]models.UTXO)}
+	if err := helpers.DeriveKeyPairs(testXprv, 2, state); err != nil {
+		t.Fatal(err)
+	}
+	changeKeys, err := helpers.DeriveChangeKeys(testXprv, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := progress.SaveKeys(db, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := progress.SaveChangeKeys(db, changeKeys, state.ChangeIndex); err != nil {
+		t.Fatal(err)
+	}
+	receive, err := helpers.GetP2WPKHProgram(state.PublicKeys[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := state.ChangeKeys[0]
+
+	// Bloco 1 paga ao recebimento /0/0 e ao troco /1/0; o bloco 2 gasta o primeiro
+	funding, spending := strings.Repeat("aa", 32), strings.Repeat("bb", 32)
+	blocks := []map[string]interface{}{
+		{"tx": []interface{}{map[string]interface{}{
+			"txid": funding,
+			"vin":  []interface{}{map[string]interface{}{"txid": strings.Repeat("cc", 32), "vout": float64(0)}},
+			"vout": []interface{}{testOutput(state.Addresses[0][0], receive, 0.5), testOutput(change.Address, change.WitnessProgram, 0.25)},
+		}}},
+		{"tx": []interface{}{map[string]interface{}{
+			"txid": spending,
+			"vin":  []interface{}{map[string]interface{}{"txid": funding, "vout": float64(0)}},
+			"vout": []interface{}{testOutput("tb1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq", make([]byte, 22), 0.4)},
+		}}},
+	}
+	for i, block := range blocks {
+		delta := models.NewStateDelta()
+		ProcessBlock(state, delta, block, i+1)
+		if err := progress.SaveProgress(db, i+1, delta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	height, loaded, err := progress.LoadProgress(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 2 || loaded == nil {
+		t.Fatalf("progresso %d (estado %v), esperava 2", height, loaded)
+	}
+	if !reflect.DeepEqual(loaded.UTXOs, state.UTXOs) {
+		t.Fatalf("UTXOs carregados %v, esperava %v", loaded.UTXOs, state.UTXOs)
+	}
+	utxo, ok := loaded.UTXOs[funding+":1"]
+	if len(loaded.UTXOs) != 1 || !ok || !bytes.Equal(utxo.PrivateKey, change.PrivateKey) {
+		t.Fatalf("UTXOs carregados %v, esperava só o troco %s:1 com a chave privada", loaded.UTXOs, funding)
+	}
+	if loaded.ChangeIndex != 1 {
+		t.Fatalf("índice de troco %d, esperava 1", loaded.ChangeIndex)
+	}
+
+	var ledger []models.LedgerEntry
+	if err := db.View(func(txn storage.Txn) error {
+		var err error
+		ledger, err = storage.ListLedger(txn, 0, height)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]int)
+	for _, entry := range ledger {
+		kinds[entry.Kind]++
+	}
+	if kinds[models.LedgerReceive] != 2 || kinds[models.LedgerSpend] != 1 {
+		t.Fatalf("lançamentos %v, esperava dois recebimentos e um gasto", ledger)
+	}
+}